@@ -0,0 +1,162 @@
+package runner
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	svmkitRunner "github.com/abklabs/pulumi-runner/pkg/runner/core"
+	"github.com/abklabs/pulumi-runner/pkg/runner/core/deb"
+	"github.com/kballard/go-shellquote"
+	cryptossh "golang.org/x/crypto/ssh"
+)
+
+const defaultAptLockTimeout = 300
+
+// aptCommand runs a script of apt steps on the remote host, with the
+// svmkit lock helpers available and any local debs in the group and
+// extra files placed in the payload.
+type aptCommand struct {
+	script string
+	env    map[string]string
+	arrays map[string][]string
+	group  *deb.PackageGroup
+	files  []svmkitRunner.PayloadFile
+	config *svmkitRunner.Config
+}
+
+func (c *aptCommand) Check() error {
+	if c.script == "" {
+		return fmt.Errorf("apt script cannot be empty")
+	}
+	return nil
+}
+
+func (c *aptCommand) Env() *svmkitRunner.EnvBuilder {
+	env := svmkitRunner.NewEnvBuilder()
+
+	timeout := defaultAptLockTimeout
+	if c.config != nil && c.config.AptLockTimeout != nil {
+		timeout = *c.config.AptLockTimeout
+	}
+	env.SetInt("APT_LOCK_TIMEOUT", timeout)
+
+	if c.group != nil && c.group.HasLocalRepository() {
+		env.Set(deb.LocalRepositoryEnv, deb.LocalRepositoryIndex)
+	}
+
+	env.SetMap(c.env)
+	for k, v := range c.arrays {
+		env.SetArray(k, v)
+	}
+	return env
+}
+
+func (c *aptCommand) AddToPayload(p *svmkitRunner.Payload) error {
+	if c.group != nil {
+		if err := c.group.AddToPayload(p); err != nil {
+			return err
+		}
+	}
+	for _, f := range c.files {
+		p.Add(f)
+	}
+	p.AddString(svmkitRunner.ScriptNameSteps, c.script)
+	return nil
+}
+
+func (c *aptCommand) Config() *svmkitRunner.Config {
+	return c.config
+}
+
+// dpkgQueryFormat has dpkg-query print the name, version and status
+// abbreviation of each package, tab separated.
+const dpkgQueryFormat = `${Package}\t${Version}\t${db:Status-Abbrev}\n`
+
+// remoteOutput runs a command on the remote host and returns what it
+// wrote to stdout and stderr.
+func remoteOutput(client *cryptossh.Client, args ...string) (out []byte, stderr string, err error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create SSH session: %w", err)
+	}
+
+	defer func() {
+		if closeErr := session.Close(); closeErr != io.EOF {
+			err = errors.Join(err, closeErr)
+		}
+	}()
+
+	var errBuf bytes.Buffer
+	session.Stderr = &errBuf
+
+	out, err = session.Output(shellquote.Join(args...))
+
+	return out, errBuf.String(), err
+}
+
+// queryInstalled returns the versions of the named packages that are
+// installed on the remote host.  Packages that aren't installed are
+// left out.
+func queryInstalled(client *cryptossh.Client, names []string) (map[string]string, error) {
+	if len(names) == 0 {
+		return map[string]string{}, nil
+	}
+
+	args := append([]string{"dpkg-query", "-W", "-f", dpkgQueryFormat, "--"}, names...)
+
+	out, stderr, err := remoteOutput(client, args...)
+
+	// dpkg-query exits with 1 when some of the packages are unknown,
+	// but still reports the rest.
+	var exitErr *cryptossh.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitStatus() == 1 {
+		err = nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to query installed packages (output: %q): %w", stderr, err)
+	}
+
+	return parseDpkgQuery(out)
+}
+
+// queryAvailable returns the versions of the named packages offered by
+// the remote host's apt sources.  Unknown packages are left out.
+func queryAvailable(client *cryptossh.Client, names []string) (map[string][]deb.Available, error) {
+	if len(names) == 0 {
+		return map[string][]deb.Available{}, nil
+	}
+
+	out, stderr, err := remoteOutput(client, append([]string{"apt-cache", "madison"}, names...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query available packages (output: %q): %w", stderr, err)
+	}
+
+	return deb.ParseMadison(out)
+}
+
+func parseDpkgQuery(out []byte) (map[string]string, error) {
+	installed := map[string]string{}
+
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		fields := strings.Split(s.Text(), "\t")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid output from dpkg-query (got %q)", s.Text())
+		}
+
+		// Packages that were removed but still have config files
+		// around are reported too; only "ii" is installed.
+		if strings.TrimSpace(fields[2]) != "ii" {
+			continue
+		}
+
+		installed[fields[0]] = fields[1]
+	}
+
+	return installed, s.Err()
+}
@@ -0,0 +1,535 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
+
+	svmkitRunner "github.com/abklabs/pulumi-runner/pkg/runner/core"
+	"github.com/abklabs/pulumi-runner/pkg/runner/core/deb"
+	"github.com/abklabs/pulumi-runner/pkg/ssh"
+	"github.com/abklabs/pulumi-runner/pkg/utils"
+	p "github.com/pulumi/pulumi-go-provider"
+	"github.com/pulumi/pulumi-go-provider/infer"
+	cryptossh "golang.org/x/crypto/ssh"
+)
+
+const (
+	AptOnDeleteKeep   = "keep"
+	AptOnDeleteRemove = "remove"
+	AptOnDeletePurge  = "purge"
+)
+
+// aptReleaseStep removes the preferences and holds of packages that are
+// no longer pinned.  Held packages can't be changed by apt-get install,
+// so every hold is released before installing and put back after.  If
+// the run fails before its last step, the holds are put back as they
+// were, as the resource still records them.
+const aptReleaseStep = `
+step::00-release() {
+    (( ${#APT_UNPIN[@]} + ${#APT_UNHOLD[@]} )) || return 0
+    svmkit::flock::start
+    if (( ${#APT_UNPIN[@]} )); then
+        svmkit::sudo rm -f "${APT_UNPIN[@]}"
+    fi
+    if (( ${#APT_UNHOLD[@]} )); then
+        exit::trigger apt::release::restore
+        svmkit::sudo apt-mark unhold "${APT_UNHOLD[@]}"
+    fi
+    svmkit::flock::end
+}
+
+step::99-released() {
+    APT_RELEASED=true
+}
+
+apt::release::restore() {
+    [[ -v APT_RELEASED ]] && return 0
+
+    # A failed step may have left the lock held.
+    svmkit::flock::cleanup
+
+    log::warn "Putting back the holds on $(array::join " " "${APT_UNHOLD[@]}")..."
+    svmkit::flock::run sudo apt-mark hold "${APT_UNHOLD[@]}"
+}
+`
+
+const aptInstallScript = aptReleaseStep + `
+step::10-update-cache() {
+    [[ $APT_UPDATE_CACHE == true ]] || return 0
+    svmkit::apt::update
+}
+
+step::20-install() {
+    svmkit::apt::get install "${APT_PACKAGES[@]}"
+}
+
+step::30-pin() {
+    (( ${#APT_HOLD[@]} )) || [[ -d preferences ]] || return 0
+    svmkit::flock::start
+    if [[ -d preferences ]]; then
+        svmkit::sudo install -m 0644 -o root -g root preferences/* "$APT_PREFERENCES_DIR/"
+    fi
+    if (( ${#APT_HOLD[@]} )); then
+        svmkit::sudo apt-mark hold "${APT_HOLD[@]}"
+    fi
+    svmkit::flock::end
+}
+`
+
+const aptUpdateScript = `
+step::00-update-cache() {
+    svmkit::apt::update
+}
+`
+
+const aptRemoveScript = aptReleaseStep + `
+step::10-remove() {
+    (( ${#APT_PACKAGES[@]} )) || return 0
+    svmkit::apt::get "$APT_ACTION" "${APT_PACKAGES[@]}"
+}
+`
+
+type AptPackages struct{}
+
+type AptPackagesArgs struct {
+	Connection  ssh.Connection       `pulumi:"connection"`
+	Packages    []deb.Package        `pulumi:"packages"`
+	Config      *svmkitRunner.Config `pulumi:"config,optional"`
+	UpdateCache *bool                `pulumi:"updateCache,optional"`
+	OnDelete    *string              `pulumi:"onDelete,optional"`
+}
+
+func (r *AptPackagesArgs) Annotate(a infer.Annotator) {
+	a.Describe(&r.Connection, "The connection to the host to install the packages on.")
+	a.Describe(&r.Packages, "The packages to install.")
+	a.Describe(&r.Config, "Runner configuration; its packageConfig is applied to the packages.")
+	a.Describe(&r.UpdateCache, "Run apt-get update before installing.")
+	a.Describe(&r.OnDelete, "What to do with the packages this resource added when it's deleted: \"keep\", \"remove\" or \"purge\". Defaults to keep.")
+}
+
+type AptPackagesState struct {
+	AptPackagesArgs
+	Installed   map[string]string `pulumi:"installed"`
+	Added       []string          `pulumi:"added"`
+	Held        []string          `pulumi:"held,optional"`
+	Preferences []string          `pulumi:"preferences,optional"`
+	Resolved    map[string]string `pulumi:"resolved,optional"`
+}
+
+func (r *AptPackagesState) Annotate(a infer.Annotator) {
+	a.Describe(&r.Installed, "The installed version of each package, as reported by dpkg-query.")
+	a.Describe(&r.Added, "The packages that weren't installed before this resource installed them.")
+	a.Describe(&r.Held, "The packages this resource holds with apt-mark.")
+	a.Describe(&r.Preferences, "The apt preferences files this resource wrote to pin packages.")
+	a.Describe(&r.Resolved, "The version each package with a constraint was resolved to when it was installed.")
+}
+
+func (r *AptPackages) Annotate(a infer.Annotator) {
+	a.Describe(&r, "Install a group of apt packages on a remote host.")
+}
+
+// Validate ensures the AptPackagesArgs are properly configured
+func (a *AptPackagesArgs) Validate() error {
+	var errs []error
+
+	if len(a.Packages) == 0 {
+		errs = append(errs, fmt.Errorf("at least one package must be given"))
+	}
+
+	for _, pkg := range a.Packages {
+		if IsEmptyStr(&pkg.Name) {
+			errs = append(errs, fmt.Errorf("'Name' must be set for packages"))
+		}
+
+		if err := pkg.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	switch a.onDelete() {
+	case AptOnDeleteKeep, AptOnDeleteRemove, AptOnDeletePurge:
+	default:
+		errs = append(errs, fmt.Errorf("'OnDelete' must be %q, %q or %q", AptOnDeleteKeep, AptOnDeleteRemove, AptOnDeletePurge))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (a *AptPackagesArgs) onDelete() string {
+	if a.OnDelete == nil {
+		return AptOnDeleteKeep
+	}
+	return *a.OnDelete
+}
+
+// group returns the packages with the package config applied.
+func (a *AptPackagesArgs) group() (*deb.PackageGroup, error) {
+	g, _, err := a.groupChoices()
+	return g, err
+}
+
+// groupChoices is like group, but also returns the packages chosen from
+// the override directory.
+func (a *AptPackagesArgs) groupChoices() (*deb.PackageGroup, []deb.OverrideChoice, error) {
+	g := deb.NewPackageGroup(a.Packages...)
+
+	if a.Config == nil {
+		return g, nil, nil
+	}
+
+	choices, err := a.Config.UpdatePackageGroupChoices(g)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return g, choices, nil
+}
+
+// reportOverrides logs which packages were taken from the override
+// directory.
+func reportOverrides(ctx context.Context, choices []deb.OverrideChoice) {
+	for _, choice := range choices {
+		p.GetLogger(ctx).Infof("using local package %s", choice)
+	}
+}
+
+func (a *AptPackagesArgs) runnerArgs() utils.RunnerArgs {
+	return utils.RunnerArgs{Connection: a.Connection}
+}
+
+// pins returns how the packages in the group are to be pinned.
+func (a *AptPackagesArgs) pins(g *deb.PackageGroup) []deb.Pin {
+	if a.Config == nil || a.Config.PackageConfig == nil {
+		return nil
+	}
+
+	return a.Config.PackageConfig.Pins(g)
+}
+
+// releaseArrays returns the script arrays releasing the pins in previous
+// that aren't in preferences, and every hold.
+func releaseArrays(previous *AptPackagesState, preferences []string) map[string][]string {
+	arrays := map[string][]string{
+		"APT_UNPIN":  {},
+		"APT_UNHOLD": {},
+	}
+
+	if previous != nil {
+		for _, path := range previous.Preferences {
+			if !slices.Contains(preferences, path) {
+				arrays["APT_UNPIN"] = append(arrays["APT_UNPIN"], path)
+			}
+		}
+
+		arrays["APT_UNHOLD"] = previous.Held
+	}
+
+	return arrays
+}
+
+// resolve sets the versions of the packages with constraints from what
+// the host's apt sources offer, updating the cache first if asked to.
+// It reports whether the cache was updated.
+func (a *AptPackagesArgs) resolve(ctx context.Context, client *cryptossh.Client, g *deb.PackageGroup) (resolved map[string]string, updated bool, err error) {
+	names := g.Constrained()
+	if len(names) == 0 {
+		return nil, false, nil
+	}
+
+	if a.UpdateCache != nil && *a.UpdateCache {
+		cmd := &aptCommand{script: aptUpdateScript, config: a.Config}
+		if err := utils.RunOnClient(ctx, client, a.runnerArgs(), cmd); err != nil {
+			return nil, false, err
+		}
+		updated = true
+	}
+
+	available, err := queryAvailable(client, names)
+	if err != nil {
+		return nil, updated, err
+	}
+
+	resolved, err = g.Resolve(available)
+	if err != nil {
+		return nil, updated, err
+	}
+
+	for _, name := range names {
+		p.GetLogger(ctx).Infof("resolved %s to version %s", name, resolved[name])
+	}
+
+	return resolved, updated, nil
+}
+
+// install installs and pins the packages, releasing any pins in
+// previous that are no longer wanted.  Packages with constraints are
+// resolved to a version first.  The returned state has the installed
+// versions, the resolved versions, the pins, and which of the packages
+// weren't installed beforehand.
+func (a *AptPackagesArgs) install(ctx context.Context, client *cryptossh.Client, g *deb.PackageGroup, previous *AptPackagesState) (state AptPackagesState, err error) {
+	state.AptPackagesArgs = *a
+
+	before, err := queryInstalled(client, g.Names())
+	if err != nil {
+		return state, err
+	}
+
+	resolved, updated, err := a.resolve(ctx, client, g)
+	if err != nil {
+		return state, err
+	}
+
+	state.Resolved = resolved
+
+	cmd := &aptCommand{
+		script: aptInstallScript,
+		env: map[string]string{
+			"APT_UPDATE_CACHE":    fmt.Sprint(a.UpdateCache != nil && *a.UpdateCache && !updated),
+			"APT_PREFERENCES_DIR": deb.PreferencesDir,
+		},
+		group:  g,
+		config: a.Config,
+	}
+
+	for _, pin := range a.pins(g) {
+		if pin.Preferences != "" {
+			cmd.files = append(cmd.files, svmkitRunner.PayloadFile{
+				Path:   path.Join("preferences", path.Base(pin.PreferencesPath())),
+				Reader: strings.NewReader(pin.Preferences),
+				Mode:   0644,
+			})
+			state.Preferences = append(state.Preferences, pin.PreferencesPath())
+		}
+
+		if pin.Hold {
+			state.Held = append(state.Held, pin.Package)
+		}
+	}
+
+	// Local packages are installed through a repository that the
+	// group adds to the payload, so they can depend on each other.
+	args, err := g.ResolvedArgs()
+	if err != nil {
+		return state, err
+	}
+
+	cmd.arrays = releaseArrays(previous, state.Preferences)
+	cmd.arrays["APT_PACKAGES"] = args
+	cmd.arrays["APT_HOLD"] = append([]string{}, state.Held...)
+
+	if err := utils.RunOnClient(ctx, client, a.runnerArgs(), cmd); err != nil {
+		return state, err
+	}
+
+	state.Installed, err = queryInstalled(client, g.Names())
+	if err != nil {
+		return state, err
+	}
+
+	for _, name := range g.Names() {
+		if _, ok := before[packageName(name)]; !ok {
+			state.Added = append(state.Added, name)
+		}
+	}
+
+	slices.Sort(state.Added)
+
+	return state, nil
+}
+
+// remove releases the pins in previous, and removes or purges packages,
+// depending on the action.
+func (a *AptPackagesArgs) remove(ctx context.Context, client *cryptossh.Client, previous *AptPackagesState, action string, names []string) error {
+	if action == AptOnDeleteKeep {
+		names = nil
+	}
+
+	arrays := releaseArrays(previous, nil)
+	if len(names) == 0 && len(arrays["APT_UNPIN"]) == 0 && len(arrays["APT_UNHOLD"]) == 0 {
+		return nil
+	}
+
+	arrays["APT_PACKAGES"] = names
+
+	cmd := &aptCommand{
+		script: aptRemoveScript,
+		env:    map[string]string{"APT_ACTION": action},
+		arrays: arrays,
+		config: a.Config,
+	}
+
+	return utils.RunOnClient(ctx, client, a.runnerArgs(), cmd)
+}
+
+func (AptPackages) Create(ctx context.Context, name string, input AptPackagesArgs, preview bool) (string, AptPackagesState, error) {
+	state := AptPackagesState{AptPackagesArgs: input}
+
+	if err := input.Validate(); err != nil {
+		return "", state, err
+	}
+
+	g, choices, err := input.groupChoices()
+	if err != nil {
+		return "", state, err
+	}
+
+	reportOverrides(ctx, choices)
+
+	if preview {
+		return name, state, nil
+	}
+
+	err = withClient(ctx, input.Connection, func(client *cryptossh.Client) (err error) {
+		state, err = input.install(ctx, client, g, nil)
+		return err
+	})
+	if err != nil {
+		return "", state, err
+	}
+
+	return name, state, nil
+}
+
+// packageName strips any architecture qualifier from a package name, as
+// dpkg-query leaves it out.
+func packageName(name string) string {
+	name, _, _ = strings.Cut(name, ":")
+	return name
+}
+
+// drifted reports whether the installed packages no longer satisfy the
+// group.
+func drifted(g *deb.PackageGroup, installed map[string]string) bool {
+	for _, pkg := range g.Packages() {
+		version, ok := installed[packageName(pkg.Name)]
+		if !ok || !pkg.Satisfied(version) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (AptPackages) Diff(ctx context.Context, id string, olds AptPackagesState, news AptPackagesArgs) (p.DiffResponse, error) {
+	diff := map[string]p.PropertyDiff{}
+
+	if deref(olds.Connection.Host) != deref(news.Connection.Host) {
+		diff["connection"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	} else if !reflect.DeepEqual(olds.Connection, news.Connection) {
+		diff["connection"] = p.PropertyDiff{Kind: p.Update}
+	}
+
+	if !reflect.DeepEqual(olds.Config, news.Config) {
+		diff["config"] = p.PropertyDiff{Kind: p.Update}
+	}
+
+	if !reflect.DeepEqual(olds.UpdateCache, news.UpdateCache) {
+		diff["updateCache"] = p.PropertyDiff{Kind: p.Update}
+	}
+
+	if olds.onDelete() != news.onDelete() {
+		diff["onDelete"] = p.PropertyDiff{Kind: p.Update}
+	}
+
+	// Packages that have gone missing or changed version since they were
+	// installed, as found by Read, are a change too.  A group that can't
+	// be built is reported as one, so the error surfaces during the
+	// update.
+	g, err := news.group()
+	if err != nil || !reflect.DeepEqual(olds.Packages, news.Packages) || drifted(g, olds.Installed) {
+		diff["packages"] = p.PropertyDiff{Kind: p.Update}
+	}
+
+	return p.DiffResponse{
+		HasChanges:   len(diff) > 0,
+		DetailedDiff: diff,
+	}, nil
+}
+
+func (AptPackages) Read(ctx context.Context, id string, inputs AptPackagesArgs, state AptPackagesState) (string, AptPackagesArgs, AptPackagesState, error) {
+	g, err := state.group()
+	if err != nil {
+		return "", inputs, state, err
+	}
+
+	err = withClient(ctx, state.Connection, func(client *cryptossh.Client) (err error) {
+		state.Installed, err = queryInstalled(client, g.Names())
+		return err
+	})
+	if err != nil {
+		return "", inputs, state, err
+	}
+
+	return id, inputs, state, nil
+}
+
+func (AptPackages) Update(ctx context.Context, id string, olds AptPackagesState, news AptPackagesArgs, preview bool) (AptPackagesState, error) {
+	state := AptPackagesState{AptPackagesArgs: news}
+
+	if err := news.Validate(); err != nil {
+		return state, err
+	}
+
+	g, choices, err := news.groupChoices()
+	if err != nil {
+		return state, err
+	}
+
+	reportOverrides(ctx, choices)
+
+	// Packages this resource added and no longer wants are removed
+	// just as they would be on delete.
+	var kept, dropped []string
+	for _, name := range olds.Added {
+		if g.IsIncluded(name) {
+			kept = append(kept, name)
+		} else {
+			dropped = append(dropped, name)
+		}
+	}
+
+	if preview {
+		state.Installed = olds.Installed
+		state.Added = kept
+		return state, nil
+	}
+
+	err = withClient(ctx, news.Connection, func(client *cryptossh.Client) (err error) {
+		state, err = news.install(ctx, client, g, &olds)
+		if err != nil {
+			return err
+		}
+
+		if err := news.remove(ctx, client, nil, news.onDelete(), dropped); err != nil {
+			return err
+		}
+
+		state.Added = append(state.Added, kept...)
+		slices.Sort(state.Added)
+		state.Added = slices.Compact(state.Added)
+
+		return nil
+	})
+	if err != nil {
+		return AptPackagesState{}, err
+	}
+
+	return state, nil
+}
+
+// Delete releases any pins the resource made, even if the packages are
+// kept.
+func (AptPackages) Delete(ctx context.Context, id string, state AptPackagesState) error {
+	if state.onDelete() == AptOnDeleteKeep && len(state.Held) == 0 && len(state.Preferences) == 0 {
+		return nil
+	}
+
+	return withClient(ctx, state.Connection, func(client *cryptossh.Client) error {
+		return state.remove(ctx, client, &state, state.onDelete(), state.Added)
+	})
+}
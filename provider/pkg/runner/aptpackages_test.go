@@ -0,0 +1,169 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/abklabs/pulumi-runner/pkg/runner/core/deb"
+	"github.com/abklabs/pulumi-runner/pkg/ssh/sshtest"
+	"github.com/abklabs/pulumi-runner/pkg/utils"
+	p "github.com/pulumi/pulumi-go-provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDpkgQuery(t *testing.T) {
+	out := "curl\t7.88.1-10+deb12u5\tii \n" +
+		"jq\t1.6-2.1\trc \n" +
+		"libc6\t2.36-9+deb12u4\tii \n"
+
+	installed, err := parseDpkgQuery([]byte(out))
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"curl":  "7.88.1-10+deb12u5",
+		"libc6": "2.36-9+deb12u4",
+	}, installed)
+
+	_, err = parseDpkgQuery([]byte("curl 7.88.1\n"))
+	assert.ErrorContains(t, err, "invalid output from dpkg-query")
+}
+
+func TestAptPackagesValidate(t *testing.T) {
+	args := AptPackagesArgs{Packages: deb.Package{}.MakePackages("curl")}
+	assert.NoError(t, args.Validate())
+
+	args.OnDelete = ptr("destroy")
+	assert.ErrorContains(t, args.Validate(), "'OnDelete'")
+
+	args = AptPackagesArgs{}
+	assert.ErrorContains(t, args.Validate(), "at least one package")
+
+	args = AptPackagesArgs{Packages: []deb.Package{{Name: "jq", Constraint: ptr(">= 1.6,")}}}
+	assert.ErrorContains(t, args.Validate(), "empty clause")
+}
+
+func TestAptCommandLocalRepositoryEnv(t *testing.T) {
+	c := &aptCommand{group: deb.Package{}.MakePackageGroup("curl")}
+	assert.NotContains(t, c.Env().Map(), deb.LocalRepositoryEnv)
+
+	c.group.Add(deb.Package{Name: "tool", LocalPath: ptr("./tool.deb")})
+	assert.Equal(t, deb.LocalRepositoryIndex, c.Env().Map()[deb.LocalRepositoryEnv])
+}
+
+func TestAptPackagesDrift(t *testing.T) {
+	g := deb.NewPackageGroup(
+		deb.Package{Name: "curl"},
+		deb.Package{Name: "jq", Version: ptr("1.6-2.1")},
+		deb.Package{Name: "libc6:amd64"},
+	)
+
+	installed := map[string]string{
+		"curl":  "7.88.1-10+deb12u5",
+		"jq":    "1.6-2.1",
+		"libc6": "2.36-9+deb12u4",
+	}
+
+	assert.False(t, drifted(g, installed))
+
+	installed["jq"] = "1.7.1-3"
+	assert.True(t, drifted(g, installed))
+
+	installed["jq"] = "1.6-2.1"
+	delete(installed, "curl")
+	assert.True(t, drifted(g, installed))
+
+	// A constraint is checked rather than the version it resolved to.
+	g = deb.NewPackageGroup(deb.Package{Name: "jq", Constraint: ptr(">= 1.6, < 2")})
+	assert.False(t, drifted(g, map[string]string{"jq": "1.7.1-3"}))
+	assert.True(t, drifted(g, map[string]string{"jq": "2.0-1"}))
+}
+
+func TestAptPackagesDiff(t *testing.T) {
+	args := AptPackagesArgs{Packages: deb.Package{}.MakePackages("curl", "jq")}
+
+	olds := AptPackagesState{
+		AptPackagesArgs: args,
+		Installed:       map[string]string{"curl": "7.88.1-10+deb12u5", "jq": "1.6-2.1"},
+		Added:           []string{"jq"},
+	}
+
+	diff := func(news AptPackagesArgs) p.DiffResponse {
+		resp, err := AptPackages{}.Diff(context.Background(), "id", olds, news)
+		require.NoError(t, err)
+		return resp
+	}
+
+	assert.False(t, diff(args).HasChanges)
+
+	news := args
+	news.Packages = deb.Package{}.MakePackages("curl")
+	assert.Equal(t, p.Update, diff(news).DetailedDiff["packages"].Kind)
+
+	news = args
+	news.OnDelete = ptr(AptOnDeletePurge)
+	assert.Equal(t, p.Update, diff(news).DetailedDiff["onDelete"].Kind)
+
+	// A package removed by hand, as found by Read.
+	olds.Installed = map[string]string{"curl": "7.88.1-10+deb12u5"}
+	assert.Equal(t, p.Update, diff(args).DetailedDiff["packages"].Kind)
+}
+
+func TestAptPackagesReleaseArrays(t *testing.T) {
+	assert.Equal(t, map[string][]string{"APT_UNPIN": {}, "APT_UNHOLD": {}}, releaseArrays(nil, nil))
+
+	previous := &AptPackagesState{
+		Held:        []string{"jq"},
+		Preferences: []string{"/etc/apt/preferences.d/svmkit-jq.pref", "/etc/apt/preferences.d/svmkit-curl.pref"},
+	}
+
+	assert.Equal(t, map[string][]string{
+		"APT_UNPIN":  {"/etc/apt/preferences.d/svmkit-curl.pref"},
+		"APT_UNHOLD": {"jq"},
+	}, releaseArrays(previous, []string{"/etc/apt/preferences.d/svmkit-jq.pref"}))
+}
+
+func TestAptInstallRestoresHolds(t *testing.T) {
+	server := sshtest.NewServer(t)
+	sshtest.StubSudo(t)
+
+	// apt-mark records what it's asked to do, and apt-get install fails.
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "apt-mark"), []byte("#!/bin/sh\necho apt-mark \"$@\" >> "+log+"\n"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "apt-get"), []byte("#!/bin/sh\ncase \"$*\" in *install*) exit 100;; esac\n"), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	client := server.Dial(t)
+
+	run := func(script string, packages ...string) error {
+		arrays := releaseArrays(&AptPackagesState{Held: []string{"jq", "curl"}}, nil)
+		arrays["APT_PACKAGES"] = packages
+		arrays["APT_HOLD"] = []string{"jq"}
+
+		cmd := &aptCommand{
+			script: script,
+			env:    map[string]string{"APT_UPDATE_CACHE": "false", "APT_PREFERENCES_DIR": dir, "APT_ACTION": "remove"},
+			arrays: arrays,
+		}
+
+		return utils.RunOnClient(context.Background(), client, utils.RunnerArgs{}, cmd)
+	}
+
+	// The install failing puts back the holds it released.
+	require.Error(t, run(aptInstallScript, "jq=1.7"))
+
+	data, err := os.ReadFile(log)
+	require.NoError(t, err)
+	assert.Equal(t, "apt-mark unhold jq curl\napt-mark hold jq curl\n", string(data))
+
+	// A removal that works leaves them released.
+	require.NoError(t, os.Remove(log))
+	require.NoError(t, run(aptRemoveScript))
+
+	data, err = os.ReadFile(log)
+	require.NoError(t, err)
+	assert.Equal(t, "apt-mark unhold jq curl\n", string(data))
+}
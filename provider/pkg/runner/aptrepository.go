@@ -0,0 +1,270 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	svmkitRunner "github.com/abklabs/pulumi-runner/pkg/runner/core"
+	"github.com/abklabs/pulumi-runner/pkg/ssh"
+	"github.com/abklabs/pulumi-runner/pkg/utils"
+	p "github.com/pulumi/pulumi-go-provider"
+	"github.com/pulumi/pulumi-go-provider/infer"
+)
+
+const (
+	aptSourcesDir  = "/etc/apt/sources.list.d"
+	aptKeyringsDir = "/etc/apt/keyrings"
+
+	armoredKeyHeader = "-----BEGIN PGP PUBLIC KEY BLOCK-----"
+)
+
+// apt ignores files in sources.list.d whose names have other characters.
+var aptSourceNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// The files are written and removed under the svmkit lock, so that an
+// apt-get run elsewhere never sees a source without its key.
+const aptRepositoryInstallScript = `
+step::00-install-source() {
+    svmkit::flock::start
+    svmkit::sudo install -d -m 0755 "$(dirname "$APT_KEYRING_PATH")"
+    svmkit::sudo install -m 0644 -o root -g root repository.asc "$APT_KEYRING_PATH"
+    svmkit::sudo install -m 0644 -o root -g root repository.sources "$APT_SOURCES_PATH"
+    svmkit::flock::end
+}
+
+step::10-update() {
+    svmkit::apt::update
+}
+`
+
+const aptRepositoryRemoveScript = `
+step::00-remove-source() {
+    svmkit::flock::start
+    svmkit::sudo rm -f "$APT_SOURCES_PATH" "$APT_KEYRING_PATH"
+    svmkit::flock::end
+}
+
+step::10-update() {
+    svmkit::apt::update
+}
+`
+
+type AptRepository struct{}
+
+type AptRepositoryArgs struct {
+	Connection    ssh.Connection       `pulumi:"connection"`
+	Name          string               `pulumi:"name"`
+	URIs          []string             `pulumi:"uris"`
+	Suites        []string             `pulumi:"suites"`
+	Components    []string             `pulumi:"components,optional"`
+	Architectures []string             `pulumi:"architectures,optional"`
+	Key           string               `pulumi:"key"`
+	Config        *svmkitRunner.Config `pulumi:"config,optional"`
+}
+
+func (r *AptRepositoryArgs) Annotate(a infer.Annotator) {
+	a.Describe(&r.Connection, "The connection to the host to add the repository to.")
+	a.Describe(&r.Name, "The name of the source and keyring files, without extension.")
+	a.Describe(&r.URIs, "The base URIs of the repository.")
+	a.Describe(&r.Suites, "The suites to use, e.g. bookworm. A suite ending in / is a flat repository path.")
+	a.Describe(&r.Components, "The components to use, e.g. main. Required unless the suite is a flat repository path.")
+	a.Describe(&r.Architectures, "Limit the repository to these architectures.")
+	a.Describe(&r.Key, "The ASCII armored public key the repository is signed with.")
+	a.Describe(&r.Config, "Runner configuration; its aptLockTimeout bounds the wait for the apt lock.")
+}
+
+type AptRepositoryState struct {
+	AptRepositoryArgs
+	SourcesPath string `pulumi:"sourcesPath"`
+	KeyringPath string `pulumi:"keyringPath"`
+}
+
+func (r *AptRepositoryState) Annotate(a infer.Annotator) {
+	a.Describe(&r.SourcesPath, "The path of the deb822 .sources file on the host.")
+	a.Describe(&r.KeyringPath, "The path of the keyring on the host.")
+}
+
+func (r *AptRepository) Annotate(a infer.Annotator) {
+	a.Describe(&r, "Add an apt repository and the key it's signed with to a remote host.")
+}
+
+// Validate ensures the AptRepositoryArgs are properly configured
+func (r *AptRepositoryArgs) Validate() error {
+	var errs []error
+
+	if !aptSourceNameRegexp.MatchString(r.Name) {
+		errs = append(errs, fmt.Errorf("'Name' may only contain letters, digits, '_', '.' and '-' (got %q)", r.Name))
+	}
+
+	if len(r.URIs) == 0 {
+		errs = append(errs, fmt.Errorf("at least one URI must be given"))
+	}
+
+	if len(r.Suites) == 0 {
+		errs = append(errs, fmt.Errorf("at least one suite must be given"))
+	}
+
+	for _, suite := range r.Suites {
+		flat := strings.HasSuffix(suite, "/")
+
+		if flat && len(r.Components) != 0 {
+			errs = append(errs, fmt.Errorf("components can't be given with the flat repository path %q", suite))
+		}
+
+		if !flat && len(r.Components) == 0 {
+			errs = append(errs, fmt.Errorf("at least one component must be given for suite %q", suite))
+		}
+	}
+
+	if !strings.Contains(r.Key, armoredKeyHeader) {
+		errs = append(errs, fmt.Errorf("'Key' must be an ASCII armored public key"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (r *AptRepositoryArgs) sourcesPath() string {
+	return path.Join(aptSourcesDir, r.Name+".sources")
+}
+
+// keyringPath is given the .asc extension so apt reads it as armored.
+func (r *AptRepositoryArgs) keyringPath() string {
+	return path.Join(aptKeyringsDir, r.Name+".asc")
+}
+
+// sources renders the repository as a deb822 .sources file.
+func (r *AptRepositoryArgs) sources() string {
+	var b strings.Builder
+
+	field := func(name string, values []string) {
+		if len(values) != 0 {
+			fmt.Fprintf(&b, "%s: %s\n", name, strings.Join(values, " "))
+		}
+	}
+
+	field("Types", []string{"deb"})
+	field("URIs", r.URIs)
+	field("Suites", r.Suites)
+	field("Components", r.Components)
+	field("Architectures", r.Architectures)
+	field("Signed-By", []string{r.keyringPath()})
+
+	return b.String()
+}
+
+func (r *AptRepositoryArgs) command(script string) *aptCommand {
+	return &aptCommand{
+		script: script,
+		env: map[string]string{
+			"APT_SOURCES_PATH": r.sourcesPath(),
+			"APT_KEYRING_PATH": r.keyringPath(),
+		},
+		config: r.Config,
+	}
+}
+
+func (r *AptRepositoryArgs) install(ctx context.Context) error {
+	cmd := r.command(aptRepositoryInstallScript)
+	cmd.files = []svmkitRunner.PayloadFile{
+		{Path: "repository.asc", Reader: strings.NewReader(r.Key), Mode: 0644},
+		{Path: "repository.sources", Reader: strings.NewReader(r.sources()), Mode: 0644},
+	}
+
+	return utils.RunnerHelper(ctx, utils.RunnerArgs{Connection: r.Connection}, cmd)
+}
+
+func (r *AptRepositoryArgs) remove(ctx context.Context) error {
+	return utils.RunnerHelper(ctx, utils.RunnerArgs{Connection: r.Connection}, r.command(aptRepositoryRemoveScript))
+}
+
+func newAptRepositoryState(args AptRepositoryArgs) AptRepositoryState {
+	return AptRepositoryState{
+		AptRepositoryArgs: args,
+		SourcesPath:       args.sourcesPath(),
+		KeyringPath:       args.keyringPath(),
+	}
+}
+
+func (AptRepository) Create(ctx context.Context, name string, input AptRepositoryArgs, preview bool) (string, AptRepositoryState, error) {
+	state := newAptRepositoryState(input)
+
+	if err := input.Validate(); err != nil {
+		return "", state, err
+	}
+
+	if preview {
+		return name, state, nil
+	}
+
+	if err := input.install(ctx); err != nil {
+		return "", state, err
+	}
+
+	return name, state, nil
+}
+
+func (AptRepository) Diff(ctx context.Context, id string, olds AptRepositoryState, news AptRepositoryArgs) (p.DiffResponse, error) {
+	diff := map[string]p.PropertyDiff{}
+
+	if olds.Name != news.Name {
+		diff["name"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+
+	if deref(olds.Connection.Host) != deref(news.Connection.Host) {
+		diff["connection"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	} else if !reflect.DeepEqual(olds.Connection, news.Connection) {
+		diff["connection"] = p.PropertyDiff{Kind: p.Update}
+	}
+
+	changed := func(key string, old, new []string) {
+		if !slices.Equal(old, new) {
+			diff[key] = p.PropertyDiff{Kind: p.Update}
+		}
+	}
+
+	changed("uris", olds.URIs, news.URIs)
+	changed("suites", olds.Suites, news.Suites)
+	changed("components", olds.Components, news.Components)
+	changed("architectures", olds.Architectures, news.Architectures)
+
+	if olds.Key != news.Key {
+		diff["key"] = p.PropertyDiff{Kind: p.Update}
+	}
+
+	if !reflect.DeepEqual(olds.Config, news.Config) {
+		diff["config"] = p.PropertyDiff{Kind: p.Update}
+	}
+
+	return p.DiffResponse{
+		HasChanges:   len(diff) > 0,
+		DetailedDiff: diff,
+	}, nil
+}
+
+func (AptRepository) Update(ctx context.Context, id string, olds AptRepositoryState, news AptRepositoryArgs, preview bool) (AptRepositoryState, error) {
+	state := newAptRepositoryState(news)
+
+	if err := news.Validate(); err != nil {
+		return state, err
+	}
+
+	if preview {
+		return state, nil
+	}
+
+	if err := news.install(ctx); err != nil {
+		return AptRepositoryState{}, err
+	}
+
+	return state, nil
+}
+
+func (AptRepository) Delete(ctx context.Context, id string, state AptRepositoryState) error {
+	return state.remove(ctx)
+}
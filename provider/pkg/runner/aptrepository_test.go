@@ -0,0 +1,97 @@
+package runner
+
+import (
+	"context"
+	"testing"
+
+	p "github.com/pulumi/pulumi-go-provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testArmoredKey = `-----BEGIN PGP PUBLIC KEY BLOCK-----
+
+mQINBGTestKeyData
+-----END PGP PUBLIC KEY BLOCK-----
+`
+
+func newAptRepositoryArgs() AptRepositoryArgs {
+	return AptRepositoryArgs{
+		Name:       "example",
+		URIs:       []string{"https://apt.example.com/debian"},
+		Suites:     []string{"bookworm"},
+		Components: []string{"main", "contrib"},
+		Key:        testArmoredKey,
+	}
+}
+
+func TestAptRepositorySources(t *testing.T) {
+	args := newAptRepositoryArgs()
+
+	assert.Equal(t, "/etc/apt/sources.list.d/example.sources", args.sourcesPath())
+	assert.Equal(t, "/etc/apt/keyrings/example.asc", args.keyringPath())
+
+	assert.Equal(t, `Types: deb
+URIs: https://apt.example.com/debian
+Suites: bookworm
+Components: main contrib
+Signed-By: /etc/apt/keyrings/example.asc
+`, args.sources())
+
+	args.Suites = []string{"./"}
+	args.Components = nil
+	args.Architectures = []string{"amd64", "arm64"}
+
+	assert.Equal(t, `Types: deb
+URIs: https://apt.example.com/debian
+Suites: ./
+Architectures: amd64 arm64
+Signed-By: /etc/apt/keyrings/example.asc
+`, args.sources())
+}
+
+func TestAptRepositoryValidate(t *testing.T) {
+	args := newAptRepositoryArgs()
+	assert.NoError(t, args.Validate())
+
+	args.Name = "../example"
+	assert.ErrorContains(t, args.Validate(), "'Name'")
+
+	args = newAptRepositoryArgs()
+	args.Components = nil
+	assert.ErrorContains(t, args.Validate(), "at least one component")
+
+	args.Suites = []string{"/"}
+	assert.NoError(t, args.Validate())
+
+	args.Components = []string{"main"}
+	assert.ErrorContains(t, args.Validate(), "flat repository")
+
+	args = newAptRepositoryArgs()
+	args.Key = "mQINBGTestKeyData"
+	assert.ErrorContains(t, args.Validate(), "ASCII armored")
+}
+
+func TestAptRepositoryDiff(t *testing.T) {
+	olds := newAptRepositoryState(newAptRepositoryArgs())
+
+	diff := func(news AptRepositoryArgs) p.DiffResponse {
+		resp, err := AptRepository{}.Diff(context.Background(), "id", olds, news)
+		require.NoError(t, err)
+		return resp
+	}
+
+	assert.False(t, diff(newAptRepositoryArgs()).HasChanges)
+
+	news := newAptRepositoryArgs()
+	news.Name = "other"
+	assert.Equal(t, p.UpdateReplace, diff(news).DetailedDiff["name"].Kind)
+
+	news = newAptRepositoryArgs()
+	news.Suites = []string{"trixie"}
+	assert.Equal(t, p.Update, diff(news).DetailedDiff["suites"].Kind)
+
+	news = newAptRepositoryArgs()
+	news.Key = testArmoredKey + "\n"
+	assert.Equal(t, p.Update, diff(news).DetailedDiff["key"].Kind)
+}
@@ -2,7 +2,14 @@ svmkit::sudo() {
     sudo "$@"
 }
 
-APT_LOCKFILE="/var/lib/dpkg/apt-svmkit.lock"
+# The svmkit lock serializes package manager runs between svmkit
+# scripts.  Hosts without dpkg keep it in a directory of its own.
+if [[ -d /var/lib/dpkg ]]; then
+    APT_LOCKFILE="/var/lib/dpkg/apt-svmkit.lock"
+else
+    APT_LOCKFILE="/var/lib/svmkit/svmkit.lock"
+    svmkit::sudo mkdir -p "$(dirname "$APT_LOCKFILE")"
+fi
 
 svmkit::sudo touch "$APT_LOCKFILE"
 svmkit::sudo chown "$(id -u):$(id -g)" "$APT_LOCKFILE"
@@ -70,6 +77,10 @@ svmkit::flock::run() {
 }
 
 svmkit::apt::get() {
+    # Local packages in the payload are installed from their repository,
+    # which has to be registered first.
+    svmkit::apt::local-repo::start
+
     log::info "Acquiring svmkit lock and running apt-get..."
 
     DEBIAN_FRONTEND=noninteractive svmkit::flock::run sudo -E apt-get -qy \
@@ -82,6 +93,160 @@ svmkit::apt::update() {
     svmkit::apt::get update
 }
 
+# svmkit::apt::local-repo::start registers the payload directory as a
+# trusted flat repository if SVMKIT_LOCAL_REPO_INDEX names its index, so
+# local packages are installed through apt and can depend on each other.
+# The variable is only set for package groups with local .debs, so other
+# files that happen to be called Packages are left alone.  The source
+# and its lists are removed again when the script exits.  It's run by
+# svmkit::apt::get, so scripts don't need to call it themselves.
+svmkit::apt::local-repo::start() {
+    [[ -v SVMKIT_LOCAL_REPO_INDEX ]] || return 0
+
+    if [[ ! -f $SVMKIT_LOCAL_REPO_INDEX ]]; then
+        log::error "local repository index $SVMKIT_LOCAL_REPO_INDEX is missing from the payload"
+        return 1
+    fi
+
+    if [[ -v SVMKIT_LOCAL_REPO_SOURCE ]]; then
+        return 0
+    fi
+
+    SVMKIT_LOCAL_REPO_DIR=$PWD
+    SVMKIT_LOCAL_REPO_SOURCE="/etc/apt/sources.list.d/svmkit-local-$(basename "$PWD").list"
+    exit::trigger svmkit::apt::local-repo::end
+
+    log::info "Registering local package repository $SVMKIT_LOCAL_REPO_DIR..."
+
+    echo "deb [trusted=yes] file:$SVMKIT_LOCAL_REPO_DIR ./" | svmkit::flock::run sudo tee "$SVMKIT_LOCAL_REPO_SOURCE" >/dev/null
+
+    # Only the local source is updated, and the lists of the others are
+    # left alone.
+    svmkit::apt::get update \
+        -o Dir::Etc::sourcelist="$SVMKIT_LOCAL_REPO_SOURCE" \
+        -o Dir::Etc::sourceparts=- \
+        -o APT::Get::List-Cleanup=0
+}
+
+svmkit::apt::local-repo::end() {
+    [[ -v SVMKIT_LOCAL_REPO_SOURCE ]] || return 0
+
+    # A failed step may have left the lock held.
+    svmkit::flock::cleanup
+
+    log::info "Removing local package repository $SVMKIT_LOCAL_REPO_DIR..."
+
+    svmkit::flock::run sudo sh -c 'rm -f "$1" /var/lib/apt/lists/*"$2"*' - "$SVMKIT_LOCAL_REPO_SOURCE" "$(basename "$SVMKIT_LOCAL_REPO_DIR")"
+    unset SVMKIT_LOCAL_REPO_SOURCE SVMKIT_LOCAL_REPO_DIR
+}
+
+svmkit::dnf::run() {
+    log::info "Acquiring svmkit lock and running dnf..."
+
+    svmkit::flock::run sudo dnf -y -q "$@"
+}
+
+svmkit::dnf::makecache() {
+    svmkit::dnf::run makecache
+}
+
+# svmkit::pkg::manager prints the host's package manager, apt or dnf,
+# from the ID and ID_LIKE fields of os-release, unless
+# SVMKIT_PACKAGE_MANAGER is already set.
+svmkit::pkg::manager() {
+    if [[ -n "${SVMKIT_PACKAGE_MANAGER:-}" ]]; then
+        echo "$SVMKIT_PACKAGE_MANAGER"
+        return 0
+    fi
+
+    local ids id
+
+    # opsh clears IFS, so the IDs are split explicitly.
+    # shellcheck disable=SC1091
+    IFS=' ' read -ra ids < <(. /etc/os-release && echo "${ID:-} ${ID_LIKE:-}")
+
+    for id in "${ids[@]}"; do
+        case "$id" in
+        debian | ubuntu)
+            echo apt
+            return 0
+            ;;
+        rhel | fedora | centos | rocky | almalinux | ol | amzn)
+            echo dnf
+            return 0
+            ;;
+        esac
+    done
+
+    log::error "No supported package manager for this host (os-release IDs: $(array::join " " "${ids[@]}"))"
+    return 1
+}
+
+svmkit::pkg::run() {
+    local action=$1
+    shift
+
+    case "$(svmkit::pkg::manager)" in
+    apt)
+        svmkit::apt::get "$action" "$@"
+        ;;
+    dnf)
+        svmkit::dnf::run "$action" "$@"
+        ;;
+    *)
+        return 1
+        ;;
+    esac
+}
+
+svmkit::pkg::install() {
+    svmkit::pkg::run install "$@"
+}
+
+svmkit::pkg::remove() {
+    svmkit::pkg::run remove "$@"
+}
+
+svmkit::pkg::update() {
+    case "$(svmkit::pkg::manager)" in
+    apt)
+        svmkit::apt::update
+        ;;
+    dnf)
+        svmkit::dnf::makecache
+        ;;
+    *)
+        return 1
+        ;;
+    esac
+}
+
+
+# svmkit::run-step runs a step's script, killing it if it runs for
+# longer than timeout seconds (0 for no limit).  Its start and end are
+# marked on stderr so the provider can report on each step.  Its name
+# mustn't contain "step::", or steps::run would run it as a step.
+svmkit::run-step() {
+    local name=$1 timeout=$2 script=$3 rc=0
+
+    echo "::svmkit-step:: start $name" >&2
+
+    # steps::run reads the step names from its stdin, so a step that
+    # reads stdin would swallow the rest of them.
+    if ((timeout > 0)); then
+        timeout -k 10 "$timeout" "$script" </dev/null || rc=$?
+    else
+        "$script" </dev/null || rc=$?
+    fi
+
+    echo "::svmkit-step:: end $name $rc" >&2
+
+    if ((timeout > 0 && rc == 124)); then
+        log::error "Step $name timed out after $timeout seconds"
+    fi
+
+    return "$rc"
+}
 
 cloud-init::wait-for-stable-environment() {
     local ret
@@ -4,6 +4,14 @@ PATH="$PWD:$PATH"
 
 source ./lib.bash
 source ./env
+
+# Secret variables arrive on stdin, so they're never written to disk.
+# Only the run wrapper sends them, so stdin is left alone otherwise.
+if [[ -v RUNNER_SECRET_STDIN ]]; then
+    unset RUNNER_SECRET_STDIN
+    eval "$(cat)"
+fi
+
 source ./steps.sh
 
 # shellcheck disable=SC1090
@@ -2,12 +2,49 @@ package runner
 
 import (
 	"github.com/abklabs/pulumi-runner/pkg/runner/core/deb"
+	"github.com/abklabs/pulumi-runner/pkg/runner/core/deployer"
 )
 
 type Config struct {
 	PackageConfig  *deb.PackageConfig `pulumi:"packageConfig,optional"`
 	AptLockTimeout *int               `pulumi:"aptLockTimeout,optional"`
 	KeepPayload    *bool              `pulumi:"keepPayload,optional"`
+
+	// OutputHeadLines and OutputTailLines are how many of the first
+	// and last lines of a command's output are kept in memory; the
+	// last are shown if it fails.
+	OutputHeadLines *int `pulumi:"outputHeadLines,optional"`
+	OutputTailLines *int `pulumi:"outputTailLines,optional"`
+
+	// LogDir is a local directory to write a log of each run to, kept
+	// for LogKeepCount runs or LogKeepDays days if either is set.
+	LogDir       *string  `pulumi:"logDir,optional"`
+	LogKeepCount *int     `pulumi:"logKeepCount,optional"`
+	LogKeepDays  *float64 `pulumi:"logKeepDays,optional"`
+
+	// EventSink is where to send a JSON event stream of each run: a
+	// file to append to, or "unix:/path" for a Unix socket.
+	EventSink *string `pulumi:"eventSink,optional"`
+}
+
+// OutputLimits returns how many of the first and last lines of output
+// to keep, for a nil Config too.
+func (c *Config) OutputLimits() (head int, tail int) {
+	head, tail = deployer.DefaultOutputHeadLines, deployer.DefaultOutputTailLines
+
+	if c == nil {
+		return
+	}
+
+	if c.OutputHeadLines != nil {
+		head = *c.OutputHeadLines
+	}
+
+	if c.OutputTailLines != nil {
+		tail = *c.OutputTailLines
+	}
+
+	return
 }
 
 func (c *Config) UpdatePackageGroup(grp *deb.PackageGroup) error {
@@ -17,3 +54,11 @@ func (c *Config) UpdatePackageGroup(grp *deb.PackageGroup) error {
 
 	return c.PackageConfig.UpdatePackageGroup(grp)
 }
+
+func (c *Config) UpdatePackageGroupChoices(grp *deb.PackageGroup) ([]deb.OverrideChoice, error) {
+	if c.PackageConfig == nil {
+		return nil, nil
+	}
+
+	return c.PackageConfig.UpdatePackageGroupChoices(grp)
+}
@@ -0,0 +1,174 @@
+package deb
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Relation is one clause of a version constraint, e.g. ">= 1.18".
+type Relation struct {
+	Op      string
+	Version Version
+}
+
+// Constraint is a set of relations a version must all satisfy, written
+// as e.g. ">= 1.18, < 2".
+//
+// The operators are =, >=, <=, >> and <<, as in Debian control files,
+// with > and < as aliases for >> and <<.  Unlike dpkg's deprecated
+// single character forms, > and < are strict.  A bare version is an
+// exact match.
+type Constraint []Relation
+
+// constraintOps is ordered so that two character operators are matched
+// before their one character prefixes.
+var constraintOps = []string{">=", "<=", ">>", "<<", "=", ">", "<"}
+
+// ParseConstraint parses a comma separated list of relations.
+func ParseConstraint(s string) (Constraint, error) {
+	var c Constraint
+
+	for _, clause := range strings.Split(s, ",") {
+		clause = strings.TrimSpace(clause)
+		if clause == "" {
+			return nil, fmt.Errorf("constraint %q has an empty clause", s)
+		}
+
+		op := "="
+		for _, candidate := range constraintOps {
+			if strings.HasPrefix(clause, candidate) {
+				op = candidate
+				clause = strings.TrimSpace(clause[len(candidate):])
+				break
+			}
+		}
+
+		switch op {
+		case ">":
+			op = ">>"
+		case "<":
+			op = "<<"
+		}
+
+		v, err := ParseVersion(clause)
+		if err != nil {
+			return nil, fmt.Errorf("invalid constraint %q: %w", s, err)
+		}
+
+		c = append(c, Relation{Op: op, Version: v})
+	}
+
+	return c, nil
+}
+
+// Allows reports whether v satisfies the relation.
+func (r Relation) Allows(v Version) bool {
+	c := v.Compare(r.Version)
+
+	switch r.Op {
+	case "=":
+		return c == 0
+	case ">=":
+		return c >= 0
+	case "<=":
+		return c <= 0
+	case ">>":
+		return c > 0
+	case "<<":
+		return c < 0
+	}
+
+	return false
+}
+
+func (r Relation) String() string {
+	return r.Op + " " + r.Version.String()
+}
+
+// Allows reports whether v satisfies every relation in the constraint.
+func (c Constraint) Allows(v Version) bool {
+	for _, r := range c {
+		if !r.Allows(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Constraint) String() string {
+	s := make([]string, len(c))
+	for i, r := range c {
+		s[i] = r.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+// Best returns the highest of the versions that satisfies the
+// constraint.  Versions that can't be parsed are ignored.
+func (c Constraint) Best(versions []string) (string, bool) {
+	var best *Version
+	var bestString string
+
+	for _, s := range versions {
+		v, err := ParseVersion(s)
+		if err != nil || !c.Allows(v) {
+			continue
+		}
+
+		if best == nil || v.Compare(*best) > 0 {
+			best, bestString = &v, s
+		}
+	}
+
+	return bestString, best != nil
+}
+
+// Available is a version of a package offered by the host's apt
+// sources, as listed by apt-cache madison.
+type Available struct {
+	Version string
+
+	// Source is the last column of the listing, e.g.
+	// "http://deb.debian.org/debian bookworm/main amd64 Packages".
+	Source string
+}
+
+// Release returns the suite the version is offered from, e.g. bookworm.
+func (a Available) Release() string {
+	fields := strings.Fields(a.Source)
+	if len(fields) < 2 {
+		return ""
+	}
+
+	release, _, _ := strings.Cut(fields[1], "/")
+	return release
+}
+
+// ParseMadison parses the output of apt-cache madison into the versions
+// available for each package.
+func ParseMadison(out []byte) (map[string][]Available, error) {
+	available := map[string][]Available{}
+
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		line := s.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		fields := strings.Split(line, "|")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid output from apt-cache madison (got %q)", line)
+		}
+
+		name := strings.TrimSpace(fields[0])
+		available[name] = append(available[name], Available{
+			Version: strings.TrimSpace(fields[1]),
+			Source:  strings.TrimSpace(fields[2]),
+		})
+	}
+
+	return available, s.Err()
+}
@@ -0,0 +1,101 @@
+package deb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConstraint(t *testing.T) {
+	c, err := ParseConstraint(">= 1.18, < 2")
+	require.NoError(t, err)
+	assert.Equal(t, Constraint{
+		{Op: ">=", Version: MustParseVersion("1.18")},
+		{Op: "<<", Version: MustParseVersion("2")},
+	}, c)
+	assert.Equal(t, ">= 1.18, << 2", c.String())
+
+	c, err = ParseConstraint("1.6-2.1")
+	require.NoError(t, err)
+	assert.Equal(t, Constraint{{Op: "=", Version: MustParseVersion("1.6-2.1")}}, c)
+
+	c, err = ParseConstraint(">>1:2.0,<=1:3.0~")
+	require.NoError(t, err)
+	assert.Equal(t, ">> 1:2.0, <= 1:3.0~", c.String())
+
+	for in, msg := range map[string]string{
+		"":           "empty clause",
+		">= 1.0,":    "empty clause",
+		">=":         "version string is empty",
+		"~>1.0":      "doesn't start with a digit",
+		">= 1.0 2.0": "embedded spaces",
+	} {
+		_, err := ParseConstraint(in)
+		assert.ErrorContains(t, err, msg, in)
+	}
+}
+
+func TestConstraintAllows(t *testing.T) {
+	tests := []struct {
+		constraint string
+		allowed    []string
+		denied     []string
+	}{
+		{">= 1.18, < 2", []string{"1.18", "1.18.1-1", "1.99", "2~rc1"}, []string{"1.17.9", "1.18~rc1", "2", "2.0-1", "1:1.0"}},
+		{"= 1.0-1", []string{"1.0-1", "0:1.0-01"}, []string{"1.0", "1.0-1+b1"}},
+		{"<= 1.0", []string{"1.0", "1.0~beta", "0.9"}, []string{"1.0-1", "1.0+dfsg"}},
+		{">> 1.0", []string{"1.0-1", "1.0.1", "1.0a"}, []string{"1.0", "1.0~rc1"}},
+		{"<< 2", []string{"1.9", "2~rc1"}, []string{"2", "2-0.1"}},
+	}
+
+	for _, tt := range tests {
+		c, err := ParseConstraint(tt.constraint)
+		require.NoError(t, err)
+
+		for _, v := range tt.allowed {
+			assert.True(t, c.Allows(MustParseVersion(v)), "%s allows %s", tt.constraint, v)
+		}
+
+		for _, v := range tt.denied {
+			assert.False(t, c.Allows(MustParseVersion(v)), "%s denies %s", tt.constraint, v)
+		}
+	}
+}
+
+func TestConstraintBest(t *testing.T) {
+	c, err := ParseConstraint(">= 1.18, < 2")
+	require.NoError(t, err)
+
+	best, ok := c.Best([]string{"1.17-1", "1.18.10-1", "1.18.9-3", "not a version", "2.0-1", "1.18.10-1~bpo12+1"})
+	assert.True(t, ok)
+	assert.Equal(t, "1.18.10-1", best)
+
+	_, ok = c.Best([]string{"1.17-1", "2.0-1"})
+	assert.False(t, ok)
+}
+
+func TestParseMadison(t *testing.T) {
+	out := "        jq | 1.7.1-3~bpo12+1 | http://deb.debian.org/debian bookworm-backports/main amd64 Packages\n" +
+		"        jq |    1.6-2.1 | http://deb.debian.org/debian bookworm/main amd64 Packages\n" +
+		"      curl | 7.88.1-10+deb12u5 | http://deb.debian.org/debian-security bookworm-security/main amd64 Packages\n"
+
+	available, err := ParseMadison([]byte(out))
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string][]Available{
+		"jq": {
+			{Version: "1.7.1-3~bpo12+1", Source: "http://deb.debian.org/debian bookworm-backports/main amd64 Packages"},
+			{Version: "1.6-2.1", Source: "http://deb.debian.org/debian bookworm/main amd64 Packages"},
+		},
+		"curl": {
+			{Version: "7.88.1-10+deb12u5", Source: "http://deb.debian.org/debian-security bookworm-security/main amd64 Packages"},
+		},
+	}, available)
+
+	assert.Equal(t, "bookworm-backports", available["jq"][0].Release())
+	assert.Equal(t, "", Available{}.Release())
+
+	_, err = ParseMadison([]byte("jq 1.6-2.1\n"))
+	assert.ErrorContains(t, err, "invalid output from apt-cache madison")
+}
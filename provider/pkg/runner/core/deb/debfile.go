@@ -0,0 +1,247 @@
+package deb
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+const (
+	arMagic      = "!<arch>\n"
+	arHeaderSize = 60
+
+	// Control files are small; anything bigger isn't one.
+	maxControlSize = 1 << 20
+)
+
+// Control holds the fields of a binary package's control file that
+// identify it.
+type Control struct {
+	Package      string
+	Version      string
+	Architecture string
+}
+
+// Arg returns the package as an apt-get argument selecting exactly this
+// build.  Architecture independent packages aren't qualified, since
+// they're installed under the native architecture.
+func (c Control) Arg() string {
+	name := c.Package
+	if c.Architecture != "" && c.Architecture != "all" {
+		name += ":" + c.Architecture
+	}
+
+	return name + "=" + c.Version
+}
+
+// ReadControlFile reads the control fields of the .deb at path.
+func ReadControlFile(path string) (Control, error) {
+	data, err := ReadControlDataFile(path)
+	if err != nil {
+		return Control{}, err
+	}
+
+	c, err := ParseControl(data)
+	if err != nil {
+		return c, fmt.Errorf("%q: %w", path, err)
+	}
+
+	return c, nil
+}
+
+// ReadControlDataFile returns the control file of the .deb at path.
+func ReadControlDataFile(path string) (data []byte, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err = errors.Join(err, f.Close())
+	}()
+
+	data, err = ReadControlData(f)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %w", path, err)
+	}
+
+	return data, nil
+}
+
+// ReadControl reads the control fields of a .deb.
+func ReadControl(r io.Reader) (Control, error) {
+	data, err := ReadControlData(r)
+	if err != nil {
+		return Control{}, err
+	}
+
+	return ParseControl(data)
+}
+
+// ReadControlData returns the control file of a .deb, which is an ar
+// archive holding a control.tar, optionally compressed.
+func ReadControlData(r io.Reader) ([]byte, error) {
+	br := bufio.NewReader(r)
+
+	magic := make([]byte, len(arMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != arMagic {
+		return nil, fmt.Errorf("not a debian package: missing ar header")
+	}
+
+	header := make([]byte, arHeaderSize)
+
+	for {
+		if _, err := io.ReadFull(br, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("not a debian package: no control archive")
+			}
+			return nil, fmt.Errorf("failed to read ar member header: %w", err)
+		}
+
+		if string(header[58:60]) != "`\n" {
+			return nil, fmt.Errorf("not a debian package: corrupt ar member header")
+		}
+
+		// GNU ar terminates names with a slash.
+		name := strings.TrimSuffix(strings.TrimSpace(string(header[0:16])), "/")
+
+		size, err := strconv.ParseInt(strings.TrimSpace(string(header[48:58])), 10, 64)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("not a debian package: invalid size for ar member %q", name)
+		}
+
+		member := io.LimitReader(br, size)
+
+		if strings.HasPrefix(name, "control.tar") {
+			data, err := decompress(name, member)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decompress %s: %w", name, err)
+			}
+
+			// The zstd decoder runs goroutines until it's closed.
+			defer data.Close()
+
+			return readControlTar(data)
+		}
+
+		// Members are padded to an even size.
+		if _, err := io.CopyN(io.Discard, br, size+size%2); err != nil {
+			return nil, fmt.Errorf("failed to skip ar member %q: %w", name, err)
+		}
+	}
+}
+
+func decompress(name string, r io.Reader) (io.ReadCloser, error) {
+	switch strings.TrimPrefix(name, "control.tar") {
+	case "":
+		return io.NopCloser(r), nil
+	case ".gz":
+		return gzip.NewReader(r)
+	case ".xz":
+		xr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(xr), nil
+	case ".zst":
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression")
+	}
+}
+
+func readControlTar(r io.Reader) ([]byte, error) {
+	tr := tar.NewReader(r)
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("control archive has no control file")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read control archive: %w", err)
+		}
+
+		if strings.TrimPrefix(hdr.Name, "./") != "control" {
+			continue
+		}
+
+		data, err := io.ReadAll(io.LimitReader(tr, maxControlSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read control file: %w", err)
+		}
+
+		if len(data) > maxControlSize {
+			return nil, fmt.Errorf("control file is too large")
+		}
+
+		return data, nil
+	}
+}
+
+// ParseControl parses the fields identifying a package out of a control
+// file.  Package, Version and Architecture must all be present.
+func ParseControl(data []byte) (Control, error) {
+	var c Control
+
+	fields := map[string]*string{
+		"package":      &c.Package,
+		"version":      &c.Version,
+		"architecture": &c.Architecture,
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		line := s.Text()
+
+		// Continuation lines of multi-line fields such as Description.
+		if line == "" || line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return c, fmt.Errorf("invalid control file line %q", line)
+		}
+
+		if field, ok := fields[strings.ToLower(key)]; ok {
+			*field = strings.TrimSpace(value)
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return c, err
+	}
+
+	var missing []string
+
+	for _, name := range []string{"Package", "Version", "Architecture"} {
+		if *fields[strings.ToLower(name)] == "" {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) != 0 {
+		return c, fmt.Errorf("control file is missing %s", strings.Join(missing, ", "))
+	}
+
+	if _, err := ParseVersion(c.Version); err != nil {
+		return c, err
+	}
+
+	return c, nil
+}
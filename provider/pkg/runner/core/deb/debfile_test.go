@@ -0,0 +1,148 @@
+package deb
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ulikunitz/xz"
+)
+
+// buildDeb builds a minimal .deb with the given control file, its
+// control archive compressed with ext (.gz, .xz, .zst or none).
+func buildDeb(t *testing.T, control, ext string) []byte {
+	t.Helper()
+
+	return buildDebWithMD5Sums(t, control, nil, ext)
+}
+
+// buildDebWithMD5Sums is buildDeb with an md5sums file after the control
+// file, if md5sums isn't nil.
+func buildDebWithMD5Sums(t *testing.T, control string, md5sums []byte, ext string) []byte {
+	t.Helper()
+
+	var tarball bytes.Buffer
+	tw := tar.NewWriter(&tarball)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0755}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "./control", Mode: 0644, Size: int64(len(control))}))
+	_, err := tw.Write([]byte(control))
+	require.NoError(t, err)
+	if md5sums != nil {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: "./md5sums", Mode: 0644, Size: int64(len(md5sums))}))
+		_, err = tw.Write(md5sums)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+
+	var compressed bytes.Buffer
+	var w io.WriteCloser
+
+	switch ext {
+	case "":
+		w = nopWriteCloser{&compressed}
+	case ".gz":
+		w = gzip.NewWriter(&compressed)
+	case ".xz":
+		w, err = xz.NewWriter(&compressed)
+		require.NoError(t, err)
+	case ".zst":
+		w, err = zstd.NewWriter(&compressed)
+		require.NoError(t, err)
+	default:
+		t.Fatalf("unknown compression %q", ext)
+	}
+
+	_, err = io.Copy(w, &tarball)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	var ar bytes.Buffer
+	ar.WriteString(arMagic)
+
+	member := func(name string, data []byte) {
+		fmt.Fprintf(&ar, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", name, 0, 0, 0, "100644", len(data))
+		ar.Write(data)
+		if len(data)%2 == 1 {
+			ar.WriteByte('\n')
+		}
+	}
+
+	member("debian-binary", []byte("2.0\n"))
+	member("control.tar"+ext, compressed.Bytes())
+	member("data.tar", nil)
+
+	return ar.Bytes()
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func controlFile(name, version, arch string) string {
+	return fmt.Sprintf("Package: %s\nVersion: %s\nArchitecture: %s\nMaintainer: Nobody <nobody@example.com>\nDescription: test\n a package for testing\n .\n Package: notthis\n", name, version, arch)
+}
+
+func TestReadControl(t *testing.T) {
+	for _, ext := range []string{"", ".gz", ".xz", ".zst"} {
+		t.Run("control.tar"+ext, func(t *testing.T) {
+			data := buildDeb(t, controlFile("testpkg", "1:2.0-1", "amd64"), ext)
+
+			c, err := ReadControl(bytes.NewReader(data))
+			require.NoError(t, err)
+			assert.Equal(t, Control{Package: "testpkg", Version: "1:2.0-1", Architecture: "amd64"}, c)
+		})
+	}
+}
+
+func TestReadControlClosesDecoder(t *testing.T) {
+	// The decoder only stops by itself at the end of the stream, which
+	// isn't read once the control file's found.
+	md5sums := make([]byte, 16<<20)
+	_, err := rand.Read(md5sums)
+	require.NoError(t, err)
+
+	data := buildDebWithMD5Sums(t, controlFile("testpkg", "1.0", "amd64"), md5sums, ".zst")
+
+	// With a single CPU the decoder doesn't use goroutines at all.
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	before := runtime.NumGoroutine()
+
+	for range 20 {
+		_, err := ReadControl(bytes.NewReader(data))
+		require.NoError(t, err)
+	}
+
+	// Closed decoders' goroutines may take a moment to exit.
+	for range 100 {
+		if runtime.NumGoroutine() <= before {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before)
+}
+
+func TestReadControlErrors(t *testing.T) {
+	_, err := ReadControl(bytes.NewReader(nil))
+	assert.ErrorContains(t, err, "missing ar header")
+
+	_, err = ReadControl(bytes.NewReader([]byte(arMagic)))
+	assert.ErrorContains(t, err, "no control archive")
+
+	_, err = ReadControl(bytes.NewReader(buildDeb(t, "Package: testpkg\nVersion: 1.0\n", ".gz")))
+	assert.ErrorContains(t, err, "missing Architecture")
+
+	_, err = ReadControl(bytes.NewReader(buildDeb(t, controlFile("testpkg", "one", "all"), ".gz")))
+	assert.ErrorContains(t, err, "doesn't start with a digit")
+}
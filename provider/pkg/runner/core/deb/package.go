@@ -1,10 +1,12 @@
 package deb
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/abklabs/pulumi-runner/pkg/runner/core/payload"
 )
@@ -14,8 +16,59 @@ type Package struct {
 	Version       *string `pulumi:"version,optional"`
 	TargetRelease *string `pulumi:"targetRelease,optional"`
 	LocalPath     *string `pulumi:"path,optional"`
+
+	// Constraint is resolved to the highest version available on the
+	// host that satisfies it, e.g. ">= 1.18, < 2".
+	Constraint *string `pulumi:"constraint,optional"`
+}
+
+// Validate checks that the package's constraint parses, and isn't given
+// along with an exact version.
+func (p *Package) Validate() error {
+	if p.Constraint == nil {
+		return nil
+	}
+
+	if p.Version != nil {
+		return fmt.Errorf("package %q can't have both a version and a constraint", p.Name)
+	}
+
+	if _, err := ParseConstraint(*p.Constraint); err != nil {
+		return fmt.Errorf("package %q: %w", p.Name, err)
+	}
+
+	return nil
+}
+
+// needsResolving reports whether the package has a constraint that
+// hasn't been resolved to a version yet.
+func (p *Package) needsResolving() bool {
+	return p.Constraint != nil && p.Version == nil && p.LocalPath == nil
+}
+
+// Satisfied reports whether an installed version still meets the
+// package's version or constraint.  Local packages always do.
+func (p *Package) Satisfied(version string) bool {
+	switch {
+	case p.LocalPath != nil:
+		return true
+	case p.Version != nil:
+		return *p.Version == version
+	case p.Constraint != nil:
+		c, err := ParseConstraint(*p.Constraint)
+		if err != nil {
+			return false
+		}
+
+		v, err := ParseVersion(version)
+		return err == nil && c.Allows(v)
+	}
+
+	return true
 }
 
+// String returns the package as an apt-get argument.  It ignores any
+// constraint, which has to be resolved into Version first.
 func (p *Package) String() string {
 	if p.LocalPath != nil {
 		// XXX - We need to be explicit about this leading
@@ -63,11 +116,36 @@ func (p Package) MakePackageGroup(names ...string) *PackageGroup {
 type PackageGroup struct {
 	locations map[string]int
 	packages  []Package
+
+	// localControls is the control file of each local .deb, by path.
+	localControls map[string]Control
 }
 
+// Args returns the packages as apt-get arguments.  Local .debs are
+// named by the package, architecture and version in their control files,
+// as they're installed from the repository that AddToPayload puts
+// alongside them.
 func (p *PackageGroup) Args() []string {
 	ret := make([]string, len(p.packages))
 
+	for i, v := range p.packages {
+		if control, ok := p.localControl(v); ok {
+			ret[i] = control.Arg()
+			continue
+		}
+
+		ret[i] = v.String()
+	}
+
+	return ret
+}
+
+// PathArgs returns the packages as apt-get arguments, with local
+// packages named by their path in the payload, for callers that don't
+// install from the repository.
+func (p *PackageGroup) PathArgs() []string {
+	ret := make([]string, len(p.packages))
+
 	for i, v := range p.packages {
 		ret[i] = v.String()
 	}
@@ -75,6 +153,17 @@ func (p *PackageGroup) Args() []string {
 	return ret
 }
 
+// ResolvedArgs is like Args, but fails if any constraints are still
+// unresolved.  A constraint isn't something apt understands, so Args
+// would otherwise leave apt to install whatever version it picks.
+func (p *PackageGroup) ResolvedArgs() ([]string, error) {
+	if names := p.Constrained(); len(names) != 0 {
+		return nil, fmt.Errorf("the constraints on %s haven't been resolved to versions", strings.Join(names, ", "))
+	}
+
+	return p.Args(), nil
+}
+
 func (p *PackageGroup) Add(rest ...Package) {
 	for _, v := range rest {
 		if pos, ok := p.locations[v.Name]; ok {
@@ -86,12 +175,101 @@ func (p *PackageGroup) Add(rest ...Package) {
 	}
 }
 
+// Packages returns the packages in the group, in the order they were
+// first added.
+func (p *PackageGroup) Packages() []Package {
+	return append([]Package{}, p.packages...)
+}
+
+// Names returns the names of the packages in the group.
+func (p *PackageGroup) Names() []string {
+	ret := make([]string, len(p.packages))
+
+	for i, v := range p.packages {
+		ret[i] = v.Name
+	}
+
+	return ret
+}
+
+// Constrained returns the names of the packages whose constraints still
+// need resolving.
+func (p *PackageGroup) Constrained() []string {
+	var ret []string
+
+	for _, v := range p.packages {
+		if v.needsResolving() {
+			ret = append(ret, v.Name)
+		}
+	}
+
+	return ret
+}
+
+// Resolve sets the version of each package with a constraint to the
+// highest available version satisfying it, only considering versions
+// from the package's target release if it has one.  The available
+// versions are keyed by package name without any architecture.  It
+// returns the versions chosen.
+func (p *PackageGroup) Resolve(available map[string][]Available) (map[string]string, error) {
+	resolved := map[string]string{}
+
+	for i := range p.packages {
+		pkg := &p.packages[i]
+		if !pkg.needsResolving() {
+			continue
+		}
+
+		c, err := ParseConstraint(*pkg.Constraint)
+		if err != nil {
+			return nil, fmt.Errorf("package %q: %w", pkg.Name, err)
+		}
+
+		name, _, _ := strings.Cut(pkg.Name, ":")
+
+		var versions []string
+		for _, a := range available[name] {
+			if pkg.TargetRelease == nil || a.Release() == *pkg.TargetRelease {
+				versions = append(versions, a.Version)
+			}
+		}
+
+		version, ok := c.Best(versions)
+		if !ok {
+			if len(versions) == 0 {
+				return nil, fmt.Errorf("no versions of %q are available to satisfy %q", pkg.Name, c)
+			}
+			return nil, fmt.Errorf("none of the available versions of %q satisfy %q (available: %s)", pkg.Name, c, strings.Join(versions, ", "))
+		}
+
+		pkg.Version = &version
+		resolved[pkg.Name] = version
+	}
+
+	return resolved, nil
+}
+
 func (p *PackageGroup) IsIncluded(name string) bool {
 	_, ok := p.locations[name]
 	return ok
 }
 
-func (p *PackageGroup) AddToPayload(payload *payload.Payload) error {
+// AddToPayload adds the local packages to the payload, along with the
+// index of a flat repository of the local .debs, if there are any.
+func (p *PackageGroup) AddToPayload(pl *payload.Payload) error {
+	repo, err := p.LocalRepository()
+	if err != nil {
+		return err
+	}
+
+	if repo != nil {
+		pl.Add(payload.PayloadFile{
+			Path:   LocalRepositoryIndex,
+			Reader: bytes.NewReader(repo.Index),
+			Mode:   0644,
+		})
+	}
+
 	for _, pkg := range p.packages {
 		if pkg.LocalPath == nil {
 			continue
@@ -105,7 +283,7 @@ func (p *PackageGroup) AddToPayload(payload *payload.Payload) error {
 
 		// Don't use pkg.String here; that might end
 		// up having additional flags attached to it.
-		payload.AddReader(filepath.Base(*pkg.LocalPath), r)
+		pl.AddReader(filepath.Base(*pkg.LocalPath), r)
 	}
 
 	return nil
@@ -113,7 +291,8 @@ func (p *PackageGroup) AddToPayload(payload *payload.Payload) error {
 
 func NewPackageGroup(rest ...Package) *PackageGroup {
 	g := &PackageGroup{
-		locations: make(map[string]int),
+		locations:     make(map[string]int),
+		localControls: make(map[string]Control),
 	}
 
 	g.Add(rest...)
@@ -4,6 +4,7 @@ import (
 	"io"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"testing"
 
 	"github.com/abklabs/pulumi-runner/pkg/runner/core/payload"
@@ -75,3 +76,79 @@ func TestPackageGroupLocalPath0(t *testing.T) {
 		assert.Equal(t, "This is not a package, but it's some data.\n", string(b))
 	}
 }
+
+func TestPackageGroupNames(t *testing.T) {
+	g := Package{}.MakePackageGroup("testpkg1", "testpkg2")
+
+	g.Add(Package{Name: "testpkg1", Version: ptr("1.0")})
+
+	assert.Equal(t, []string{"testpkg1", "testpkg2"}, g.Names())
+
+	pkgs := g.Packages()
+	assert.Equal(t, ptr("1.0"), pkgs[0].Version)
+
+	// The returned packages are a copy.
+	pkgs[0].Name = "changed"
+	assert.Equal(t, []string{"testpkg1", "testpkg2"}, g.Names())
+}
+
+func TestPackageValidate(t *testing.T) {
+	assert.NoError(t, (&Package{Name: "jq"}).Validate())
+	assert.NoError(t, (&Package{Name: "jq", Constraint: ptr(">= 1.6, < 2")}).Validate())
+	assert.ErrorContains(t, (&Package{Name: "jq", Constraint: ptr(">= x")}).Validate(), `package "jq": invalid constraint`)
+	assert.ErrorContains(t, (&Package{Name: "jq", Version: ptr("1.6"), Constraint: ptr(">= 1.6")}).Validate(), "both a version and a constraint")
+}
+
+func TestPackageSatisfied(t *testing.T) {
+	assert.True(t, (&Package{Name: "jq"}).Satisfied("1.6-2.1"))
+	assert.True(t, (&Package{Name: "jq", Version: ptr("1.6-2.1")}).Satisfied("1.6-2.1"))
+	assert.False(t, (&Package{Name: "jq", Version: ptr("1.6-2.1")}).Satisfied("1.7.1-3"))
+	assert.True(t, (&Package{Name: "jq", Constraint: ptr(">= 1.6, < 2")}).Satisfied("1.7.1-3"))
+	assert.False(t, (&Package{Name: "jq", Constraint: ptr(">= 1.6, < 1.7")}).Satisfied("1.7.1-3"))
+	assert.True(t, (&Package{Name: "jq", Version: ptr("9"), LocalPath: ptr("./jq.deb")}).Satisfied("1.6"))
+}
+
+func TestPackageGroupResolve(t *testing.T) {
+	g := NewPackageGroup(
+		Package{Name: "jq", Constraint: ptr(">= 1.6, < 2")},
+		Package{Name: "curl:amd64", Constraint: ptr(">= 7"), TargetRelease: ptr("bookworm")},
+		Package{Name: "pinned", Version: ptr("1.0")},
+		Package{Name: "plain"},
+	)
+
+	assert.Equal(t, []string{"jq", "curl:amd64"}, g.Constrained())
+
+	_, err := g.ResolvedArgs()
+	assert.ErrorContains(t, err, "the constraints on jq, curl:amd64 haven't been resolved to versions")
+
+	available := map[string][]Available{
+		"jq": {
+			{Version: "2.0-1", Source: "http://example.com/debian trixie/main amd64 Packages"},
+			{Version: "1.7.1-3", Source: "http://example.com/debian bookworm-backports/main amd64 Packages"},
+			{Version: "1.6-2.1", Source: "http://example.com/debian bookworm/main amd64 Packages"},
+		},
+		"curl": {
+			{Version: "8.11.1-1", Source: "http://example.com/debian trixie/main amd64 Packages"},
+			{Version: "7.88.1-10+deb12u5", Source: "http://example.com/debian bookworm/main amd64 Packages"},
+		},
+	}
+
+	resolved, err := g.Resolve(available)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{"jq": "1.7.1-3", "curl:amd64": "7.88.1-10+deb12u5"}, resolved)
+	assert.Equal(t, []string{"jq=1.7.1-3", "curl:amd64=7.88.1-10+deb12u5", "pinned=1.0", "plain"}, g.Args())
+	assert.Empty(t, g.Constrained())
+
+	args, err := g.ResolvedArgs()
+	require.NoError(t, err)
+	assert.Equal(t, g.Args(), args)
+
+	g = NewPackageGroup(Package{Name: "jq", Constraint: ptr(">= 2.1")})
+	_, err = g.Resolve(available)
+	assert.ErrorContains(t, err, `none of the available versions of "jq" satisfy ">= 2.1" (available: 2.0-1, 1.7.1-3, 1.6-2.1)`)
+
+	g = NewPackageGroup(Package{Name: "missing", Constraint: ptr(">= 1")})
+	_, err = g.Resolve(available)
+	assert.ErrorContains(t, err, `no versions of "missing" are available`)
+}
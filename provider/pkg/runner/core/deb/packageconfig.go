@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
@@ -11,9 +12,25 @@ type PackageConfig struct {
 	OverrideDir *string    `pulumi:"overrideDir,optional"`
 	Override    *[]Package `pulumi:"override,optional"`
 	Additional  *[]string  `pulumi:"additional,optional"`
+
+	// Pin writes apt preferences for packages with a version or
+	// target release, so upgrades don't move them.
+	Pin *bool `pulumi:"pin,optional"`
+
+	// Hold marks packages with a version as held with apt-mark.
+	Hold *bool `pulumi:"hold,optional"`
 }
 
 func (p *PackageConfig) UpdatePackageGroup(g *PackageGroup) error {
+	_, err := p.UpdatePackageGroupChoices(g)
+	return err
+}
+
+// UpdatePackageGroupChoices is like UpdatePackageGroup, but also reports
+// which of the packages in OverrideDir were chosen for the group.
+func (p *PackageConfig) UpdatePackageGroupChoices(g *PackageGroup) ([]OverrideChoice, error) {
+	var choices []OverrideChoice
+
 	if p.Additional != nil {
 		g.Add(Package{}.MakePackages(*p.Additional...)...)
 	}
@@ -21,17 +38,24 @@ func (p *PackageConfig) UpdatePackageGroup(g *PackageGroup) error {
 	if p.OverrideDir != nil {
 		localDebs, err := getOverrideDirPackages(*p.OverrideDir)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		overrides := make([]Package, 0, len(g.packages))
 		for _, pkg := range g.packages {
-			if localDeb, ok := localDebs[pkg.Name]; ok {
-				overrides = append(overrides, Package{
-					Name:      pkg.Name,
-					LocalPath: &localDeb,
-				})
+			choice, ok, err := localDebs.choose(pkg.Name)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
 			}
+
+			overrides = append(overrides, Package{
+				Name:      pkg.Name,
+				LocalPath: &choice.Path,
+			})
+			choices = append(choices, choice)
 		}
 		g.Add(overrides...)
 	}
@@ -46,18 +70,84 @@ func (p *PackageConfig) UpdatePackageGroup(g *PackageGroup) error {
 		}
 
 		if len(unknownPackages) != 0 {
-			return fmt.Errorf("overrides provided for unknown package(s): %s", strings.Join(unknownPackages, ", "))
+			return nil, fmt.Errorf("overrides provided for unknown package(s): %s", strings.Join(unknownPackages, ", "))
 		}
 
 		g.Add(*p.Override...)
 	}
 
-	return nil
+	return choices, nil
+}
+
+// LocalDeb is a package file in the override directory.
+type LocalDeb struct {
+	Control
+	Path string
+}
+
+// OverrideChoice is the package file chosen from the override directory
+// for a package, along with any older versions of it that were passed
+// over.
+type OverrideChoice struct {
+	LocalDeb
+	Skipped []LocalDeb
+}
+
+func (c OverrideChoice) String() string {
+	s := fmt.Sprintf("%s %s (%s) from %s", c.Package, c.Version, c.Architecture, filepath.Base(c.Path))
+
+	if len(c.Skipped) != 0 {
+		skipped := make([]string, len(c.Skipped))
+		for i, v := range c.Skipped {
+			skipped[i] = v.Version
+		}
+		s += ", over " + strings.Join(skipped, ", ")
+	}
+
+	return s
 }
 
-// Assume unique packages in the override dir. Multiple package
-// versions will result in an error
-func getOverrideDirPackages(dir string) (map[string]string, error) {
+// overrideDirPackages holds the newest version of each package in the
+// override directory, by name and then architecture.
+type overrideDirPackages map[string]map[string]OverrideChoice
+
+// choose returns the package file for a package in the group, which may
+// be qualified with an architecture as name:arch.  An unqualified name
+// matching files for more than one architecture is ambiguous.
+func (o overrideDirPackages) choose(name string) (OverrideChoice, bool, error) {
+	name, arch, qualified := strings.Cut(name, ":")
+
+	byArch, ok := o[name]
+	if !ok {
+		return OverrideChoice{}, false, nil
+	}
+
+	if qualified {
+		choice, ok := byArch[arch]
+		return choice, ok, nil
+	}
+
+	if len(byArch) > 1 {
+		archs := make([]string, 0, len(byArch))
+		for a := range byArch {
+			archs = append(archs, a)
+		}
+		sort.Strings(archs)
+
+		return OverrideChoice{}, false, fmt.Errorf("override directory has %q for architectures %s; qualify the package as %s:<arch>", name, strings.Join(archs, ", "), name)
+	}
+
+	for _, choice := range byArch {
+		return choice, true, nil
+	}
+
+	return OverrideChoice{}, false, nil
+}
+
+// getOverrideDirPackages reads the control file of every package in the
+// override directory, and keeps the highest version of each package per
+// architecture.
+func getOverrideDirPackages(dir string) (overrideDirPackages, error) {
 	info, err := os.Stat(dir)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -73,19 +163,44 @@ func getOverrideDirPackages(dir string) (map[string]string, error) {
 	if err != nil {
 		return nil, err
 	}
-	localDebs := make(map[string]string, len(files))
+
+	localDebs := overrideDirPackages{}
 	for _, p := range files {
-		base := filepath.Base(p)
-		parts := strings.Split(base, "_")
-		if len(parts) < 3 {
-			return nil, fmt.Errorf("%q invalid debian package name", base)
+		control, err := ReadControlFile(p)
+		if err != nil {
+			return nil, err
 		}
-		name := strings.Join(parts[:len(parts)-2], "_")
-		if _, ok := localDebs[name]; ok {
-			return nil, fmt.Errorf("%q duplicate package name", base)
-		} else {
-			localDebs[name] = p
+
+		local := LocalDeb{Control: control, Path: p}
+
+		byArch, ok := localDebs[local.Package]
+		if !ok {
+			byArch = map[string]OverrideChoice{}
+			localDebs[local.Package] = byArch
+		}
+
+		current, ok := byArch[local.Architecture]
+		if !ok {
+			byArch[local.Architecture] = OverrideChoice{LocalDeb: local}
+			continue
+		}
+
+		c, err := CompareVersions(local.Version, current.Version)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compare %q with %q: %w", filepath.Base(p), filepath.Base(current.Path), err)
 		}
+
+		switch c {
+		case 0:
+			return nil, fmt.Errorf("%q and %q both contain %s %s (%s)", filepath.Base(current.Path), filepath.Base(p), local.Package, local.Version, local.Architecture)
+		case 1:
+			current.Skipped = append(current.Skipped, current.LocalDeb)
+			current.LocalDeb = local
+		default:
+			current.Skipped = append(current.Skipped, local)
+		}
+
+		byArch[local.Architecture] = current
 	}
 	return localDebs, nil
 }
@@ -108,19 +108,19 @@ func TestPackageConfigBadOverrideDir(t *testing.T) {
 	}
 }
 
-func mkdeb(t *testing.T, dir, fname string) string {
+func mkdeb(t *testing.T, dir, fname, name, version, arch string) string {
 	t.Helper()
 	path := filepath.Join(dir, fname)
-	require.NoError(t, os.WriteFile(path, nil, 0644))
+	require.NoError(t, os.WriteFile(path, buildDeb(t, controlFile(name, version, arch), ".xz"), 0644))
 	return path
 }
 
 func TestPackageConfigOverrideDir(t *testing.T) {
 	overrideDir := t.TempDir()
 
-	mkdeb(t, overrideDir, "testpkg_0.0.0-1_amd64.deb")
-	mkdeb(t, overrideDir, "anotherpkg_3.2.1-1_amd64.deb")
-	mkdeb(t, overrideDir, "randompkg_0.0.0-0_amd64.deb")
+	mkdeb(t, overrideDir, "testpkg_0.0.0-1_amd64.deb", "testpkg", "0.0.0-1", "amd64")
+	mkdeb(t, overrideDir, "anotherpkg_3.2.1-1_amd64.deb", "anotherpkg", "3.2.1-1", "amd64")
+	mkdeb(t, overrideDir, "randompkg_0.0.0-0_amd64.deb", "randompkg", "0.0.0-0", "amd64")
 
 	g := Package{}.MakePackageGroup("testpkg", "anotherpkg")
 
@@ -138,19 +138,60 @@ func TestPackageConfigOverrideDir(t *testing.T) {
 		}
 
 		assert.NoError(t, c.UpdatePackageGroup(g))
-		assert.Equal(t, []string{"testpkg=1.2.3", "./anotherpkg_3.2.1-1_amd64.deb"}, g.Args())
+		assert.Equal(t, []string{"testpkg=1.2.3", "anotherpkg:amd64=3.2.1-1"}, g.Args())
 	}
 
 	{
-		duplicate := mkdeb(t, overrideDir, "testpkg_3.2.1-2_amd64.deb")
+		duplicate := mkdeb(t, overrideDir, "testpkg-copy.deb", "testpkg", "0.0.0-1", "amd64")
 		c := PackageConfig{
 			OverrideDir: &overrideDir,
 		}
 
-		assert.ErrorContains(t, c.UpdatePackageGroup(g), "duplicate package name")
+		assert.ErrorContains(t, c.UpdatePackageGroup(g), "both contain testpkg 0.0.0-1 (amd64)")
 		require.NoError(t, os.Remove(duplicate))
 
-		mkdeb(t, overrideDir, "bad-deb-format.deb")
-		assert.ErrorContains(t, c.UpdatePackageGroup(g), "invalid debian package name")
+		bad := filepath.Join(overrideDir, "bad-deb-format.deb")
+		require.NoError(t, os.WriteFile(bad, nil, 0644))
+		assert.ErrorContains(t, c.UpdatePackageGroup(g), "not a debian package")
+		require.NoError(t, os.Remove(bad))
 	}
 }
+
+func TestPackageConfigOverrideDirVersions(t *testing.T) {
+	overrideDir := t.TempDir()
+
+	// The file names are deliberately misleading; only the control file
+	// counts.
+	mkdeb(t, overrideDir, "testpkg_9.9_amd64.deb", "testpkg", "1.0~rc1-1", "amd64")
+	newest := mkdeb(t, overrideDir, "testpkg.deb", "testpkg", "1.0-1", "amd64")
+	mkdeb(t, overrideDir, "testpkg_1.0_amd64.deb", "testpkg", "0.9-3", "amd64")
+	mkdeb(t, overrideDir, "under_score_1.0_all.deb", "under-score", "1.0", "all")
+
+	c := PackageConfig{OverrideDir: &overrideDir}
+
+	g := Package{}.MakePackageGroup("testpkg", "under-score", "other")
+	choices, err := c.UpdatePackageGroupChoices(g)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"testpkg:amd64=1.0-1", "under-score=1.0", "other"}, g.Args())
+	require.Len(t, choices, 2)
+	assert.Equal(t, newest, choices[0].Path)
+	assert.Equal(t, "1.0-1", choices[0].Version)
+	assert.ElementsMatch(t, []string{"1.0~rc1-1", "0.9-3"}, []string{choices[0].Skipped[0].Version, choices[0].Skipped[1].Version})
+	assert.Empty(t, choices[1].Skipped)
+	assert.Equal(t, "under-score 1.0 (all) from under_score_1.0_all.deb", choices[1].String())
+
+	// Another architecture makes the plain name ambiguous.
+	arm := mkdeb(t, overrideDir, "testpkg_arm64.deb", "testpkg", "1.0-1", "arm64")
+
+	g = Package{}.MakePackageGroup("testpkg")
+	_, err = c.UpdatePackageGroupChoices(g)
+	assert.ErrorContains(t, err, `"testpkg" for architectures amd64, arm64`)
+
+	g = Package{}.MakePackageGroup("testpkg:arm64")
+	choices, err = c.UpdatePackageGroupChoices(g)
+	require.NoError(t, err)
+	require.Len(t, choices, 1)
+	assert.Equal(t, arm, choices[0].Path)
+	assert.Equal(t, []string{"testpkg:arm64=1.0-1"}, g.Args())
+}
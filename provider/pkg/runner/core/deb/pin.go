@@ -0,0 +1,98 @@
+package deb
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const (
+	PreferencesDir = "/etc/apt/preferences.d"
+
+	// PinPriority is high enough that apt will downgrade to reach the
+	// pinned version or release.
+	PinPriority = 1001
+)
+
+// apt ignores files in preferences.d whose names have other characters.
+var preferencesNameReplacer = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// Pin describes how a package is kept at the version or release it was
+// installed from.
+type Pin struct {
+	Package string
+
+	// Preferences is the contents of the package's preferences file,
+	// or empty if it doesn't need one.
+	Preferences string
+
+	// Hold is set if the package should be held with apt-mark.
+	Hold bool
+}
+
+// PreferencesPath returns where the package's preferences file lives.
+func (p Pin) PreferencesPath() string {
+	return PreferencesPath(p.Package)
+}
+
+// PreferencesPath returns where the preferences file for the named
+// package lives.
+func PreferencesPath(name string) string {
+	return path.Join(PreferencesDir, "svmkit-"+preferencesNameReplacer.ReplaceAllString(name, "_")+".pref")
+}
+
+// preferences returns the package's preferences file.  A target release
+// is matched the way apt-get -t matches it, by either codename or suite,
+// so there's a stanza for each.
+func (p *Package) preferences() string {
+	var pins []string
+
+	switch {
+	case p.Version != nil:
+		pins = []string{"version " + *p.Version}
+	case p.TargetRelease != nil:
+		pins = []string{"release n=" + *p.TargetRelease, "release a=" + *p.TargetRelease}
+	default:
+		return ""
+	}
+
+	var stanzas []string
+
+	for _, pin := range pins {
+		stanzas = append(stanzas, fmt.Sprintf("Package: %s\nPin: %s\nPin-Priority: %d\n", p.Name, pin, PinPriority))
+	}
+
+	return strings.Join(stanzas, "\n")
+}
+
+// Pins returns how the packages in the group with a version or target
+// release should be pinned.  Preferences are only written if Pin is set,
+// and only packages with an exact version are held, and only if Hold is
+// set.  Local packages are never pinned.
+func (c *PackageConfig) Pins(g *PackageGroup) []Pin {
+	pin := c.Pin != nil && *c.Pin
+	hold := c.Hold != nil && *c.Hold
+
+	var pins []Pin
+
+	for _, pkg := range g.packages {
+		if pkg.LocalPath != nil {
+			continue
+		}
+
+		p := Pin{Package: pkg.Name}
+
+		if pin {
+			p.Preferences = pkg.preferences()
+		}
+
+		p.Hold = hold && pkg.Version != nil
+
+		if p.Preferences != "" || p.Hold {
+			pins = append(pins, p)
+		}
+	}
+
+	return pins
+}
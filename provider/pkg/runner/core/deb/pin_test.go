@@ -0,0 +1,54 @@
+package deb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreferencesPath(t *testing.T) {
+	assert.Equal(t, "/etc/apt/preferences.d/svmkit-agave-validator.pref", PreferencesPath("agave-validator"))
+	assert.Equal(t, "/etc/apt/preferences.d/svmkit-libstdc__6_amd64.pref", PreferencesPath("libstdc++6:amd64"))
+}
+
+func TestPackageConfigPins(t *testing.T) {
+	g := NewPackageGroup(
+		Package{Name: "plain"},
+		Package{Name: "versioned", Version: ptr("1.2.3-1")},
+		Package{Name: "released", TargetRelease: ptr("bookworm-backports")},
+		Package{Name: "suite", TargetRelease: ptr("stable-backports")},
+		Package{Name: "local", Version: ptr("1.0"), LocalPath: ptr("./assets/notapackage")},
+	)
+
+	{
+		c := PackageConfig{}
+		assert.Empty(t, c.Pins(g))
+	}
+
+	{
+		c := PackageConfig{Pin: ptr(true)}
+		assert.Equal(t, []Pin{
+			{
+				Package:     "versioned",
+				Preferences: "Package: versioned\nPin: version 1.2.3-1\nPin-Priority: 1001\n",
+			},
+			{
+				Package: "released",
+				Preferences: "Package: released\nPin: release n=bookworm-backports\nPin-Priority: 1001\n" +
+					"\n" +
+					"Package: released\nPin: release a=bookworm-backports\nPin-Priority: 1001\n",
+			},
+			{
+				Package: "suite",
+				Preferences: "Package: suite\nPin: release n=stable-backports\nPin-Priority: 1001\n" +
+					"\n" +
+					"Package: suite\nPin: release a=stable-backports\nPin-Priority: 1001\n",
+			},
+		}, c.Pins(g))
+	}
+
+	{
+		c := PackageConfig{Hold: ptr(true)}
+		assert.Equal(t, []Pin{{Package: "versioned", Hold: true}}, c.Pins(g))
+	}
+}
@@ -0,0 +1,149 @@
+package deb
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalRepositoryIndex is the name of the index of a flat repository,
+// which sits alongside the package files it lists.
+const LocalRepositoryIndex = "Packages"
+
+// LocalRepositoryEnv is set to LocalRepositoryIndex in the environment
+// of a script whose payload has a local repository, so lib.bash knows to
+// register it.
+const LocalRepositoryEnv = "SVMKIT_LOCAL_REPO_INDEX"
+
+// LocalRepository is a flat apt repository of the local packages in a
+// group, placed in the payload alongside them.  Installing through it
+// rather than by path lets apt resolve dependencies between the local
+// packages.
+type LocalRepository struct {
+	// Index is the contents of the Packages file.
+	Index []byte
+
+	// Versions is the version of each local package, by its name in
+	// the group.
+	Versions map[string]string
+}
+
+// LocalRepository builds a flat repository from the local .debs in the
+// group.  It returns nil if the group has none.  Other local packages,
+// such as .rpms, are left to be installed by path.
+func (p *PackageGroup) LocalRepository() (*LocalRepository, error) {
+	var index bytes.Buffer
+
+	versions := map[string]string{}
+
+	for _, pkg := range p.packages {
+		if !pkg.isLocalDeb() {
+			continue
+		}
+
+		stanza, control, err := indexStanza(*pkg.LocalPath)
+		if err != nil {
+			return nil, err
+		}
+
+		index.Write(stanza)
+		versions[pkg.Name] = control.Version
+		p.localControls[*pkg.LocalPath] = control
+	}
+
+	if len(versions) == 0 {
+		return nil, nil
+	}
+
+	return &LocalRepository{Index: index.Bytes(), Versions: versions}, nil
+}
+
+// isLocalDeb reports whether the package is a local .deb, which goes in
+// the repository.
+func (p *Package) isLocalDeb() bool {
+	return p.LocalPath != nil && filepath.Ext(*p.LocalPath) == ".deb"
+}
+
+// HasLocalRepository reports whether AddToPayload puts a repository in
+// the payload, which is the case if there are any local .debs.
+func (p *PackageGroup) HasLocalRepository() bool {
+	for _, pkg := range p.packages {
+		if pkg.isLocalDeb() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// localControl returns the control file of a local .deb.  A package
+// that can't be read is left to be named by path; AddToPayload reports
+// the error.
+func (p *PackageGroup) localControl(pkg Package) (Control, bool) {
+	if !pkg.isLocalDeb() {
+		return Control{}, false
+	}
+
+	if control, ok := p.localControls[*pkg.LocalPath]; ok {
+		return control, true
+	}
+
+	control, err := ReadControlFile(*pkg.LocalPath)
+	if err != nil {
+		return Control{}, false
+	}
+
+	p.localControls[*pkg.LocalPath] = control
+
+	return control, true
+}
+
+// indexStanza returns the Packages entry for a .deb: its control file,
+// followed by where to find it and its size and hashes.
+func indexStanza(path string) ([]byte, Control, error) {
+	data, err := ReadControlDataFile(path)
+	if err != nil {
+		return nil, Control{}, err
+	}
+
+	control, err := ParseControl(data)
+	if err != nil {
+		return nil, control, fmt.Errorf("%q: %w", path, err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, control, err
+	}
+	defer f.Close()
+
+	md5Sum, sha1Sum, sha256Sum := md5.New(), sha1.New(), sha256.New()
+
+	size, err := io.Copy(io.MultiWriter(md5Sum, sha1Sum, sha256Sum), f)
+	if err != nil {
+		return nil, control, fmt.Errorf("failed to hash %q: %w", path, err)
+	}
+
+	var b bytes.Buffer
+
+	b.WriteString(strings.TrimRight(string(data), "\n"))
+	b.WriteString("\n")
+
+	// Don't use pkg.String here, as in AddToPayload; the path is
+	// relative to the repository, which is the payload root.
+	fmt.Fprintf(&b, "Filename: ./%s\n", filepath.Base(path))
+	fmt.Fprintf(&b, "Size: %d\n", size)
+	fmt.Fprintf(&b, "MD5sum: %s\n", hex.EncodeToString(md5Sum.Sum(nil)))
+	fmt.Fprintf(&b, "SHA1: %s\n", hex.EncodeToString(sha1Sum.Sum(nil)))
+	fmt.Fprintf(&b, "SHA256: %s\n", hex.EncodeToString(sha256Sum.Sum(nil)))
+	b.WriteString("\n")
+
+	return b.Bytes(), control, nil
+}
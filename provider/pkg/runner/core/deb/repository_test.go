@@ -0,0 +1,118 @@
+package deb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/abklabs/pulumi-runner/pkg/runner/core/payload"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalRepository(t *testing.T) {
+	dir := t.TempDir()
+
+	lib := mkdeb(t, dir, "libfoo_1.0-1_amd64.deb", "libfoo", "1.0-1", "amd64")
+	tool := mkdeb(t, dir, "foo-tools_1.0-1_amd64.deb", "foo-tools", "1.0-1", "amd64")
+
+	g := NewPackageGroup(
+		Package{Name: "curl"},
+		Package{Name: "foo-tools", LocalPath: &tool},
+		Package{Name: "libfoo:amd64", LocalPath: &lib},
+	)
+
+	assert.True(t, g.HasLocalRepository())
+	assert.Equal(t, []string{"curl", "foo-tools:amd64=1.0-1", "libfoo:amd64=1.0-1"}, g.Args())
+	assert.Equal(t, []string{"curl", "./foo-tools_1.0-1_amd64.deb", "./libfoo_1.0-1_amd64.deb"}, g.PathArgs())
+
+	repo, err := g.LocalRepository()
+	require.NoError(t, err)
+	require.NotNil(t, repo)
+
+	assert.Equal(t, map[string]string{"foo-tools": "1.0-1", "libfoo:amd64": "1.0-1"}, repo.Versions)
+
+	data, err := os.ReadFile(tool)
+	require.NoError(t, err)
+	sum := sha256.Sum256(data)
+
+	stanzas := strings.Split(strings.TrimSuffix(string(repo.Index), "\n\n"), "\n\n")
+	require.Len(t, stanzas, 2)
+
+	assert.True(t, strings.HasPrefix(stanzas[0], "Package: foo-tools\nVersion: 1.0-1\nArchitecture: amd64\n"), stanzas[0])
+	assert.Contains(t, stanzas[0], "\nDescription: test\n a package for testing\n")
+	assert.Contains(t, stanzas[0], "\nFilename: ./foo-tools_1.0-1_amd64.deb\n")
+	assert.Contains(t, stanzas[0], fmt.Sprintf("\nSize: %d\n", len(data)))
+	assert.Contains(t, stanzas[0], "\nSHA256: "+hex.EncodeToString(sum[:]))
+	assert.Contains(t, stanzas[1], "\nFilename: ./libfoo_1.0-1_amd64.deb\n")
+
+	for _, field := range []string{"MD5sum", "SHA1"} {
+		assert.Contains(t, stanzas[1], "\n"+field+": ")
+	}
+}
+
+func TestLocalRepositoryNone(t *testing.T) {
+	g := Package{}.MakePackageGroup("curl")
+
+	repo, err := g.LocalRepository()
+	require.NoError(t, err)
+	assert.Nil(t, repo)
+
+	// Local packages other than .debs are left out.
+	g.Add(Package{Name: "other", LocalPath: ptr("./assets/notapackage")})
+	repo, err = g.LocalRepository()
+	require.NoError(t, err)
+	assert.Nil(t, repo)
+	assert.False(t, g.HasLocalRepository())
+
+	bad := filepath.Join(t.TempDir(), "bad.deb")
+	require.NoError(t, os.WriteFile(bad, []byte("not a package"), 0644))
+
+	g.Add(Package{Name: "bad", LocalPath: &bad})
+	assert.Equal(t, []string{"curl", "./notapackage", "./bad.deb"}, g.Args())
+
+	_, err = g.LocalRepository()
+	assert.ErrorContains(t, err, "not a debian package")
+	assert.ErrorContains(t, g.AddToPayload(&payload.Payload{}), "not a debian package")
+}
+
+func TestLocalRepositoryPayload(t *testing.T) {
+	dir := t.TempDir()
+
+	lib := mkdeb(t, dir, "libfoo_1.0-1_amd64.deb", "libfoo", "1.0-1", "amd64")
+
+	g := NewPackageGroup(Package{Name: "curl"}, Package{Name: "libfoo", LocalPath: &lib})
+
+	pl := &payload.Payload{}
+	require.NoError(t, g.AddToPayload(pl))
+	require.Len(t, pl.Files, 2)
+
+	assert.Equal(t, LocalRepositoryIndex, pl.Files[0].Path)
+	index, err := io.ReadAll(pl.Files[0].Reader)
+	require.NoError(t, err)
+	assert.Contains(t, string(index), "Package: libfoo\nVersion: 1.0-1\n")
+	assert.Contains(t, string(index), "\nFilename: ./libfoo_1.0-1_amd64.deb\n")
+
+	assert.Equal(t, "libfoo_1.0-1_amd64.deb", pl.Files[1].Path)
+	assert.Equal(t, []string{"curl", "libfoo:amd64=1.0-1"}, g.Args())
+}
+
+func TestLocalRepositoryArgsFromControl(t *testing.T) {
+	dir := t.TempDir()
+
+	// The group's name for a package needn't be the one apt knows it by.
+	tool := mkdeb(t, dir, "tool.deb", "foo-tools", "1.0-1", "arm64")
+	docs := mkdeb(t, dir, "docs.deb", "foo-doc", "1.0-1", "all")
+
+	g := NewPackageGroup(
+		Package{Name: "tool", LocalPath: &tool},
+		Package{Name: "docs", LocalPath: &docs},
+	)
+
+	assert.Equal(t, []string{"foo-tools:arm64=1.0-1", "foo-doc=1.0-1"}, g.Args())
+}
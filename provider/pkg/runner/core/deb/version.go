@@ -0,0 +1,222 @@
+package deb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a Debian package version, [epoch:]upstream[-revision].
+type Version struct {
+	Epoch    int
+	Upstream string
+	Revision string
+}
+
+// ParseVersion parses a Debian package version the way dpkg does.
+func ParseVersion(s string) (Version, error) {
+	var v Version
+
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return v, fmt.Errorf("version string is empty")
+	}
+
+	if strings.ContainsAny(s, " \t\n") {
+		return v, fmt.Errorf("version string %q has embedded spaces", s)
+	}
+
+	rest := s
+
+	if epoch, after, ok := strings.Cut(s, ":"); ok {
+		n, err := strconv.Atoi(epoch)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("epoch in version %q is not a number", s)
+		}
+
+		v.Epoch = n
+		rest = after
+	}
+
+	if i := strings.LastIndexByte(rest, '-'); i >= 0 {
+		v.Upstream, v.Revision = rest[:i], rest[i+1:]
+
+		if v.Revision == "" {
+			return v, fmt.Errorf("revision in version %q is empty", s)
+		}
+	} else {
+		v.Upstream = rest
+	}
+
+	if v.Upstream == "" {
+		return v, fmt.Errorf("version %q has an empty upstream version", s)
+	}
+
+	if !isDigit(v.Upstream[0]) {
+		return v, fmt.Errorf("version %q doesn't start with a digit", s)
+	}
+
+	if i := strings.IndexFunc(v.Upstream, func(r rune) bool {
+		return !(isAlnum(r) || strings.ContainsRune(".-+~:", r))
+	}); i >= 0 {
+		return v, fmt.Errorf("invalid character %q in version %q", v.Upstream[i], s)
+	}
+
+	if i := strings.IndexFunc(v.Revision, func(r rune) bool {
+		return !(isAlnum(r) || strings.ContainsRune(".+~", r))
+	}); i >= 0 {
+		return v, fmt.Errorf("invalid character %q in revision of version %q", v.Revision[i], s)
+	}
+
+	return v, nil
+}
+
+// MustParseVersion is like ParseVersion, but panics on error.
+func MustParseVersion(s string) Version {
+	v, err := ParseVersion(s)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func (v Version) String() string {
+	var b strings.Builder
+
+	if v.Epoch != 0 {
+		fmt.Fprintf(&b, "%d:", v.Epoch)
+	}
+
+	b.WriteString(v.Upstream)
+
+	if v.Revision != "" {
+		b.WriteString("-" + v.Revision)
+	}
+
+	return b.String()
+}
+
+// Compare returns -1, 0 or 1 as v sorts before, the same as, or after
+// other, as dpkg --compare-versions would.
+func (v Version) Compare(other Version) int {
+	switch {
+	case v.Epoch < other.Epoch:
+		return -1
+	case v.Epoch > other.Epoch:
+		return 1
+	}
+
+	if c := verrevcmp(v.Upstream, other.Upstream); c != 0 {
+		return c
+	}
+
+	return verrevcmp(v.Revision, other.Revision)
+}
+
+// CompareVersions parses and compares two versions.
+func CompareVersions(a, b string) (int, error) {
+	va, err := ParseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+
+	vb, err := ParseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+
+	return va.Compare(vb), nil
+}
+
+func isDigit[T rune | byte](c T) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isAlpha[T rune | byte](c T) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isAlnum(r rune) bool {
+	return isDigit(r) || isAlpha(r)
+}
+
+// order gives the weight of a character in the non-digit parts of a
+// version: ~ sorts before anything, even the end of the part, and
+// letters sort before other characters.
+func order(s string, i int) int {
+	if i >= len(s) {
+		return 0
+	}
+
+	c := s[i]
+
+	switch {
+	case isDigit(c):
+		return 0
+	case isAlpha(c):
+		return int(c)
+	case c == '~':
+		return -1
+	default:
+		return int(c) + 256
+	}
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+// verrevcmp compares upstream versions or revisions, alternating
+// between runs of non-digits, compared by order, and runs of digits,
+// compared numerically.
+func verrevcmp(a, b string) int {
+	i, j := 0, 0
+
+	for i < len(a) || j < len(b) {
+		for (i < len(a) && !isDigit(a[i])) || (j < len(b) && !isDigit(b[j])) {
+			if c := order(a, i) - order(b, j); c != 0 {
+				return sign(c)
+			}
+			i++
+			j++
+		}
+
+		for i < len(a) && a[i] == '0' {
+			i++
+		}
+
+		for j < len(b) && b[j] == '0' {
+			j++
+		}
+
+		firstDiff := 0
+
+		for i < len(a) && isDigit(a[i]) && j < len(b) && isDigit(b[j]) {
+			if firstDiff == 0 {
+				firstDiff = int(a[i]) - int(b[j])
+			}
+			i++
+			j++
+		}
+
+		if i < len(a) && isDigit(a[i]) {
+			return 1
+		}
+
+		if j < len(b) && isDigit(b[j]) {
+			return -1
+		}
+
+		if firstDiff != 0 {
+			return sign(firstDiff)
+		}
+	}
+
+	return 0
+}
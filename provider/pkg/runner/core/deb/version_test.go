@@ -0,0 +1,97 @@
+package deb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Version
+	}{
+		{"1.0", Version{Upstream: "1.0"}},
+		{"1.0-1", Version{Upstream: "1.0", Revision: "1"}},
+		{"2:1.0-1", Version{Epoch: 2, Upstream: "1.0", Revision: "1"}},
+		{"1.2-3-4", Version{Upstream: "1.2-3", Revision: "4"}},
+		{"1:2:3-1", Version{Epoch: 1, Upstream: "2:3", Revision: "1"}},
+		{"7.88.1-10+deb12u5", Version{Upstream: "7.88.1", Revision: "10+deb12u5"}},
+		{"2.0.0~rc1+dfsg", Version{Upstream: "2.0.0~rc1+dfsg"}},
+	}
+
+	for _, tt := range tests {
+		v, err := ParseVersion(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, v, tt.in)
+		assert.Equal(t, tt.in, v.String())
+	}
+
+	for in, msg := range map[string]string{
+		"":        "empty",
+		"1.0 1":   "embedded spaces",
+		"a:1.0":   "epoch",
+		"-1:1.0":  "epoch",
+		"1.0-":    "revision",
+		"1:":      "empty upstream",
+		"a1.0":    "start with a digit",
+		"1.0_1":   "invalid character",
+		"1.0-1_2": "invalid character",
+	} {
+		_, err := ParseVersion(in)
+		assert.ErrorContains(t, err, msg, in)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	// Each pair is a < b, as dpkg --compare-versions a lt b.
+	less := [][2]string{
+		{"1.0", "1.1"},
+		{"1.9", "1.10"},
+		{"1.0~rc1", "1.0"},
+		{"1.0~~", "1.0~"},
+		{"1.0~rc1", "1.0~rc2"},
+		{"1.0", "1.0a"},
+		{"1.0a", "1.0b"},
+		{"1.0", "1.0.1"},
+		{"1.0", "1.0+b1"},
+		{"1.0a", "1.0+"},
+		{"1.0-1", "1.0-1+b1"},
+		{"1.0-1", "1.0-2"},
+		{"1.0-9", "1.0-10"},
+		{"1.0-1~bpo12+1", "1.0-1"},
+		{"1.0", "1.0-0.1"},
+		{"9.9-9", "1:0.1-1"},
+		{"1:1.0", "2:0.1"},
+		{"2.36-9+deb12u4", "2.36-9+deb12u10"},
+	}
+
+	for _, pair := range less {
+		c, err := CompareVersions(pair[0], pair[1])
+		require.NoError(t, err)
+		assert.Equal(t, -1, c, "%s < %s", pair[0], pair[1])
+
+		c, err = CompareVersions(pair[1], pair[0])
+		require.NoError(t, err)
+		assert.Equal(t, 1, c, "%s > %s", pair[1], pair[0])
+	}
+
+	equal := [][2]string{
+		{"1.0", "1.0"},
+		{"1.01", "1.1"},
+		{"1.000", "1.0"},
+		{"0:1.0", "1.0"},
+		{"1.0-0", "1.0"},
+		{"1.0-01", "1.0-1"},
+	}
+
+	for _, pair := range equal {
+		c, err := CompareVersions(pair[0], pair[1])
+		require.NoError(t, err)
+		assert.Equal(t, 0, c, "%s == %s", pair[0], pair[1])
+	}
+
+	_, err := CompareVersions("1.0", "x")
+	assert.Error(t, err)
+}
@@ -0,0 +1,141 @@
+package deployer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/kballard/go-shellquote"
+	"github.com/pkg/sftp"
+)
+
+// Fetch names a file to download from the remote host after the command
+// has run.  Relative remote paths are relative to the payload root.
+type Fetch struct {
+	Remote string
+	Local  string
+}
+
+// FetchResult describes a file that was downloaded.
+type FetchResult struct {
+	Fetch
+	Size   int64
+	Sha256 string
+}
+
+// Fetch downloads files from the remote host over SFTP, verifying that
+// the whole of each file was received.
+func (p *SSH) Fetch(fetches []Fetch) (results []FetchResult, err error) {
+	sftpClient, err := sftp.NewClient(p.Client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SFTP client: %w", err)
+	}
+
+	defer func() {
+		err = errors.Join(err, sftpClient.Close())
+	}()
+
+	for _, f := range fetches {
+		res, err := p.fetchFile(sftpClient, f)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, res)
+	}
+
+	return results, nil
+}
+
+func (p *SSH) fetchFile(sftpClient *sftp.Client, f Fetch) (res FetchResult, err error) {
+	remotePath := f.Remote
+	if !path.IsAbs(remotePath) {
+		remotePath = path.Join(p.Payload.RootPath, remotePath)
+	}
+
+	remoteFile, err := sftpClient.Open(remotePath)
+	if err != nil {
+		return res, fmt.Errorf("failed to open remote file %s: %w", remotePath, err)
+	}
+
+	defer func() {
+		err = errors.Join(err, remoteFile.Close())
+	}()
+
+	info, err := remoteFile.Stat()
+	if err != nil {
+		return res, fmt.Errorf("failed to stat remote file %s: %w", remotePath, err)
+	}
+
+	if !info.Mode().IsRegular() {
+		return res, fmt.Errorf("remote path %s is not a regular file", remotePath)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(f.Local), 0755); err != nil {
+		return res, fmt.Errorf("failed to create local directory for %s: %w", f.Local, err)
+	}
+
+	// Download next to the destination, and only move it into place
+	// once it's complete.
+	localFile, err := os.CreateTemp(filepath.Dir(f.Local), "."+filepath.Base(f.Local)+".*")
+	if err != nil {
+		return res, fmt.Errorf("failed to create local file for %s: %w", f.Local, err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = os.Remove(localFile.Name())
+		}
+	}()
+
+	hash := sha256.New()
+
+	copied, err := io.Copy(io.MultiWriter(localFile, hash), remoteFile)
+	err = errors.Join(err, localFile.Close())
+	if err != nil {
+		return res, fmt.Errorf("failed to download remote file %s: %w", remotePath, err)
+	}
+
+	if copied != info.Size() {
+		return res, fmt.Errorf("downloaded %d bytes of remote file %s, expected %d", copied, remotePath, info.Size())
+	}
+
+	if err := os.Chmod(localFile.Name(), info.Mode().Perm()); err != nil {
+		return res, fmt.Errorf("failed to set mode of %s: %w", f.Local, err)
+	}
+
+	if err := os.Rename(localFile.Name(), f.Local); err != nil {
+		return res, fmt.Errorf("failed to move download into place at %s: %w", f.Local, err)
+	}
+
+	return FetchResult{
+		Fetch:  f,
+		Size:   copied,
+		Sha256: hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// Cleanup removes the payload from the remote host.
+func (p *SSH) Cleanup() (err error) {
+	execSession, err := p.Client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to create SSH session: %w", err)
+	}
+
+	defer func() {
+		if closeErr := execSession.Close(); closeErr != io.EOF {
+			err = errors.Join(err, closeErr)
+		}
+	}()
+
+	if out, err := execSession.CombinedOutput("rm -rf " + shellquote.Join(p.Payload.RootPath)); err != nil {
+		return fmt.Errorf("failed to remove payload %s (output: %q): %w", p.Payload.RootPath, out, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package deployer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/abklabs/pulumi-runner/pkg/runner/core/payload"
+	"github.com/abklabs/pulumi-runner/pkg/ssh/sshtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetch(t *testing.T) {
+	server := sshtest.NewServer(t)
+
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "out"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "out", "result.json"), []byte(`{"ok":true}`), 0o640))
+
+	abs := filepath.Join(t.TempDir(), "report.txt")
+	require.NoError(t, os.WriteFile(abs, []byte("report\n"), 0o600))
+
+	local := t.TempDir()
+	d := SSH{Payload: &payload.Payload{RootPath: root}, Client: server.Dial(t)}
+
+	results, err := d.Fetch([]Fetch{
+		{Remote: "out/result.json", Local: filepath.Join(local, "nested", "result.json")},
+		{Remote: abs, Local: filepath.Join(local, "report.txt")},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+
+	sum := sha256.Sum256([]byte(`{"ok":true}`))
+	assert.Equal(t, FetchResult{
+		Fetch:  Fetch{Remote: "out/result.json", Local: filepath.Join(local, "nested", "result.json")},
+		Size:   11,
+		Sha256: hex.EncodeToString(sum[:]),
+	}, results[0])
+	assert.EqualValues(t, 7, results[1].Size)
+
+	got, err := os.ReadFile(filepath.Join(local, "nested", "result.json"))
+	require.NoError(t, err)
+	assert.Equal(t, `{"ok":true}`, string(got))
+
+	info, err := os.Stat(filepath.Join(local, "report.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestFetchErrors(t *testing.T) {
+	server := sshtest.NewServer(t)
+	local := t.TempDir()
+	d := SSH{Payload: &payload.Payload{RootPath: t.TempDir()}, Client: server.Dial(t)}
+
+	_, err := d.Fetch([]Fetch{{Remote: "missing", Local: filepath.Join(local, "missing")}})
+	assert.ErrorContains(t, err, "failed to open remote file")
+
+	_, err = d.Fetch([]Fetch{{Remote: d.Payload.RootPath, Local: filepath.Join(local, "dir")}})
+	assert.ErrorContains(t, err, "is not a regular file")
+
+	// A file whose contents don't match its size, as it changed while
+	// being downloaded.
+	_, err = d.Fetch([]Fetch{{Remote: "/proc/self/status", Local: filepath.Join(local, "status")}})
+	assert.ErrorContains(t, err, "expected 0")
+
+	// Nothing is left behind by a failed download.
+	entries, err := os.ReadDir(local)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestCleanup(t *testing.T) {
+	server := sshtest.NewServer(t)
+
+	root := filepath.Join(t.TempDir(), "runner-1-2")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "out"), 0o755))
+
+	d := SSH{Payload: &payload.Payload{RootPath: root}, Client: server.Dial(t)}
+	require.NoError(t, d.Cleanup())
+
+	assert.NoDirExists(t, root)
+}
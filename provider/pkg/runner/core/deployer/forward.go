@@ -0,0 +1,203 @@
+package deployer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const unixAddressPrefix = "unix:"
+
+// Forward describes a connection forward between the local and remote
+// hosts.  Addresses are either "host:port" for TCP or "unix:/path" for
+// Unix sockets.
+type Forward struct {
+	// Name identifies the forward; the bound listen address of a
+	// remote forward is exposed to the command under this name.
+	Name string
+
+	// Remote forwards listen on the remote host and connect to
+	// Target from the local host.  Otherwise the forward listens
+	// locally and connects to Target from the remote host.
+	Remote bool
+
+	Listen string
+	Target string
+}
+
+// Forwards holds the listeners for a set of running forwards.
+type Forwards struct {
+	listeners map[string]net.Listener
+	order     []string
+	remote    map[string]bool
+
+	mu     sync.Mutex
+	closed bool
+	conns  map[net.Conn]struct{}
+	wg     sync.WaitGroup
+}
+
+func splitAddress(addr string) (network, address string) {
+	if path, ok := strings.CutPrefix(addr, unixAddressPrefix); ok {
+		return "unix", path
+	}
+
+	return "tcp", addr
+}
+
+func joinAddress(addr net.Addr) string {
+	if addr.Network() == "unix" {
+		return unixAddressPrefix + addr.String()
+	}
+
+	return addr.String()
+}
+
+// StartForwards binds the listeners for all of the forwards, and serves
+// connections on them until Close is called.
+func StartForwards(client *ssh.Client, forwards []Forward) (*Forwards, error) {
+	f := &Forwards{
+		listeners: make(map[string]net.Listener),
+		remote:    make(map[string]bool),
+		conns:     make(map[net.Conn]struct{}),
+	}
+
+	for _, fwd := range forwards {
+		var (
+			listener net.Listener
+			dial     func(network, address string) (net.Conn, error)
+			err      error
+		)
+
+		network, address := splitAddress(fwd.Listen)
+
+		if fwd.Remote {
+			if network == "unix" {
+				listener, err = client.ListenUnix(address)
+			} else {
+				listener, err = client.Listen(network, address)
+			}
+			dial = net.Dial
+		} else {
+			listener, err = net.Listen(network, address)
+			dial = client.Dial
+		}
+
+		if err != nil {
+			return nil, errors.Join(
+				fmt.Errorf("failed to listen on %s for forward %s: %w", fwd.Listen, fwd.Name, err),
+				f.Close())
+		}
+
+		f.listeners[fwd.Name] = listener
+		f.order = append(f.order, fwd.Name)
+		f.remote[fwd.Name] = fwd.Remote
+
+		f.wg.Add(1)
+		go f.serve(listener, dial, fwd.Target)
+	}
+
+	return f, nil
+}
+
+func (f *Forwards) track(c net.Conn, add bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case add && f.closed:
+		_ = c.Close()
+	case add:
+		f.conns[c] = struct{}{}
+	default:
+		delete(f.conns, c)
+	}
+}
+
+func (f *Forwards) serve(listener net.Listener, dial func(network, address string) (net.Conn, error), target string) {
+	defer f.wg.Done()
+
+	network, address := splitAddress(target)
+
+	for {
+		in, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		f.wg.Add(1)
+		go func() {
+			defer f.wg.Done()
+			defer in.Close()
+
+			out, err := dial(network, address)
+			if err != nil {
+				return
+			}
+			defer out.Close()
+
+			f.track(in, true)
+			f.track(out, true)
+			defer f.track(in, false)
+			defer f.track(out, false)
+
+			var copies sync.WaitGroup
+			copies.Add(2)
+
+			pipe := func(dst, src net.Conn) {
+				defer copies.Done()
+				_, _ = io.Copy(dst, src)
+				// Unblock the other direction once this side is done.
+				_ = dst.Close()
+				_ = src.Close()
+			}
+
+			go pipe(out, in)
+			go pipe(in, out)
+
+			copies.Wait()
+		}()
+	}
+}
+
+// Addresses returns the bound listen address of each remote forward,
+// keyed by the forward's name.  Local forwards listen on this host, so
+// their addresses are no use to the remote command.
+func (f *Forwards) Addresses() map[string]string {
+	res := make(map[string]string, len(f.listeners))
+
+	for name, listener := range f.listeners {
+		if f.remote[name] {
+			res[name] = joinAddress(listener.Addr())
+		}
+	}
+
+	return res
+}
+
+// Close shuts down all listeners and any connections still in flight.
+func (f *Forwards) Close() error {
+	var errs []error
+
+	for _, name := range f.order {
+		if err := f.listeners[name].Close(); err != nil && !errors.Is(err, net.ErrClosed) && err != io.EOF {
+			errs = append(errs, fmt.Errorf("failed to close forward %s: %w", name, err))
+		}
+	}
+
+	f.mu.Lock()
+	f.closed = true
+	for c := range f.conns {
+		_ = c.Close()
+	}
+	f.mu.Unlock()
+
+	f.wg.Wait()
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,100 @@
+package deployer
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/abklabs/pulumi-runner/pkg/ssh/sshtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echoServer echoes back whatever is written to it.
+func echoServer(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func echo(t *testing.T, addr string) net.Conn {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+
+	_, err = conn.Write([]byte("ping\n"))
+	require.NoError(t, err)
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "ping\n", line)
+
+	return conn
+}
+
+func TestStartForwards(t *testing.T) {
+	server := sshtest.NewServer(t)
+	client := server.Dial(t)
+	target := echoServer(t)
+
+	forwards, err := StartForwards(client, []Forward{
+		{Name: "REMOTE", Remote: true, Listen: "127.0.0.1:0", Target: target},
+		{Name: "LOCAL", Listen: "127.0.0.1:0", Target: target},
+	})
+	require.NoError(t, err)
+
+	// Only the remote forward's address is any use to the command.
+	addrs := forwards.Addresses()
+	require.Contains(t, addrs, "REMOTE")
+	assert.NotContains(t, addrs, "LOCAL")
+	assert.NotEqual(t, "127.0.0.1:0", addrs["REMOTE"])
+
+	remote := echo(t, addrs["REMOTE"])
+	local := echo(t, forwards.listeners["LOCAL"].Addr().String())
+
+	// Closing shuts the listeners and the connections in flight.
+	require.NoError(t, forwards.Close())
+
+	for _, conn := range []net.Conn{remote, local} {
+		_, err := conn.Read(make([]byte, 1))
+		assert.Error(t, err)
+		_ = conn.Close()
+	}
+
+	_, err = net.Dial("tcp", forwards.listeners["LOCAL"].Addr().String())
+	assert.Error(t, err)
+}
+
+func TestStartForwardsListenError(t *testing.T) {
+	server := sshtest.NewServer(t)
+	client := server.Dial(t)
+
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer taken.Close()
+
+	_, err = StartForwards(client, []Forward{
+		{Name: "OK", Listen: "127.0.0.1:0", Target: "127.0.0.1:1"},
+		{Name: "TAKEN", Listen: taken.Addr().String(), Target: "127.0.0.1:1"},
+	})
+	assert.ErrorContains(t, err, "failed to listen on "+taken.Addr().String()+" for forward TAKEN")
+}
@@ -0,0 +1,89 @@
+package deployer
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxLineLength is the longest line of output handlers are given;
+// longer lines are passed on in pieces.
+const MaxLineLength = 16 * 1024
+
+// ansiEscapeRegexp matches terminal escape sequences: CSI sequences such
+// as colors and cursor movement, OSC sequences such as window titles,
+// and the two byte escapes.
+var ansiEscapeRegexp = regexp.MustCompile(`\x1b(?:\[[0-?]*[ -/]*[@-~]|\][^\x07\x1b]*(?:\x07|\x1b\\)|[@-Z\\-_])`)
+
+// ReadLines calls fn with each line read from r, cleaned up by
+// CleanLine, until r is exhausted.  Lines longer than maxLen bytes are
+// split, so no line can stop the reading, and if reading fails r is
+// still drained, so the command writing to it is never blocked.
+func ReadLines(r io.Reader, maxLen int, fn func(string)) error {
+	br := bufio.NewReaderSize(r, maxLen)
+
+	var carry []byte
+
+	for {
+		chunk, err := br.ReadSlice('\n')
+
+		if err == bufio.ErrBufferFull {
+			// Don't split a character between pieces.
+			cut := len(chunk)
+			for i := len(chunk) - 1; i >= 0 && i >= len(chunk)-utf8.UTFMax; i-- {
+				if utf8.RuneStart(chunk[i]) {
+					if !utf8.FullRune(chunk[i:]) {
+						cut = i
+					}
+					break
+				}
+			}
+
+			fn(CleanLine(append(carry, chunk[:cut]...)))
+			carry = append([]byte{}, chunk[cut:]...)
+			continue
+		}
+
+		if len(chunk) > 0 || len(carry) > 0 {
+			fn(CleanLine(append(carry, chunk...)))
+			carry = nil
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			_, _ = io.Copy(io.Discard, r)
+			return err
+		}
+	}
+}
+
+// CleanLine makes a line of output fit for logging: it drops the line
+// ending, keeps only what a terminal would show of a line redrawn with
+// carriage returns, removes escape sequences and other control
+// characters, and replaces invalid UTF-8.
+func CleanLine(b []byte) string {
+	b = bytes.TrimSuffix(b, []byte("\n"))
+	b = bytes.TrimRight(b, "\r")
+
+	// A progress bar redraws itself after a carriage return; keep the
+	// last drawing.
+	if i := bytes.LastIndexByte(b, '\r'); i >= 0 {
+		b = b[i+1:]
+	}
+
+	b = ansiEscapeRegexp.ReplaceAll(b, nil)
+
+	return strings.Map(func(r rune) rune {
+		if r != '\t' && unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, strings.ToValidUTF8(string(b), string(utf8.RuneError)))
+}
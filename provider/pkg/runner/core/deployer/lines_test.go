@@ -0,0 +1,96 @@
+package deployer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readAll(t *testing.T, r io.Reader, maxLen int) ([]string, error) {
+	t.Helper()
+
+	var lines []string
+	err := ReadLines(r, maxLen, func(line string) {
+		lines = append(lines, line)
+	})
+
+	return lines, err
+}
+
+func TestReadLinesLong(t *testing.T) {
+	long := strings.Repeat("x", 10*MaxLineLength+5)
+
+	lines, err := readAll(t, strings.NewReader("before\n"+long+"\nafter"), MaxLineLength)
+	require.NoError(t, err)
+
+	require.Len(t, lines, 13)
+	assert.Equal(t, "before", lines[0])
+	assert.Equal(t, long, strings.Join(lines[1:12], ""))
+	assert.Equal(t, "after", lines[12])
+
+	for _, line := range lines {
+		assert.LessOrEqual(t, len(line), MaxLineLength)
+	}
+}
+
+func TestReadLinesSplitCharacter(t *testing.T) {
+	// Each "é" is two bytes, so a 16 byte buffer would end halfway
+	// through one after the leading "a".
+	line := "a" + strings.Repeat("é", 20)
+
+	lines, err := readAll(t, iotest.OneByteReader(strings.NewReader(line+"\n")), 16)
+	require.NoError(t, err)
+
+	assert.Equal(t, line, strings.Join(lines, ""))
+	for _, l := range lines {
+		assert.True(t, utf8.ValidString(l), l)
+		assert.NotContains(t, l, string(utf8.RuneError))
+	}
+}
+
+func TestReadLinesBinary(t *testing.T) {
+	data := []byte{'o', 'k', 0xff, 0xfe, 0, 1, '\t', 'x', '\n', 0x7f, 0x80, '\n'}
+
+	lines, err := readAll(t, bytes.NewReader(data), MaxLineLength)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"ok\uFFFD\tx", "\uFFFD"}, lines)
+}
+
+func TestReadLinesDrainsAfterError(t *testing.T) {
+	r := strings.NewReader("one\ntwo\n" + strings.Repeat("rest\n", 1000))
+
+	// TimeoutReader fails its second read, and succeeds after that.
+	lines, err := readAll(t, iotest.TimeoutReader(r), 16)
+	assert.ErrorIs(t, err, iotest.ErrTimeout)
+	assert.NotEmpty(t, lines)
+	assert.Zero(t, r.Len())
+
+	lines, err = readAll(t, io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(errors.New("broken pipe"))), 16)
+	assert.EqualError(t, err, "broken pipe")
+	assert.Equal(t, []string{"partial"}, lines)
+}
+
+func TestCleanLine(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"plain\n", "plain"},
+		{"windows\r\n", "windows"},
+		{"  10%\r  50%\r 100%\n", " 100%"},
+		{"done\r\r\n", "done"},
+		{"\x1b[0;31mERROR\x1b[0m:\tfailed\n", "ERROR:\tfailed"},
+		{"\x1b[2K\x1b[1Gredrawn", "redrawn"},
+		{"\x1b]0;title\x07text", "text"},
+		{"bell\x07 and nul\x00", "bell and nul"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, CleanLine([]byte(tt.in)), "%q", tt.in)
+	}
+}
@@ -15,6 +15,10 @@ import (
 type Local struct {
 	Payload     *payload.Payload
 	KeepPayload bool
+
+	// SecretEnv, if set, is sent to the command's standard input as
+	// exports, which run.sh evaluates when RUNNER_SECRET_STDIN is set.
+	SecretEnv io.Reader
 }
 
 func (p *Local) Deploy() (err error) {
@@ -59,10 +63,14 @@ func (p *Local) Run(cmdSegs []string, handler DeployerHandler) error {
 	err := runWrapperTemplate.Execute(runWrapper, struct {
 		*payload.Payload
 		KeepPayload bool
+		SecretsPath string
+		SecretEnv   bool
 		Cmd         string
 	}{
 		p.Payload,
 		p.KeepPayload,
+		"",
+		p.SecretEnv != nil,
 		strings.Join(cmdSegs, " "),
 	})
 
@@ -71,6 +79,7 @@ func (p *Local) Run(cmdSegs []string, handler DeployerHandler) error {
 	}
 
 	cmd := exec.Command("bash", "-c", runWrapper.String())
+	cmd.Stdin = p.SecretEnv
 
 	stdoutPipe, err := cmd.StdoutPipe()
 	if err != nil {
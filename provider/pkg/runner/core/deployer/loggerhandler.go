@@ -1,7 +1,6 @@
 package deployer
 
 import (
-	"bufio"
 	"fmt"
 	"io"
 	"strings"
@@ -13,25 +12,31 @@ func cleanupLine(s string) string {
 }
 
 type LoggerHandler struct {
-	lines []string
+	// Output keeps the command's output for errors.  If nil, one is
+	// made with the default sizes, held in memory only.  A caller that
+	// spools its own Output must call Close.
+	Output *OutputBuffer
 
 	LogCallback func(string)
 }
 
 func (h *LoggerHandler) IngestReaders(done chan<- struct{}, stdout io.Reader, stderr io.Reader) error {
+	if h.Output == nil {
+		h.Output = NewOutputBuffer(DefaultOutputHeadLines, DefaultOutputTailLines)
+	}
+
 	var wg sync.WaitGroup
 	wg.Add(2)
 
 	ingest := make(chan string)
 
 	engine := func(r io.Reader) {
-		s := bufio.NewScanner(r)
-
-		for s.Scan() {
-			txt := s.Text()
+		err := ReadLines(r, MaxLineLength, func(txt string) {
 			h.LogCallback(cleanupLine(txt))
 			ingest <- txt
-
+		})
+		if err != nil {
+			h.LogCallback(fmt.Sprintf("failed to read command output: %s", err))
 		}
 		wg.Done()
 	}
@@ -46,7 +51,7 @@ func (h *LoggerHandler) IngestReaders(done chan<- struct{}, stdout io.Reader, st
 
 	go func() {
 		for line := range ingest {
-			h.lines = append(h.lines, line)
+			h.Output.Add(line)
 		}
 		close(done)
 	}()
@@ -55,5 +60,19 @@ func (h *LoggerHandler) IngestReaders(done chan<- struct{}, stdout io.Reader, st
 }
 
 func (h *LoggerHandler) AugmentError(err error) error {
-	return fmt.Errorf("\n%s\n%w", strings.Join(h.lines, "\n"), err)
+	if h.Output == nil {
+		return err
+	}
+
+	return fmt.Errorf("\n%s%w", h.Output.Summary(), err)
+}
+
+// Close finishes with the output, keeping the spooled copy if keepLog
+// is set.
+func (h *LoggerHandler) Close(keepLog bool) error {
+	if h.Output == nil {
+		return nil
+	}
+
+	return h.Output.Close(keepLog)
 }
@@ -0,0 +1,25 @@
+package deployer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoggerHandlerDefaultOutput(t *testing.T) {
+	var logged []string
+
+	h := &LoggerHandler{LogCallback: func(s string) { logged = append(logged, s) }}
+
+	done := make(chan struct{})
+	require.NoError(t, h.IngestReaders(done, strings.NewReader("out\n"), strings.NewReader("")))
+	<-done
+
+	assert.Equal(t, []string{"out"}, logged)
+	assert.Equal(t, []string{"out"}, h.Output.Lines())
+
+	// Nothing is spooled, as nothing would close the file.
+	assert.Equal(t, "", h.Output.Path())
+}
@@ -0,0 +1,164 @@
+package deployer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	// DefaultOutputHeadLines is how many of the first lines of output
+	// are kept by default.
+	DefaultOutputHeadLines = 20
+
+	// DefaultOutputTailLines is how many of the last lines of output
+	// are kept, and shown when a command fails, by default.
+	DefaultOutputTailLines = 50
+)
+
+// OutputBuffer keeps the first and last lines of a command's output,
+// so a long run doesn't hold all of it in memory, and can spool all of
+// it to a local file.
+type OutputBuffer struct {
+	head, tail int
+
+	first []string
+
+	// last is a ring of the latest lines, with the oldest at next
+	// once it's full.
+	last []string
+	next int
+
+	total int
+
+	spool    *os.File
+	spoolErr error
+}
+
+// NewOutputBuffer returns a buffer that keeps the first head and last
+// tail lines.
+func NewOutputBuffer(head, tail int) *OutputBuffer {
+	return &OutputBuffer{head: max(head, 0), tail: max(tail, 0)}
+}
+
+// Spool writes every line from now on to a new file in dir, or the
+// default temporary directory if dir is "".
+func (b *OutputBuffer) Spool(dir string) error {
+	f, err := os.CreateTemp(dir, "runner-*.log")
+	if err != nil {
+		return fmt.Errorf("failed to create output log: %w", err)
+	}
+
+	b.spool = f
+
+	return nil
+}
+
+// Add records a line of output.
+func (b *OutputBuffer) Add(line string) {
+	b.total++
+
+	if b.spool != nil && b.spoolErr == nil {
+		_, b.spoolErr = fmt.Fprintln(b.spool, line)
+	}
+
+	switch {
+	case len(b.first) < b.head:
+		b.first = append(b.first, line)
+	case b.tail == 0:
+	case len(b.last) < b.tail:
+		b.last = append(b.last, line)
+	default:
+		b.last[b.next] = line
+		b.next = (b.next + 1) % b.tail
+	}
+}
+
+// Len is how many lines have been added.
+func (b *OutputBuffer) Len() int {
+	return b.total
+}
+
+// Omitted is how many lines were added but not kept.
+func (b *OutputBuffer) Omitted() int {
+	return b.total - len(b.first) - len(b.last)
+}
+
+func (b *OutputBuffer) ring() []string {
+	return append(append([]string{}, b.last[b.next:]...), b.last[:b.next]...)
+}
+
+// Lines returns the lines kept, with a note of how many were left out
+// between the first and last of them.
+func (b *OutputBuffer) Lines() []string {
+	lines := append([]string{}, b.first...)
+
+	if n := b.Omitted(); n > 0 {
+		lines = append(lines, fmt.Sprintf("... %d lines omitted ...", n))
+	}
+
+	return append(lines, b.ring()...)
+}
+
+// Tail returns up to the last n lines.
+func (b *OutputBuffer) Tail(n int) []string {
+	lines := b.ring()
+
+	if b.Omitted() == 0 {
+		lines = append(append([]string{}, b.first...), lines...)
+	}
+
+	return lines[max(len(lines)-n, 0):]
+}
+
+// Path returns the file the output is spooled to, or "" if it isn't.
+func (b *OutputBuffer) Path() string {
+	if b.spool == nil {
+		return ""
+	}
+
+	return b.spool.Name()
+}
+
+// Summary is the last lines of output, and where to find the rest,
+// for an error message.
+func (b *OutputBuffer) Summary() string {
+	var s strings.Builder
+
+	lines := b.Tail(b.tail)
+
+	if n := b.total - len(lines); n > 0 {
+		fmt.Fprintf(&s, "... last %d of %d lines ...\n", len(lines), b.total)
+	}
+
+	for _, line := range lines {
+		s.WriteString(line)
+		s.WriteString("\n")
+	}
+
+	if path := b.Path(); path != "" {
+		if b.spoolErr != nil {
+			fmt.Fprintf(&s, "full output (incomplete, %s): %s\n", b.spoolErr, path)
+		} else {
+			fmt.Fprintf(&s, "full output: %s\n", path)
+		}
+	}
+
+	return s.String()
+}
+
+// Close closes the spool file, removing it unless keep is set.
+func (b *OutputBuffer) Close(keep bool) error {
+	if b.spool == nil {
+		return nil
+	}
+
+	err := b.spool.Close()
+
+	if !keep {
+		err = errors.Join(err, os.Remove(b.spool.Name()))
+	}
+
+	return err
+}
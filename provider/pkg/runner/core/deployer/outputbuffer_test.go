@@ -0,0 +1,60 @@
+package deployer
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutputBuffer(t *testing.T) {
+	b := NewOutputBuffer(2, 3)
+
+	for i := range 4 {
+		b.Add(fmt.Sprint(i))
+	}
+
+	assert.Equal(t, 0, b.Omitted())
+	assert.Equal(t, []string{"0", "1", "2", "3"}, b.Lines())
+	assert.Equal(t, []string{"1", "2", "3"}, b.Tail(3))
+	assert.Equal(t, "... last 3 of 4 lines ...\n1\n2\n3\n", b.Summary())
+
+	for i := 4; i < 10; i++ {
+		b.Add(fmt.Sprint(i))
+	}
+
+	assert.Equal(t, 10, b.Len())
+	assert.Equal(t, 5, b.Omitted())
+	assert.Equal(t, []string{"0", "1", "... 5 lines omitted ...", "7", "8", "9"}, b.Lines())
+	assert.Equal(t, []string{"7", "8", "9"}, b.Tail(5))
+	assert.Equal(t, []string{"9"}, b.Tail(1))
+	assert.Equal(t, "... last 3 of 10 lines ...\n7\n8\n9\n", b.Summary())
+}
+
+func TestOutputBufferSpool(t *testing.T) {
+	dir := t.TempDir()
+
+	b := NewOutputBuffer(0, 1)
+	require.NoError(t, b.Spool(dir))
+
+	b.Add("first")
+	b.Add("second")
+
+	path := b.Path()
+	assert.Equal(t, "... last 1 of 2 lines ...\nsecond\nfull output: "+path+"\n", b.Summary())
+
+	require.NoError(t, b.Close(true))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "first\nsecond\n", string(data))
+
+	b = NewOutputBuffer(0, 1)
+	require.NoError(t, b.Spool(dir))
+	path = b.Path()
+	require.NoError(t, b.Close(false))
+	assert.NoFileExists(t, path)
+
+	assert.NoError(t, NewOutputBuffer(1, 1).Close(false))
+}
@@ -0,0 +1,298 @@
+package deployer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/kballard/go-shellquote"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// RemoteFileInfo describes a file on the remote host.
+type RemoteFileInfo struct {
+	Path  string
+	Mode  fs.FileMode
+	Size  int64
+	Owner string
+	Group string
+}
+
+func withSFTP(client *ssh.Client, f func(*sftp.Client) error) (err error) {
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		return fmt.Errorf("failed to create SFTP client: %w", err)
+	}
+
+	defer func() {
+		err = errors.Join(err, sftpClient.Close())
+	}()
+
+	return f(sftpClient)
+}
+
+func statRemoteFile(client *ssh.Client, sftpClient *sftp.Client, path string) (info RemoteFileInfo, err error) {
+	fi, err := sftpClient.Stat(path)
+	if err != nil {
+		return info, fmt.Errorf("failed to stat remote file %s: %w", path, err)
+	}
+
+	if !fi.Mode().IsRegular() {
+		return info, fmt.Errorf("remote path %s is not a regular file", path)
+	}
+
+	info = RemoteFileInfo{
+		Path: path,
+		Mode: fi.Mode().Perm(),
+		Size: fi.Size(),
+	}
+
+	info.Owner, info.Group, err = getFileOwner(client, path)
+
+	return info, err
+}
+
+// ReadRemoteFile reads a file from the remote host over SFTP.  Files
+// larger than limit bytes are rejected.
+func ReadRemoteFile(client *ssh.Client, path string, limit int64) (info RemoteFileInfo, contents []byte, err error) {
+	err = withSFTP(client, func(sftpClient *sftp.Client) (err error) {
+		info, err = statRemoteFile(client, sftpClient, path)
+		if err != nil {
+			return err
+		}
+
+		if info.Size > limit {
+			return fmt.Errorf("remote file %s is %d bytes, over the limit of %d bytes", path, info.Size, limit)
+		}
+
+		f, err := sftpClient.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open remote file %s: %w", path, err)
+		}
+
+		defer func() {
+			err = errors.Join(err, f.Close())
+		}()
+
+		// The file may have grown since it was stat'd.
+		contents, err = io.ReadAll(io.LimitReader(f, limit+1))
+		if err != nil {
+			return fmt.Errorf("failed to read remote file %s: %w", path, err)
+		}
+
+		if int64(len(contents)) > limit {
+			return fmt.Errorf("remote file %s is over the limit of %d bytes", path, limit)
+		}
+
+		info.Size = int64(len(contents))
+
+		return nil
+	})
+
+	return info, contents, err
+}
+
+// HashRemoteFile returns information about a file on the remote host,
+// along with the hex encoded SHA-256 of its contents.  If the file
+// doesn't exist, the error satisfies errors.Is(err, fs.ErrNotExist).
+func HashRemoteFile(client *ssh.Client, path string) (info RemoteFileInfo, sum string, err error) {
+	err = withSFTP(client, func(sftpClient *sftp.Client) (err error) {
+		info, err = statRemoteFile(client, sftpClient, path)
+		if err != nil {
+			return err
+		}
+
+		sum, err = hashRemoteFile(sftpClient, path)
+		return err
+	})
+
+	return info, sum, err
+}
+
+// WriteRemoteFile replaces a file on the remote host with the contents
+// of r.  The contents are written to a temporary file next to it, given
+// its mode and ownership, and then renamed into place, so readers never
+// see a partial file.  Empty owner and group values are left as the
+// connecting user's.
+func WriteRemoteFile(client *ssh.Client, path string, r io.Reader, mode fs.FileMode, owner, group string) error {
+	return withSFTP(client, func(sftpClient *sftp.Client) error {
+		return writeRemoteFile(client, sftpClient, path, r, mode, owner, group)
+	})
+}
+
+func writeRemoteFile(client *ssh.Client, sftpClient *sftp.Client, path string, r io.Reader, mode fs.FileMode, owner, group string) (err error) {
+	tmpPath := fmt.Sprintf("%s.runner-%d", path, rand.Int())
+
+	f, err := sftpClient.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create remote file %s: %w", tmpPath, err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = sftpClient.Remove(tmpPath)
+		}
+	}()
+
+	err = f.Chmod(mode)
+	if err == nil {
+		_, err = io.Copy(f, r)
+	}
+
+	if err = errors.Join(err, f.Close()); err != nil {
+		return fmt.Errorf("failed to write to remote file %s: %w", tmpPath, err)
+	}
+
+	if err = ChownRemoteFile(client, tmpPath, owner, group); err != nil {
+		return err
+	}
+
+	if err = sftpClient.PosixRename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to move remote file into place at %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// LinkRemoteFile creates a hard link to a file on the remote host.
+func LinkRemoteFile(client *ssh.Client, from, to string) error {
+	return withSFTP(client, func(sftpClient *sftp.Client) error {
+		if err := sftpClient.Link(from, to); err != nil {
+			return fmt.Errorf("failed to link remote file %s to %s: %w", from, to, err)
+		}
+
+		return nil
+	})
+}
+
+// RenameRemoteFile moves a file on the remote host, replacing any file
+// already at the destination.
+func RenameRemoteFile(client *ssh.Client, from, to string) error {
+	return withSFTP(client, func(sftpClient *sftp.Client) error {
+		if err := sftpClient.PosixRename(from, to); err != nil {
+			return fmt.Errorf("failed to rename remote file %s to %s: %w", from, to, err)
+		}
+
+		return nil
+	})
+}
+
+// RemoveRemoteFile removes a file from the remote host.  It isn't an
+// error for the file not to exist.
+func RemoveRemoteFile(client *ssh.Client, path string) error {
+	return withSFTP(client, func(sftpClient *sftp.Client) error {
+		if err := sftpClient.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove remote file %s: %w", path, err)
+		}
+
+		return nil
+	})
+}
+
+// ChownRemoteFile changes the owner and/or group of a file on the remote
+// host.  Empty values are left unchanged.
+func ChownRemoteFile(client *ssh.Client, path, owner, group string) (err error) {
+	if owner == "" && group == "" {
+		return nil
+	}
+
+	spec := owner
+	if group != "" {
+		spec += ":" + group
+	}
+
+	execSession, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to create SSH session: %w", err)
+	}
+
+	defer func() {
+		if closeErr := execSession.Close(); closeErr != io.EOF {
+			err = errors.Join(err, closeErr)
+		}
+	}()
+
+	out, err := execSession.CombinedOutput(shellquote.Join("chown", spec, path))
+	if err != nil {
+		return fmt.Errorf("remote chown of %s failed (output: %q): %w", path, out, err)
+	}
+
+	return nil
+}
+
+func getFileOwner(client *ssh.Client, path string) (owner, group string, err error) {
+	execSession, err := client.NewSession()
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if closeErr := execSession.Close(); closeErr != io.EOF {
+			err = errors.Join(err, closeErr)
+		}
+	}()
+
+	out, err := execSession.CombinedOutput("stat -c '%U:%G' " + shellquote.Join(path))
+	if err != nil {
+		return "", "", fmt.Errorf("remote stat failed (output: %q): %w", out, err)
+	}
+
+	owner, group, ok := strings.Cut(strings.TrimSpace(string(out)), ":")
+	if !ok {
+		return "", "", fmt.Errorf("invalid output from remote stat (got %q)", string(out))
+	}
+
+	return owner, group, nil
+}
+
+// RemoteUID returns the user ID commands run as on the remote host.
+func RemoteUID(client *ssh.Client) (uid int, err error) {
+	execSession, err := client.NewSession()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create SSH session: %w", err)
+	}
+
+	defer func() {
+		if closeErr := execSession.Close(); closeErr != io.EOF {
+			err = errors.Join(err, closeErr)
+		}
+	}()
+
+	out, err := execSession.CombinedOutput("id -u")
+	if err != nil {
+		return 0, fmt.Errorf("remote id failed (output: %q): %w", out, err)
+	}
+
+	uid, err = strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid output from remote id (got %q)", string(out))
+	}
+
+	return uid, nil
+}
+
+// RemoteFileExists reports whether anything exists at path on the remote
+// host.
+func RemoteFileExists(client *ssh.Client, path string) (exists bool, err error) {
+	err = withSFTP(client, func(sftpClient *sftp.Client) error {
+		_, err := sftpClient.Lstat(path)
+
+		switch {
+		case err == nil:
+			exists = true
+		case errors.Is(err, fs.ErrNotExist):
+			exists = false
+		default:
+			return fmt.Errorf("failed to stat remote file %s: %w", path, err)
+		}
+
+		return nil
+	})
+
+	return exists, err
+}
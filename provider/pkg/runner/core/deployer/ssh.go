@@ -4,16 +4,31 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 	"text/template"
 
 	"github.com/abklabs/pulumi-runner/pkg/runner/core/payload"
+	"github.com/kballard/go-shellquote"
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 )
 
-var runWrapperTemplate = template.Must(template.New("runWrapper").Parse(`ret=0 ; ( set -euo pipefail ; cd {{ .RootPath }} ; {{ .Cmd }} ; ) || ret=$? ; {{ if not .KeepPayload }} rm -rf {{ .RootPath }} ; {{ end }} exit $ret`))
+var runWrapperTemplate = template.Must(template.New("runWrapper").Parse(`ret=0 ; ( set -euo pipefail ; cd {{ .RootPath }} ; {{ if .SecretEnv }}export RUNNER_SECRET_STDIN=1 ; {{ end }}{{ .Cmd }} ; ) || ret=$? ; {{ if .SecretsPath }} find {{ .SecretsPath }} -type f -exec shred -u {} + 2>/dev/null ; rm -rf {{ .SecretsPath }} ; {{ end }}{{ if not .KeepPayload }} rm -rf {{ .RootPath }} ; {{ end }} exit $ret`))
+
+// SecretsDir is the tmpfs secret payload files are placed under, rather
+// than with the rest of the payload, so they never touch the disk.
+// They're linked to from where they'd otherwise be, and shredded once
+// the command has run, even if the payload is kept.
+const SecretsDir = "/dev/shm"
+
+// secretsFilesystems are the filesystem types, as stat -f reports them,
+// that are held in memory, and so can hold secret files.
+var secretsFilesystems = []string{"tmpfs", "ramfs"}
 
 type DeployerHandler interface {
 	// IngestReaders is responsible for keeping the readers drained.
@@ -27,6 +42,27 @@ type SSH struct {
 	Payload     *payload.Payload
 	Client      *ssh.Client
 	KeepPayload bool
+
+	// ForwardAgent requests agent forwarding for the command's session.
+	// The agent must already be set up on Client, with
+	// agent.ForwardToAgent, which can only be done once per client.
+	ForwardAgent bool
+
+	// SecretEnv, if set, is sent to the command's standard input as
+	// exports, which run.sh evaluates when RUNNER_SECRET_STDIN is set.
+	SecretEnv io.Reader
+}
+
+// secretsPath is where the payload's secret files go, or "" if it has
+// none.
+func (p *SSH) secretsPath() string {
+	for _, f := range p.Payload.Files {
+		if f.Secret {
+			return path.Join(SecretsDir, path.Base(p.Payload.RootPath))
+		}
+	}
+
+	return ""
 }
 
 func (p *SSH) Deploy(statusCallback ProgressStatusCallback) (err error) {
@@ -39,9 +75,38 @@ func (p *SSH) Deploy(statusCallback ProgressStatusCallback) (err error) {
 		err = errors.Join(err, sftpClient.Close())
 	}()
 
+	secrets := p.secretsPath()
+
+	if secrets != "" {
+		if err := p.mkdirSecrets(sftpClient, secrets); err != nil {
+			return err
+		}
+
+		// The run wrapper removes the secrets, but it won't run if
+		// this fails.
+		defer func() {
+			if err != nil {
+				err = errors.Join(err, removeSecrets(sftpClient, secrets))
+			}
+		}()
+	}
+
 	for _, f := range p.Payload.Files {
 		path := filepath.Join(p.Payload.RootPath, f.Path)
 
+		if f.Secret {
+			if err := sftpClient.MkdirAll(filepath.Dir(path)); err != nil {
+				return fmt.Errorf("failed to create remote directory for %s: %w", path, err)
+			}
+
+			link := path
+			path = filepath.Join(secrets, f.Path)
+
+			if err := sftpClient.Symlink(path, link); err != nil {
+				return fmt.Errorf("failed to link %s to secret file %s: %w", link, path, err)
+			}
+		}
+
 		dir := filepath.Dir(path)
 		parentDir := filepath.Dir(dir)
 
@@ -87,16 +152,147 @@ func (p *SSH) Deploy(statusCallback ProgressStatusCallback) (err error) {
 	return nil
 }
 
+// mkdirSecrets creates the directory for the secret files, readable
+// only by the user from the start, and checks it's held in memory.
+// SFTP can't give a new directory a mode, or say what filesystem it's
+// on, so that's done over sessions instead.
+func (p *SSH) mkdirSecrets(sftpClient *sftp.Client, secrets string) (err error) {
+	if out, err := p.combinedOutput("mkdir -m 700 -- " + shellquote.Join(secrets)); err != nil {
+		return fmt.Errorf("failed to create %s for secret files (output: %q): %w", secrets, out, err)
+	}
+
+	out, err := p.combinedOutput("stat -f -c %T -- " + shellquote.Join(secrets))
+	if err != nil {
+		return errors.Join(
+			fmt.Errorf("failed to check the filesystem of %s (output: %q): %w", secrets, out, err),
+			sftpClient.RemoveAll(secrets))
+	}
+
+	if fsType := strings.TrimSpace(string(out)); !slices.Contains(secretsFilesystems, fsType) {
+		return errors.Join(
+			fmt.Errorf("%s for secret files is on %s, not one of %s, so they'd be written to disk", secrets, fsType, strings.Join(secretsFilesystems, ", ")),
+			sftpClient.RemoveAll(secrets))
+	}
+
+	info, err := sftpClient.Lstat(secrets)
+	if err != nil {
+		return errors.Join(
+			fmt.Errorf("failed to check %s: %w", secrets, err),
+			sftpClient.RemoveAll(secrets))
+	}
+
+	if !info.IsDir() || info.Mode().Perm() != 0700 {
+		return errors.Join(
+			fmt.Errorf("%s for secret files was created with mode %s, not a directory with mode 0700", secrets, info.Mode()),
+			sftpClient.RemoveAll(secrets))
+	}
+
+	return nil
+}
+
+// combinedOutput runs cmd in a session of its own.
+func (p *SSH) combinedOutput(cmd string) (out []byte, err error) {
+	execSession, err := p.Client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SSH session: %w", err)
+	}
+
+	defer func() {
+		if closeErr := execSession.Close(); closeErr != io.EOF {
+			err = errors.Join(err, closeErr)
+		}
+	}()
+
+	return execSession.CombinedOutput(cmd)
+}
+
+// removeSecrets overwrites the secret files with zeros and removes them,
+// as the run wrapper would have with shred.
+func removeSecrets(sftpClient *sftp.Client, secrets string) error {
+	var errs []error
+
+	walker := sftpClient.Walk(secrets)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if walker.Stat().Mode().IsRegular() {
+			errs = append(errs, zeroRemoteFile(sftpClient, walker.Path(), walker.Stat().Size()))
+		}
+	}
+
+	if err := sftpClient.RemoveAll(secrets); err != nil {
+		errs = append(errs, fmt.Errorf("failed to remove secret files in %s: %w", secrets, err))
+	}
+
+	return errors.Join(errs...)
+}
+
+func zeroRemoteFile(sftpClient *sftp.Client, path string, size int64) (err error) {
+	f, err := sftpClient.OpenFile(path, os.O_WRONLY)
+	if err != nil {
+		return fmt.Errorf("failed to open secret file %s: %w", path, err)
+	}
+
+	defer func() {
+		err = errors.Join(err, f.Close())
+	}()
+
+	if _, err := io.CopyN(f, zeros{}, size); err != nil {
+		return fmt.Errorf("failed to overwrite secret file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// zeros reads as an endless run of zero bytes.
+type zeros struct{}
+
+func (zeros) Read(b []byte) (int, error) {
+	clear(b)
+	return len(b), nil
+}
+
+// cleanupSecrets removes the secret files when the run wrapper, which
+// would have, never started.
+func (p *SSH) cleanupSecrets(secrets string) (err error) {
+	sftpClient, err := sftp.NewClient(p.Client)
+	if err != nil {
+		return fmt.Errorf("failed to create SFTP client to remove secret files: %w", err)
+	}
+
+	defer func() {
+		err = errors.Join(err, sftpClient.Close())
+	}()
+
+	return removeSecrets(sftpClient, secrets)
+}
+
 func (p *SSH) Run(cmdSegs []string, handler DeployerHandler) (err error) {
+	secrets := p.secretsPath()
+	started := false
+
+	defer func() {
+		if err != nil && !started && secrets != "" {
+			err = errors.Join(err, p.cleanupSecrets(secrets))
+		}
+	}()
+
 	runWrapper := &strings.Builder{}
 
 	err = runWrapperTemplate.Execute(runWrapper, struct {
 		*payload.Payload
 		KeepPayload bool
+		SecretsPath string
+		SecretEnv   bool
 		Cmd         string
 	}{
 		p.Payload,
 		p.KeepPayload,
+		secrets,
+		p.SecretEnv != nil,
 		strings.Join(cmdSegs, " "),
 	})
 
@@ -115,6 +311,14 @@ func (p *SSH) Run(cmdSegs []string, handler DeployerHandler) (err error) {
 		}
 	}()
 
+	if p.ForwardAgent {
+		if err := agent.RequestAgentForwarding(execSession); err != nil {
+			return fmt.Errorf("failed to request SSH agent forwarding: %w", err)
+		}
+	}
+
+	execSession.Stdin = p.SecretEnv
+
 	stdoutPipe, err := execSession.StdoutPipe()
 	if err != nil {
 		return fmt.Errorf("failed to get stdout pipe: %w", err)
@@ -129,6 +333,8 @@ func (p *SSH) Run(cmdSegs []string, handler DeployerHandler) (err error) {
 		return fmt.Errorf("failed to start command: %w", err)
 	}
 
+	started = true
+
 	done := make(chan struct{})
 
 	if err := handler.IngestReaders(done, stdoutPipe, stderrPipe); err != nil {
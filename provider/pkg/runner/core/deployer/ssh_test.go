@@ -0,0 +1,148 @@
+package deployer
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abklabs/pulumi-runner/pkg/runner/core/payload"
+	"github.com/abklabs/pulumi-runner/pkg/ssh/sshtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func TestRunForwardAgentTwice(t *testing.T) {
+	server := sshtest.NewServer(t)
+	client := server.Dial(t)
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	keyring := agent.NewKeyring()
+	require.NoError(t, keyring.Add(agent.AddedKey{PrivateKey: key}))
+	require.NoError(t, agent.ForwardToAgent(client, keyring))
+
+	d := SSH{Payload: &payload.Payload{RootPath: t.TempDir()}, Client: client, KeepPayload: true, ForwardAgent: true}
+
+	// Each run is a session of its own on the same client.
+	for range 2 {
+		require.NoError(t, d.Run([]string{"true"}, &LoggerHandler{Output: NewOutputBuffer(1, 1), LogCallback: func(string) {}}))
+	}
+
+	assert.Equal(t, []int{1, 1}, server.AgentKeys())
+}
+
+func TestSecretsPath(t *testing.T) {
+	p := &payload.Payload{RootPath: "/tmp/runner-1-2"}
+	p.AddString("run.sh", "")
+
+	d := SSH{Payload: p}
+	assert.Equal(t, "", d.secretsPath())
+
+	p.Add(payload.PayloadFile{Path: "keys/id.json", Reader: strings.NewReader("{}"), Secret: true})
+	assert.Equal(t, "/dev/shm/runner-1-2", d.secretsPath())
+}
+
+func TestRunWrapperSecrets(t *testing.T) {
+	render := func(secrets string, keep bool, secretEnv bool) string {
+		var b strings.Builder
+		require.NoError(t, runWrapperTemplate.Execute(&b, struct {
+			*payload.Payload
+			KeepPayload bool
+			SecretsPath string
+			SecretEnv   bool
+			Cmd         string
+		}{&payload.Payload{RootPath: "/tmp/runner-1-2"}, keep, secrets, secretEnv, "./run.sh"}))
+		return b.String()
+	}
+
+	plain := render("", false, false)
+	assert.NotContains(t, plain, "shred")
+	assert.NotContains(t, plain, "RUNNER_SECRET_STDIN")
+
+	// run.sh is only told to read its stdin when secrets are sent on it.
+	assert.Contains(t, render("", false, true), "cd /tmp/runner-1-2 ; export RUNNER_SECRET_STDIN=1 ; ./run.sh ;")
+
+	// Secrets are removed even when the payload is kept.
+	kept := render("/dev/shm/runner-1-2", true, false)
+	assert.Contains(t, kept, "find /dev/shm/runner-1-2 -type f -exec shred -u {} + 2>/dev/null ; rm -rf /dev/shm/runner-1-2 ;")
+	assert.NotContains(t, kept, "rm -rf /tmp/runner-1-2")
+	assert.True(t, strings.HasSuffix(kept, "exit $ret"))
+}
+
+// secretPayload returns a payload with a secret file, rooted so its
+// secrets go somewhere of the test's own under SecretsDir.
+func secretPayload(t *testing.T) *payload.Payload {
+	t.Helper()
+
+	if _, err := os.Stat(SecretsDir); err != nil {
+		t.Skipf("no %s: %s", SecretsDir, err)
+	}
+
+	root := filepath.Join(t.TempDir(), fmt.Sprintf("runner-%d-%d", os.Getpid(), time.Now().UnixNano()))
+	t.Cleanup(func() { _ = os.RemoveAll(filepath.Join(SecretsDir, filepath.Base(root))) })
+
+	p := &payload.Payload{RootPath: root}
+	p.Add(payload.PayloadFile{Path: "keys/id.json", Reader: strings.NewReader(`{"key":"hunter2"}`), Mode: 0600, Secret: true})
+
+	return p
+}
+
+func TestDeploySecrets(t *testing.T) {
+	server := sshtest.NewServer(t)
+
+	d := SSH{Payload: secretPayload(t), Client: server.Dial(t)}
+	require.NoError(t, d.Deploy(func(string, int, int, time.Time) {}))
+
+	info, err := os.Stat(d.secretsPath())
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+
+	data, err := os.ReadFile(filepath.Join(d.Payload.RootPath, "keys/id.json"))
+	require.NoError(t, err)
+	assert.Equal(t, `{"key":"hunter2"}`, string(data))
+
+	// An existing directory might not be the user's own.
+	assert.ErrorContains(t, d.Deploy(func(string, int, int, time.Time) {}), "failed to create "+d.secretsPath()+" for secret files")
+}
+
+func TestDeploySecretsRefusesDisk(t *testing.T) {
+	server := sshtest.NewServer(t)
+
+	d := SSH{Payload: secretPayload(t), Client: server.Dial(t)}
+
+	out, err := exec.Command("stat", "-f", "-c", "%T", SecretsDir).Output()
+	require.NoError(t, err)
+
+	// Whatever SecretsDir is on here, pretend it isn't held in memory.
+	orig := secretsFilesystems
+	secretsFilesystems = slices.DeleteFunc(slices.Clone(orig), func(s string) bool { return s == strings.TrimSpace(string(out)) })
+	t.Cleanup(func() { secretsFilesystems = orig })
+
+	err = d.Deploy(func(string, int, int, time.Time) {})
+	assert.ErrorContains(t, err, "so they'd be written to disk")
+	assert.NoDirExists(t, d.secretsPath())
+	assert.NoFileExists(t, filepath.Join(d.Payload.RootPath, "keys/id.json"))
+}
+
+func TestRunRemovesSecretsIfNotStarted(t *testing.T) {
+	server := sshtest.NewServer(t)
+
+	d := SSH{Payload: secretPayload(t), Client: server.Dial(t)}
+	require.NoError(t, d.Deploy(func(string, int, int, time.Time) {}))
+	require.DirExists(t, d.secretsPath())
+
+	server.Reject("exec")
+
+	err := d.Run([]string{"true"}, &LoggerHandler{LogCallback: func(string) {}})
+	assert.ErrorContains(t, err, "failed to start command")
+	assert.NoDirExists(t, d.secretsPath())
+}
@@ -0,0 +1,322 @@
+package deployer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// SyncFile describes a file in a directory tree being synced.  Path is
+// slash separated and relative to the root of the tree.
+type SyncFile struct {
+	Path   string
+	Mode   fs.FileMode
+	Size   int64
+	Sha256 string
+}
+
+// SyncResult describes the changes SyncDirectory made on the remote
+// host.
+type SyncResult struct {
+	Uploaded    []string
+	ModeChanged []string
+	Deleted     []string
+}
+
+func hashReader(r io.Reader) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func hashLocalFile(name string) (sum string, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+
+	defer func() {
+		err = errors.Join(err, f.Close())
+	}()
+
+	return hashReader(f)
+}
+
+func hashRemoteFile(sftpClient *sftp.Client, name string) (sum string, err error) {
+	f, err := sftpClient.Open(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to open remote file %s: %w", name, err)
+	}
+
+	defer func() {
+		err = errors.Join(err, f.Close())
+	}()
+
+	sum, err = hashReader(f)
+	if err != nil {
+		return "", fmt.Errorf("failed to read remote file %s: %w", name, err)
+	}
+
+	return sum, nil
+}
+
+// LocalTree lists the files under root, in lexical order.  Symbolic
+// links to files are followed; anything else that isn't a regular file
+// or directory is an error.
+func LocalTree(root string) (files []SyncFile, err error) {
+	err = filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("%s is not a regular file or directory", name)
+		}
+
+		sum, err := hashLocalFile(name)
+		if err != nil {
+			return fmt.Errorf("failed to hash %s: %w", name, err)
+		}
+
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, SyncFile{
+			Path:   filepath.ToSlash(rel),
+			Mode:   info.Mode().Perm(),
+			Size:   info.Size(),
+			Sha256: sum,
+		})
+
+		return nil
+	})
+
+	return files, err
+}
+
+// RemoteTree lists the regular files under root on the remote host, in
+// lexical order.  Only the files in managed are hashed; the others are
+// left out, unless listExtraneous is set, in which case they're listed
+// without a hash.  If root doesn't exist, the error satisfies
+// errors.Is(err, fs.ErrNotExist).
+func RemoteTree(client *ssh.Client, root string, managed map[string]bool, listExtraneous bool) (files []SyncFile, err error) {
+	err = withSFTP(client, func(sftpClient *sftp.Client) (err error) {
+		files, err = remoteTree(sftpClient, root, func(name string) (list, hash bool) {
+			return managed[name] || listExtraneous, managed[name]
+		})
+		return err
+	})
+
+	return files, err
+}
+
+// remoteTree lists the regular files under root, with include deciding
+// which of them to list and which to hash.
+func remoteTree(sftpClient *sftp.Client, root string, include func(name string) (list, hash bool)) (files []SyncFile, err error) {
+	root = path.Clean(root)
+
+	walker := sftpClient.Walk(root)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return nil, fmt.Errorf("failed to list remote directory %s: %w", walker.Path(), err)
+		}
+
+		info := walker.Stat()
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		f := SyncFile{
+			Path: strings.TrimPrefix(walker.Path(), root+"/"),
+			Mode: info.Mode().Perm(),
+			Size: info.Size(),
+		}
+
+		list, hash := include(f.Path)
+		if !list {
+			continue
+		}
+
+		if hash {
+			f.Sha256, err = hashRemoteFile(sftpClient, walker.Path())
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		files = append(files, f)
+	}
+
+	// Walk lists entries in the order the server gives them, so they're
+	// put in the order LocalTree lists them in, for comparison.
+	slices.SortFunc(files, func(a, b SyncFile) int {
+		return slices.Compare(strings.Split(a.Path, "/"), strings.Split(b.Path, "/"))
+	})
+
+	return files, nil
+}
+
+// SyncDirectory makes the directory remoteRoot on the remote host mirror
+// the local directory localRoot, uploading only the files whose contents
+// differ.  If deleteExtraneous is set, remote files that don't exist
+// locally are removed.  The local files are returned along with the
+// changes made.
+func SyncDirectory(client *ssh.Client, localRoot, remoteRoot string, deleteExtraneous bool) (files []SyncFile, result SyncResult, err error) {
+	files, err = LocalTree(localRoot)
+	if err != nil {
+		return nil, result, fmt.Errorf("failed to list local directory %s: %w", localRoot, err)
+	}
+
+	err = withSFTP(client, func(sftpClient *sftp.Client) error {
+		if err := sftpClient.MkdirAll(remoteRoot); err != nil {
+			return fmt.Errorf("failed to create remote directory %s: %w", remoteRoot, err)
+		}
+
+		remote, err := remoteTree(sftpClient, remoteRoot, func(string) (bool, bool) {
+			return true, false
+		})
+		if err != nil {
+			return err
+		}
+
+		existing := make(map[string]SyncFile, len(remote))
+		for _, f := range remote {
+			existing[f.Path] = f
+		}
+
+		for _, f := range files {
+			remotePath := path.Join(remoteRoot, f.Path)
+
+			// Only files of the same size need hashing to tell if
+			// they've changed.
+			if r, ok := existing[f.Path]; ok && r.Size == f.Size {
+				sum, err := hashRemoteFile(sftpClient, remotePath)
+				if err != nil {
+					return err
+				}
+
+				if sum == f.Sha256 {
+					if r.Mode != f.Mode {
+						if err := sftpClient.Chmod(remotePath, f.Mode); err != nil {
+							return fmt.Errorf("failed to change mode of remote file %s: %w", remotePath, err)
+						}
+
+						result.ModeChanged = append(result.ModeChanged, f.Path)
+					}
+
+					continue
+				}
+			}
+
+			if err := uploadFile(client, sftpClient, filepath.Join(localRoot, filepath.FromSlash(f.Path)), remotePath, f.Mode); err != nil {
+				return err
+			}
+
+			result.Uploaded = append(result.Uploaded, f.Path)
+		}
+
+		if !deleteExtraneous {
+			return nil
+		}
+
+		wanted := make(map[string]bool, len(files))
+		for _, f := range files {
+			wanted[f.Path] = true
+		}
+
+		for _, r := range remote {
+			if wanted[r.Path] {
+				continue
+			}
+
+			if err := removeSyncedFile(sftpClient, remoteRoot, r.Path, false); err != nil {
+				return err
+			}
+
+			result.Deleted = append(result.Deleted, r.Path)
+		}
+
+		return nil
+	})
+
+	return files, result, err
+}
+
+func uploadFile(client *ssh.Client, sftpClient *sftp.Client, localPath, remotePath string, mode fs.FileMode) (err error) {
+	if err := sftpClient.MkdirAll(path.Dir(remotePath)); err != nil {
+		return fmt.Errorf("failed to create remote directory for %s: %w", remotePath, err)
+	}
+
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err = errors.Join(err, f.Close())
+	}()
+
+	return writeRemoteFile(client, sftpClient, remotePath, f, mode, "", "")
+}
+
+// removeSyncedFile removes a file from a synced tree, along with any of
+// its parent directories that are left empty.  The root itself is only
+// removed if removeRoot is set.
+func removeSyncedFile(sftpClient *sftp.Client, root, name string, removeRoot bool) error {
+	remotePath := path.Join(root, name)
+
+	if err := sftpClient.Remove(remotePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove remote file %s: %w", remotePath, err)
+	}
+
+	root = path.Clean(root)
+
+	for dir := path.Dir(remotePath); dir != root || removeRoot; dir = path.Dir(dir) {
+		// Directories that still hold something fail to be removed,
+		// and so do all of their parents.
+		if err := sftpClient.RemoveDirectory(dir); err != nil || dir == root {
+			break
+		}
+	}
+
+	return nil
+}
+
+// RemoveTree removes the given files from the tree at root on the remote
+// host, along with any directories left empty, including root.
+func RemoveTree(client *ssh.Client, root string, files []SyncFile) error {
+	return withSFTP(client, func(sftpClient *sftp.Client) error {
+		for _, f := range files {
+			if err := removeSyncedFile(sftpClient, root, f.Path, true); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -82,6 +82,19 @@ func (e *EnvBuilder) Buffer() *bytes.Buffer {
 	return b
 }
 
+// Exports is like Buffer, but exports each variable.
+func (e *EnvBuilder) Exports() *bytes.Buffer {
+	b := bytes.NewBuffer(nil)
+
+	for _, value := range e.Args() {
+		b.WriteString("export ")
+		b.WriteString(value)
+		b.WriteString("\n")
+	}
+
+	return b
+}
+
 func (e *EnvBuilder) SetP(k string, v *string) {
 	if v == nil {
 		return
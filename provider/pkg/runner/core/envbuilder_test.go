@@ -53,3 +53,10 @@ func TestEnvBuilderArray(t *testing.T) {
 	b0.SetArray("MY_ARRAY", []string{"1", "2", "HEY YOU", "3"})
 	assert.Equal(t, `MY_ARRAY=(1 2 'HEY YOU' 3)`, b0.String())
 }
+
+func TestEnvBuilderExports(t *testing.T) {
+	b := NewEnvBuilder()
+	b.Set("TOKEN", "s3cret value")
+	b.Set("A", "1")
+	assert.Equal(t, "export TOKEN='s3cret value'\nexport A=1\n", b.Exports().String())
+}
@@ -12,6 +12,9 @@ type PayloadFile struct {
 	Path   string
 	Reader io.Reader
 	Mode   fs.FileMode
+
+	// Secret files are kept off the disk where the deployer can.
+	Secret bool
 }
 
 type Payload struct {
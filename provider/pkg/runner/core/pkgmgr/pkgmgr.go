@@ -0,0 +1,38 @@
+package pkgmgr
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Manager is a host's package manager.
+type Manager string
+
+const (
+	Apt Manager = "apt"
+	Dnf Manager = "dnf"
+)
+
+// The os-release IDs each manager is used for.  ID_LIKE is checked too,
+// so derivatives such as Linux Mint or AlmaLinux are covered.
+var managerIDs = map[Manager][]string{
+	Apt: {"debian", "ubuntu"},
+	Dnf: {"rhel", "fedora", "centos", "rocky", "almalinux", "ol", "amzn"},
+}
+
+// Detect returns the package manager for a host from its os-release
+// fields, looking at ID and then each of ID_LIKE in turn.
+func Detect(osRelease map[string]string) (Manager, error) {
+	ids := append([]string{osRelease["ID"]}, strings.Fields(osRelease["ID_LIKE"])...)
+
+	for _, id := range ids {
+		for _, m := range []Manager{Apt, Dnf} {
+			if slices.Contains(managerIDs[m], id) {
+				return m, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("no supported package manager for %q (ID_LIKE %q)", osRelease["ID"], osRelease["ID_LIKE"])
+}
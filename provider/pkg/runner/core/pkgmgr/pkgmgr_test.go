@@ -0,0 +1,31 @@
+package pkgmgr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		release map[string]string
+		want    Manager
+	}{
+		{map[string]string{"ID": "debian"}, Apt},
+		{map[string]string{"ID": "ubuntu", "ID_LIKE": "debian"}, Apt},
+		{map[string]string{"ID": "linuxmint", "ID_LIKE": "ubuntu debian"}, Apt},
+		{map[string]string{"ID": "rocky", "ID_LIKE": "rhel centos fedora"}, Dnf},
+		{map[string]string{"ID": "fedora"}, Dnf},
+		{map[string]string{"ID": "somethingnew", "ID_LIKE": "almalinux"}, Dnf},
+	}
+
+	for _, tt := range tests {
+		m, err := Detect(tt.release)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, m, tt.release["ID"])
+	}
+
+	_, err := Detect(map[string]string{"ID": "alpine"})
+	assert.ErrorContains(t, err, `no supported package manager for "alpine"`)
+}
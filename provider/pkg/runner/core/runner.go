@@ -2,12 +2,14 @@ package runner
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"strings"
 	"time"
 
 	"github.com/abklabs/pulumi-runner/pkg/runner/core/deployer"
+	"github.com/kballard/go-shellquote"
 
 	"golang.org/x/crypto/ssh"
 )
@@ -19,6 +21,35 @@ type Command interface {
 	Config() *Config
 }
 
+// Forwarder is implemented by commands that need connections forwarded
+// between the local and remote hosts while they run.
+type Forwarder interface {
+	Forwards() []deployer.Forward
+}
+
+// Fetcher is implemented by commands that download files from the
+// remote host after they run.  Fetched is called with the results once
+// the files have been downloaded.
+type Fetcher interface {
+	Fetches() []deployer.Fetch
+	Fetched([]deployer.FetchResult)
+}
+
+// Starter is implemented by commands that can start partway through
+// their steps.  StartStep returns the name of the step function to
+// start from, without the "step::" prefix, or "" to run them all.
+type Starter interface {
+	StartStep() string
+}
+
+// SecretEnver is implemented by commands with environment variables
+// that mustn't be written to the host's disk.  They're sent over the
+// command's stdin rather than in the payload, and exported by run.sh
+// when the run wrapper sets RUNNER_SECRET_STDIN.
+type SecretEnver interface {
+	SecretEnv() *EnvBuilder
+}
+
 func NewRunner(client *ssh.Client, cmd Command) *Runner {
 	return &Runner{client: client, command: cmd}
 }
@@ -26,13 +57,24 @@ func NewRunner(client *ssh.Client, cmd Command) *Runner {
 type Runner struct {
 	client  *ssh.Client
 	command Command
+	agent   bool
+}
+
+// ForwardAgent forwards the SSH agent to the command's session.  It must
+// already be set up on the client, as ssh.Connection.Dial does.
+func (r *Runner) ForwardAgent() {
+	r.agent = true
 }
 
 func PrepareCommandPayload(p *Payload, command Command) error {
+	return prepareCommandPayload(p, command, command.Env())
+}
+
+func prepareCommandPayload(p *Payload, command Command, env *EnvBuilder) error {
 	p.Add(PayloadFile{Path: "opsh", Reader: strings.NewReader(OPSH), Mode: 0755})
 	p.AddString("lib.bash", LibBash)
 	p.Add(PayloadFile{Path: "run.sh", Reader: strings.NewReader(RunScript), Mode: 0755})
-	p.AddReader("env", command.Env().Buffer())
+	p.AddReader("env", env.Buffer())
 
 	if err := command.AddToPayload(p); err != nil {
 		return err
@@ -41,13 +83,28 @@ func PrepareCommandPayload(p *Payload, command Command) error {
 	return nil
 }
 
-func (r *Runner) Run(ctx context.Context, handler deployer.DeployerHandler, statusCallback deployer.ProgressStatusCallback) error {
+func (r *Runner) Run(ctx context.Context, handler deployer.DeployerHandler, statusCallback deployer.ProgressStatusCallback) (err error) {
 	p := &Payload{
 		RootPath:    fmt.Sprintf("/tmp/runner-%d-%d", time.Now().Unix(), rand.Int()),
 		DefaultMode: 0640,
 	}
 
-	if err := PrepareCommandPayload(p, r.command); err != nil {
+	env := r.command.Env()
+
+	if f, ok := r.command.(Forwarder); ok && len(f.Forwards()) != 0 {
+		forwards, err := deployer.StartForwards(r.client, f.Forwards())
+		if err != nil {
+			return err
+		}
+
+		defer func() {
+			err = errors.Join(err, forwards.Close())
+		}()
+
+		env.SetMap(forwards.Addresses())
+	}
+
+	if err := prepareCommandPayload(p, r.command, env); err != nil {
 		return err
 	}
 
@@ -59,14 +116,52 @@ func (r *Runner) Run(ctx context.Context, handler deployer.DeployerHandler, stat
 		}
 	}
 
-	d := deployer.SSH{Payload: p, Client: r.client, KeepPayload: keepPayload}
+	var fetches []deployer.Fetch
+
+	fetcher, ok := r.command.(Fetcher)
+	if ok {
+		fetches = fetcher.Fetches()
+	}
+
+	// Files are fetched after the command has run, so the payload has
+	// to outlive the run wrapper.
+	d := deployer.SSH{Payload: p, Client: r.client, KeepPayload: keepPayload || len(fetches) != 0, ForwardAgent: r.agent}
+
+	// run.sh only reads its stdin if there's something to read.
+	if s, ok := r.command.(SecretEnver); ok {
+		if env := s.SecretEnv(); len(env.Map()) != 0 {
+			d.SecretEnv = env.Exports()
+		}
+	}
+
+	if len(fetches) != 0 && !keepPayload {
+		defer func() {
+			err = errors.Join(err, d.Cleanup())
+		}()
+	}
+
 	if err := d.Deploy(statusCallback); err != nil {
 		return err
 	}
 
-	if err := d.Run([]string{"./run.sh"}, handler); err != nil {
+	cmdSegs := []string{"./run.sh"}
+
+	if s, ok := r.command.(Starter); ok && s.StartStep() != "" {
+		cmdSegs = append(cmdSegs, shellquote.Join(s.StartStep()))
+	}
+
+	if err := d.Run(cmdSegs, handler); err != nil {
 		return err
 	}
 
+	if len(fetches) != 0 {
+		results, err := d.Fetch(fetches)
+		if err != nil {
+			return err
+		}
+
+		fetcher.Fetched(results)
+	}
+
 	return nil
 }
@@ -0,0 +1,90 @@
+package runner
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abklabs/pulumi-runner/pkg/runner/core/deployer"
+	"github.com/abklabs/pulumi-runner/pkg/ssh/sshtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptCommand runs script as its steps.
+type scriptCommand struct {
+	script string
+}
+
+func (c *scriptCommand) Check() error     { return nil }
+func (c *scriptCommand) Env() *EnvBuilder { return NewEnvBuilder() }
+func (c *scriptCommand) Config() *Config  { return nil }
+
+func (c *scriptCommand) AddToPayload(p *Payload) error {
+	p.AddString(ScriptNameSteps, c.script)
+	return nil
+}
+
+// deployScript places the payload for script in a directory of its own.
+func deployScript(t *testing.T, script string) string {
+	t.Helper()
+
+	sshtest.StubSudo(t)
+
+	p := &Payload{RootPath: t.TempDir(), DefaultMode: 0640}
+	require.NoError(t, PrepareCommandPayload(p, &scriptCommand{script: script}))
+	require.NoError(t, (&deployer.Local{Payload: p, KeepPayload: true}).Deploy())
+
+	return p.RootPath
+}
+
+func TestRunScriptLeavesStdinAlone(t *testing.T) {
+	root := deployScript(t, "step::10-ran() { echo ran ; }\n")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// A pipe that's never closed, as a terminal would be.
+	stdin, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer stdin.Close()
+	defer w.Close()
+
+	_, err = io.WriteString(w, "hello\n")
+	require.NoError(t, err)
+
+	cmd := exec.CommandContext(ctx, "./run.sh")
+	cmd.Dir = root
+	cmd.Stdin = stdin
+	cmd.WaitDelay = time.Second
+
+	out, err := cmd.Output()
+	require.NoError(t, err)
+	assert.Equal(t, "ran\n", string(out))
+
+	// Nothing read what was waiting on stdin.
+	require.NoError(t, w.Close())
+	rest, err := io.ReadAll(stdin)
+	require.NoError(t, err)
+	assert.Equal(t, "hello\n", string(rest))
+}
+
+func TestRunScriptSecretStdin(t *testing.T) {
+	root := deployScript(t, "step::10-show() { echo \"$TOKEN\" ; }\n")
+
+	env := NewEnvBuilder()
+	env.Set("TOKEN", "s3cret value")
+
+	cmd := exec.Command("./run.sh")
+	cmd.Dir = root
+	cmd.Env = append(cmd.Environ(), "RUNNER_SECRET_STDIN=1")
+	cmd.Stdin = strings.NewReader(env.Exports().String())
+
+	out, err := cmd.Output()
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret value\n", string(out))
+}
@@ -0,0 +1,41 @@
+package runner
+
+import (
+	"strconv"
+	"strings"
+)
+
+// StepMarker prefixes the lines svmkit::run-step writes to stderr as a
+// step starts and ends, so handlers can follow a command's progress.
+const StepMarker = "::svmkit-step::"
+
+// StepEvent is a step starting, or ending with an exit code.
+type StepEvent struct {
+	Name     string
+	Start    bool
+	ExitCode int
+}
+
+// ParseStepMarker parses a line written by svmkit::run-step, which is
+// either "::svmkit-step:: start NAME" or "::svmkit-step:: end NAME CODE".
+func ParseStepMarker(line string) (StepEvent, bool) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(line), StepMarker)
+	if !ok {
+		return StepEvent{}, false
+	}
+
+	fields := strings.Fields(rest)
+
+	switch {
+	case len(fields) == 2 && fields[0] == "start":
+		return StepEvent{Name: fields[1], Start: true}, true
+	case len(fields) == 3 && fields[0] == "end":
+		code, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return StepEvent{}, false
+		}
+		return StepEvent{Name: fields[1], ExitCode: code}, true
+	}
+
+	return StepEvent{}, false
+}
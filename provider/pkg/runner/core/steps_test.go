@@ -0,0 +1,27 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStepMarker(t *testing.T) {
+	ev, ok := ParseStepMarker("::svmkit-step:: start 10-build")
+	assert.True(t, ok)
+	assert.Equal(t, StepEvent{Name: "10-build", Start: true}, ev)
+
+	ev, ok = ParseStepMarker("::svmkit-step:: end 10-build 2\n")
+	assert.True(t, ok)
+	assert.Equal(t, StepEvent{Name: "10-build", ExitCode: 2}, ev)
+
+	for _, line := range []string{
+		"running step 10-build",
+		"::svmkit-step:: end 10-build",
+		"::svmkit-step:: end 10-build x",
+		"::svmkit-step:: restart 10-build",
+	} {
+		_, ok := ParseStepMarker(line)
+		assert.False(t, ok, line)
+	}
+}
@@ -0,0 +1,50 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/abklabs/pulumi-runner/pkg/runner/core/deployer"
+)
+
+// FetchFile represents a file to download from the remote server after
+// the command has run
+type FetchFile struct {
+	// Remote path, either absolute or relative to the payload root
+	Path string `pulumi:"path"`
+
+	// Local destination for the file
+	LocalPath string `pulumi:"localPath"`
+}
+
+// FetchedFile represents a file that was downloaded after the command ran
+type FetchedFile struct {
+	Path      string `pulumi:"path"`
+	LocalPath string `pulumi:"localPath"`
+	Size      int    `pulumi:"size"`
+	Sha256    string `pulumi:"sha256"`
+}
+
+// Validate ensures the FetchFile is properly configured
+func (f *FetchFile) Validate() error {
+	var errs []error
+
+	if IsEmptyStr(&f.Path) {
+		errs = append(errs, fmt.Errorf("'Path' must be set for fetched files"))
+	}
+
+	if IsEmptyStr(&f.LocalPath) {
+		errs = append(errs, fmt.Errorf("'LocalPath' must be set for fetched file %q", f.Path))
+	}
+
+	return errors.Join(errs...)
+}
+
+func newFetchedFile(res deployer.FetchResult) FetchedFile {
+	return FetchedFile{
+		Path:      res.Remote,
+		LocalPath: res.Local,
+		Size:      int(res.Size),
+		Sha256:    res.Sha256,
+	}
+}
@@ -19,6 +19,9 @@ type FileAsset struct {
 
 	// File permissions mode (e.g., 0o0755)
 	Mode *int `pulumi:"mode,optional"`
+
+	// Keep the file off the host's disk, and remove it after the run
+	Secret *bool `pulumi:"secret,optional"`
 }
 
 // Validate ensures the FileAsset is properly configured
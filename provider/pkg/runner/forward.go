@@ -0,0 +1,68 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/abklabs/pulumi-runner/pkg/runner/core/deployer"
+)
+
+const (
+	ForwardTypeLocal  = "local"
+	ForwardTypeRemote = "remote"
+)
+
+var envNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Forward represents a connection forward set up for the duration of a
+// command.  Addresses are "host:port" for TCP or "unix:/path" for Unix
+// sockets.
+type Forward struct {
+	// Environment variable the bound listen address of a remote forward
+	// is exposed as
+	Name string `pulumi:"name"`
+
+	// "remote" listens on the remote host and connects from the local
+	// host; "local" listens locally and connects from the remote host
+	Type string `pulumi:"type"`
+
+	// Address to listen on; defaults to 127.0.0.1:0
+	Listen *string `pulumi:"listen,optional"`
+
+	// Address to connect to on the other side of the forward
+	Target string `pulumi:"target"`
+}
+
+// Validate ensures the Forward is properly configured
+func (f *Forward) Validate() error {
+	var errs []error
+
+	if !envNameRegexp.MatchString(f.Name) {
+		errs = append(errs, fmt.Errorf("forward name %q must be a valid environment variable name", f.Name))
+	}
+
+	if f.Type != ForwardTypeLocal && f.Type != ForwardTypeRemote {
+		errs = append(errs, fmt.Errorf("forward %s: 'Type' must be %q or %q", f.Name, ForwardTypeLocal, ForwardTypeRemote))
+	}
+
+	if IsEmptyStr(&f.Target) {
+		errs = append(errs, fmt.Errorf("forward %s: 'Target' must be set", f.Name))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (f *Forward) deployerForward() deployer.Forward {
+	listen := "127.0.0.1:0"
+	if !IsEmptyStr(f.Listen) {
+		listen = *f.Listen
+	}
+
+	return deployer.Forward{
+		Name:   f.Name,
+		Remote: f.Type == ForwardTypeRemote,
+		Listen: listen,
+		Target: f.Target,
+	}
+}
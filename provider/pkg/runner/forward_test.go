@@ -0,0 +1,50 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/abklabs/pulumi-runner/pkg/runner/core/deployer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForwardValidate(t *testing.T) {
+	fwd := Forward{Name: "ARTIFACTS", Type: ForwardTypeRemote, Target: "artifacts.internal:8080"}
+	assert.NoError(t, fwd.Validate())
+
+	fwd = Forward{Name: "BAD NAME", Type: "sideways"}
+	err := fwd.Validate()
+	assert.ErrorContains(t, err, `forward name "BAD NAME" must be a valid environment variable name`)
+	assert.ErrorContains(t, err, `'Type' must be "local" or "remote"`)
+	assert.ErrorContains(t, err, "'Target' must be set")
+}
+
+func TestForwardDeployerForward(t *testing.T) {
+	fwd := Forward{Name: "DB", Type: ForwardTypeLocal, Target: "unix:/run/db.sock"}
+	assert.Equal(t, deployer.Forward{
+		Name:   "DB",
+		Listen: "127.0.0.1:0",
+		Target: "unix:/run/db.sock",
+	}, fwd.deployerForward())
+
+	fwd = Forward{Name: "SIGNER", Type: ForwardTypeRemote, Listen: ptr("unix:/tmp/signer.sock"), Target: "127.0.0.1:9000"}
+	assert.Equal(t, deployer.Forward{
+		Name:   "SIGNER",
+		Remote: true,
+		Listen: "unix:/tmp/signer.sock",
+		Target: "127.0.0.1:9000",
+	}, fwd.deployerForward())
+}
+
+func TestSSHCommandForwards(t *testing.T) {
+	forwards := []Forward{
+		{Name: "ARTIFACTS", Type: ForwardTypeRemote, Target: "artifacts.internal:8080"},
+		{Name: "ARTIFACTS", Type: ForwardTypeLocal, Target: "127.0.0.1:22"},
+	}
+
+	cmd := NewSSHCommand("./start.sh", nil, nil, forwards, nil)
+	assert.ErrorContains(t, cmd.Check(), `duplicate forward name "ARTIFACTS"`)
+
+	assert.Len(t, cmd.Forwards(), 2)
+	assert.True(t, cmd.Forwards()[0].Remote)
+	assert.False(t, cmd.Forwards()[1].Remote)
+}
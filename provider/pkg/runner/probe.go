@@ -0,0 +1,35 @@
+package runner
+
+import (
+	"context"
+
+	"github.com/abklabs/pulumi-runner/pkg/runner/core/pkgmgr"
+	"github.com/abklabs/pulumi-runner/pkg/ssh"
+	"github.com/pulumi/pulumi-go-provider/infer"
+)
+
+type Probe struct{}
+
+func (p *Probe) Annotate(a infer.Annotator) {
+	a.Describe(&p, "Dial a connection and report details of the host, as a check before deploying to it.")
+	a.SetToken("ssh", "probe")
+}
+
+func (Probe) Call(ctx context.Context, input ssh.ProbeArgs) (ssh.ProbeResult, error) {
+	result, err := ssh.ProbeHost(ctx, input)
+	if err != nil {
+		return result, err
+	}
+
+	detectPackageManager(&result.Facts)
+
+	return result, nil
+}
+
+// detectPackageManager fills in the package manager from the host's
+// os-release, leaving it empty if there's no supported one.
+func detectPackageManager(facts *ssh.HostFacts) {
+	if m, err := pkgmgr.Detect(facts.OSRelease); err == nil {
+		facts.PackageManager = string(m)
+	}
+}
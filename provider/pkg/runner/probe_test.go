@@ -0,0 +1,18 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/abklabs/pulumi-runner/pkg/ssh"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectPackageManager(t *testing.T) {
+	facts := ssh.HostFacts{OSRelease: map[string]string{"ID": "rocky", "ID_LIKE": "rhel centos fedora"}}
+	detectPackageManager(&facts)
+	assert.Equal(t, "dnf", facts.PackageManager)
+
+	facts = ssh.HostFacts{OSRelease: map[string]string{"ID": "alpine"}}
+	detectPackageManager(&facts)
+	assert.Empty(t, facts.PackageManager)
+}
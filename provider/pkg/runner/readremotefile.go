@@ -0,0 +1,124 @@
+package runner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/abklabs/pulumi-runner/pkg/runner/core/deployer"
+	"github.com/abklabs/pulumi-runner/pkg/ssh"
+	"github.com/pulumi/pulumi-go-provider/infer"
+)
+
+const (
+	EncodingText   = "text"
+	EncodingBase64 = "base64"
+
+	defaultMaxRemoteFileSize = 1 << 20
+)
+
+type ReadRemoteFile struct{}
+
+type ReadRemoteFileArgs struct {
+	Connection ssh.Connection `pulumi:"connection"`
+	Path       string         `pulumi:"path"`
+	Encoding   *string        `pulumi:"encoding,optional"`
+	MaxSize    *int           `pulumi:"maxSize,optional"`
+	Secret     *bool          `pulumi:"secret,optional"`
+}
+
+func (r *ReadRemoteFileArgs) Annotate(a infer.Annotator) {
+	a.Describe(&r.Connection, "The connection to the host to read the file from.")
+	a.Describe(&r.Path, "The absolute path of the file on the host.")
+	a.Describe(&r.Encoding, "How to return the contents: \"text\" or \"base64\". Defaults to text.")
+	a.SetDefault(&r.Encoding, EncodingText)
+	a.Describe(&r.MaxSize, "Max size of the file in bytes. Larger files are rejected. Defaults to 1MiB.")
+	a.SetDefault(&r.MaxSize, defaultMaxRemoteFileSize)
+	a.Describe(&r.Secret, "Return the contents as a secret in secretContents instead of contents.")
+}
+
+type ReadRemoteFileResult struct {
+	Contents       *string `pulumi:"contents,optional"`
+	SecretContents *string `pulumi:"secretContents,optional" provider:"secret"`
+	Mode           int     `pulumi:"mode"`
+	Owner          string  `pulumi:"owner"`
+	Group          string  `pulumi:"group"`
+	Size           int     `pulumi:"size"`
+	Sha256         string  `pulumi:"sha256"`
+}
+
+func (r *ReadRemoteFileResult) Annotate(a infer.Annotator) {
+	a.Describe(&r.Contents, "The contents of the file, unless secret was set.")
+	a.Describe(&r.SecretContents, "The contents of the file, if secret was set.")
+	a.Describe(&r.Mode, "The permission bits of the file.")
+	a.Describe(&r.Owner, "The name of the user owning the file.")
+	a.Describe(&r.Group, "The name of the group owning the file.")
+	a.Describe(&r.Size, "The size of the file in bytes.")
+	a.Describe(&r.Sha256, "The hex encoded SHA-256 of the file's contents.")
+}
+
+func (r *ReadRemoteFile) Annotate(a infer.Annotator) {
+	a.Describe(&r, "Read a file off a remote host.")
+}
+
+func (ReadRemoteFile) Call(ctx context.Context, input ReadRemoteFileArgs) (result ReadRemoteFileResult, err error) {
+	encoding := EncodingText
+	if input.Encoding != nil {
+		encoding = *input.Encoding
+	}
+
+	if encoding != EncodingText && encoding != EncodingBase64 {
+		return result, fmt.Errorf("'Encoding' must be %q or %q", EncodingText, EncodingBase64)
+	}
+
+	maxSize := defaultMaxRemoteFileSize
+	if input.MaxSize != nil {
+		maxSize = *input.MaxSize
+	}
+
+	client, err := input.Connection.Dial(ctx)
+	if err != nil {
+		return result, fmt.Errorf("failed to dial SSH connection to host: %w", err)
+	}
+
+	defer func() {
+		err = errors.Join(err, client.Close())
+	}()
+
+	info, contents, err := deployer.ReadRemoteFile(client, input.Path, int64(maxSize))
+	if err != nil {
+		return result, err
+	}
+
+	var s string
+
+	switch encoding {
+	case EncodingText:
+		if !utf8.Valid(contents) {
+			return result, fmt.Errorf("remote file %s is not valid UTF-8 text; use the base64 encoding", input.Path)
+		}
+		s = string(contents)
+	case EncodingBase64:
+		s = base64.StdEncoding.EncodeToString(contents)
+	}
+
+	if input.Secret != nil && *input.Secret {
+		result.SecretContents = &s
+	} else {
+		result.Contents = &s
+	}
+
+	sum := sha256.Sum256(contents)
+
+	result.Mode = int(info.Mode)
+	result.Owner = info.Owner
+	result.Group = info.Group
+	result.Size = int(info.Size)
+	result.Sha256 = hex.EncodeToString(sum[:])
+
+	return result, nil
+}
@@ -0,0 +1,70 @@
+package runner
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/abklabs/pulumi-runner/pkg/ssh/sshtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadRemoteFile(t *testing.T) {
+	server := sshtest.NewServer(t)
+	dir := t.TempDir()
+
+	text := filepath.Join(dir, "config.json")
+	require.NoError(t, os.WriteFile(text, []byte(`{"ok":true}`), 0o640))
+
+	binary := filepath.Join(dir, "key.bin")
+	require.NoError(t, os.WriteFile(binary, []byte{0xff, 0x00, 0xfe}, 0o600))
+
+	read := func(args ReadRemoteFileArgs) (ReadRemoteFileResult, error) {
+		args.Connection = testConnection(t, server)
+		return ReadRemoteFile{}.Call(context.Background(), args)
+	}
+
+	res, err := read(ReadRemoteFileArgs{Path: text})
+	require.NoError(t, err)
+	assert.Equal(t, `{"ok":true}`, deref(res.Contents))
+	assert.Nil(t, res.SecretContents)
+	assert.Equal(t, 0o640, res.Mode)
+	assert.Equal(t, 11, res.Size)
+	assert.Equal(t, sha256Hex([]byte(`{"ok":true}`)), res.Sha256)
+	assert.NotEmpty(t, res.Owner)
+	assert.NotEmpty(t, res.Group)
+
+	// Binary contents have to be asked for as base64.
+	_, err = read(ReadRemoteFileArgs{Path: binary})
+	assert.ErrorContains(t, err, "not valid UTF-8 text; use the base64 encoding")
+
+	res, err = read(ReadRemoteFileArgs{Path: binary, Encoding: ptr(EncodingBase64)})
+	require.NoError(t, err)
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte{0xff, 0x00, 0xfe}), deref(res.Contents))
+	assert.Equal(t, sha256Hex([]byte{0xff, 0x00, 0xfe}), res.Sha256)
+
+	_, err = read(ReadRemoteFileArgs{Path: text, Encoding: ptr("hex")})
+	assert.ErrorContains(t, err, `'Encoding' must be "text" or "base64"`)
+
+	res, err = read(ReadRemoteFileArgs{Path: text, Secret: ptr(true)})
+	require.NoError(t, err)
+	assert.Nil(t, res.Contents)
+	assert.Equal(t, `{"ok":true}`, deref(res.SecretContents))
+
+	field, _ := reflect.TypeOf(res).FieldByName("SecretContents")
+	assert.Equal(t, "secret", field.Tag.Get("provider"))
+
+	_, err = read(ReadRemoteFileArgs{Path: text, MaxSize: ptr(10)})
+	assert.ErrorContains(t, err, "is 11 bytes, over the limit of 10 bytes")
+
+	res, err = read(ReadRemoteFileArgs{Path: text, MaxSize: ptr(11)})
+	require.NoError(t, err)
+	assert.Equal(t, 11, res.Size)
+
+	_, err = read(ReadRemoteFileArgs{Path: dir})
+	assert.ErrorContains(t, err, "is not a regular file")
+}
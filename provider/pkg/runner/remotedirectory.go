@@ -0,0 +1,241 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"reflect"
+	"slices"
+
+	"github.com/abklabs/pulumi-runner/pkg/runner/core/deployer"
+	"github.com/abklabs/pulumi-runner/pkg/ssh"
+	p "github.com/pulumi/pulumi-go-provider"
+	"github.com/pulumi/pulumi-go-provider/infer"
+	cryptossh "golang.org/x/crypto/ssh"
+)
+
+type RemoteDirectory struct{}
+
+type RemoteDirectoryArgs struct {
+	Connection       ssh.Connection `pulumi:"connection"`
+	Source           string         `pulumi:"source"`
+	Path             string         `pulumi:"path"`
+	DeleteExtraneous *bool          `pulumi:"deleteExtraneous,optional"`
+}
+
+func (r *RemoteDirectoryArgs) Annotate(a infer.Annotator) {
+	a.Describe(&r.Connection, "The connection to the host to sync the directory to.")
+	a.Describe(&r.Source, "The local directory to mirror.")
+	a.Describe(&r.Path, "The absolute path of the directory on the host.")
+	a.Describe(&r.DeleteExtraneous, "Remove files from the remote directory that don't exist locally.")
+}
+
+// SyncedFile represents a file that was synced to the remote directory
+type SyncedFile struct {
+	Path   string `pulumi:"path"`
+	Mode   int    `pulumi:"mode"`
+	Size   int    `pulumi:"size"`
+	Sha256 string `pulumi:"sha256"`
+}
+
+type RemoteDirectoryState struct {
+	RemoteDirectoryArgs
+	Files      []SyncedFile `pulumi:"files"`
+	Extraneous []string     `pulumi:"extraneous,optional"`
+}
+
+func (r *RemoteDirectoryState) Annotate(a infer.Annotator) {
+	a.Describe(&r.Files, "The manifest of files in the directory, relative to its path.")
+	a.Describe(&r.Extraneous, "Files found in the directory on refresh that would be deleted, relative to its path.")
+}
+
+func (r *RemoteDirectory) Annotate(a infer.Annotator) {
+	a.Describe(&r, "Keep a directory on a remote host in sync with a local one.")
+}
+
+// Validate ensures the RemoteDirectoryArgs are properly configured
+func (r *RemoteDirectoryArgs) Validate() error {
+	var errs []error
+
+	if IsEmptyStr(&r.Source) {
+		errs = append(errs, fmt.Errorf("'Source' must be set"))
+	}
+
+	if !path.IsAbs(r.Path) || path.Clean(r.Path) == "/" {
+		errs = append(errs, fmt.Errorf("'Path' must be an absolute path below / (got %q)", r.Path))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (r *RemoteDirectoryArgs) deleteExtraneous() bool {
+	return r.DeleteExtraneous != nil && *r.DeleteExtraneous
+}
+
+func newSyncedFiles(files []deployer.SyncFile) []SyncedFile {
+	synced := make([]SyncedFile, 0, len(files))
+
+	for _, f := range files {
+		synced = append(synced, SyncedFile{
+			Path:   f.Path,
+			Mode:   int(f.Mode),
+			Size:   int(f.Size),
+			Sha256: f.Sha256,
+		})
+	}
+
+	return synced
+}
+
+func (s *RemoteDirectoryState) syncFiles() []deployer.SyncFile {
+	files := make([]deployer.SyncFile, 0, len(s.Files))
+
+	for _, f := range s.Files {
+		files = append(files, deployer.SyncFile{
+			Path:   f.Path,
+			Mode:   fs.FileMode(f.Mode),
+			Size:   int64(f.Size),
+			Sha256: f.Sha256,
+		})
+	}
+
+	return files
+}
+
+// sync mirrors the source directory to the host, returning the manifest.
+// During preview the manifest is taken from the source alone.
+func (r *RemoteDirectoryArgs) sync(ctx context.Context, preview bool) ([]SyncedFile, error) {
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+
+	if preview {
+		files, err := deployer.LocalTree(r.Source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list local directory %s: %w", r.Source, err)
+		}
+
+		return newSyncedFiles(files), nil
+	}
+
+	var (
+		files  []deployer.SyncFile
+		result deployer.SyncResult
+	)
+
+	err := withClient(ctx, r.Connection, func(client *cryptossh.Client) (err error) {
+		files, result, err = deployer.SyncDirectory(client, r.Source, r.Path, r.deleteExtraneous())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	p.GetLogger(ctx).Infof("synced %s: %d uploaded, %d mode changed, %d deleted",
+		r.Path, len(result.Uploaded), len(result.ModeChanged), len(result.Deleted))
+
+	return newSyncedFiles(files), nil
+}
+
+func (RemoteDirectory) Create(ctx context.Context, name string, input RemoteDirectoryArgs, preview bool) (string, RemoteDirectoryState, error) {
+	state := RemoteDirectoryState{RemoteDirectoryArgs: input}
+
+	files, err := input.sync(ctx, preview)
+	if err != nil {
+		return "", state, err
+	}
+
+	state.Files = files
+
+	return name, state, nil
+}
+
+func (RemoteDirectory) Diff(ctx context.Context, id string, olds RemoteDirectoryState, news RemoteDirectoryArgs) (p.DiffResponse, error) {
+	diff := map[string]p.PropertyDiff{}
+
+	if path.Clean(olds.Path) != path.Clean(news.Path) {
+		diff["path"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+
+	if deref(olds.Connection.Host) != deref(news.Connection.Host) {
+		diff["connection"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	} else if !reflect.DeepEqual(olds.Connection, news.Connection) {
+		diff["connection"] = p.PropertyDiff{Kind: p.Update}
+	}
+
+	// A source that can't be listed is reported as a change, so that the
+	// error surfaces during the update.
+	files, err := deployer.LocalTree(news.Source)
+	if err != nil || !slices.Equal(newSyncedFiles(files), olds.Files) {
+		diff["source"] = p.PropertyDiff{Kind: p.Update}
+	}
+
+	if olds.deleteExtraneous() != news.deleteExtraneous() {
+		diff["deleteExtraneous"] = p.PropertyDiff{Kind: p.Update}
+	} else if news.deleteExtraneous() && len(olds.Extraneous) > 0 {
+		diff["extraneous"] = p.PropertyDiff{Kind: p.Update}
+	}
+
+	return p.DiffResponse{
+		HasChanges:   len(diff) > 0,
+		DetailedDiff: diff,
+	}, nil
+}
+
+func (RemoteDirectory) Read(ctx context.Context, id string, inputs RemoteDirectoryArgs, state RemoteDirectoryState) (string, RemoteDirectoryArgs, RemoteDirectoryState, error) {
+	managed := make(map[string]bool, len(state.Files))
+	for _, f := range state.Files {
+		managed[f.Path] = true
+	}
+
+	var files []deployer.SyncFile
+
+	// Other files in the directory are only of interest if they'd be
+	// deleted, and then only that they're there.  They're kept apart from
+	// the manifest, which is what Delete removes.
+	err := withClient(ctx, state.Connection, func(client *cryptossh.Client) (err error) {
+		files, err = deployer.RemoteTree(client, state.Path, managed, state.deleteExtraneous())
+		return err
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		// The directory is gone, so the resource is too.
+		return "", inputs, state, nil
+	}
+	if err != nil {
+		return "", inputs, state, err
+	}
+
+	state.Files = make([]SyncedFile, 0, len(managed))
+	state.Extraneous = nil
+
+	for _, f := range newSyncedFiles(files) {
+		if managed[f.Path] {
+			state.Files = append(state.Files, f)
+		} else {
+			state.Extraneous = append(state.Extraneous, f.Path)
+		}
+	}
+
+	return id, inputs, state, nil
+}
+
+func (RemoteDirectory) Update(ctx context.Context, id string, olds RemoteDirectoryState, news RemoteDirectoryArgs, preview bool) (RemoteDirectoryState, error) {
+	state := RemoteDirectoryState{RemoteDirectoryArgs: news}
+
+	files, err := news.sync(ctx, preview)
+	if err != nil {
+		return RemoteDirectoryState{}, err
+	}
+
+	state.Files = files
+
+	return state, nil
+}
+
+func (RemoteDirectory) Delete(ctx context.Context, id string, state RemoteDirectoryState) error {
+	return withClient(ctx, state.Connection, func(client *cryptossh.Client) error {
+		return deployer.RemoveTree(client, state.Path, state.syncFiles())
+	})
+}
@@ -0,0 +1,186 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/abklabs/pulumi-runner/pkg/ssh/sshtest"
+	p "github.com/pulumi/pulumi-go-provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+
+	for name, contents := range files {
+		name = filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(name), 0755))
+		require.NoError(t, os.WriteFile(name, []byte(contents), 0644))
+	}
+}
+
+func TestRemoteDirectoryValidate(t *testing.T) {
+	args := RemoteDirectoryArgs{Source: "static", Path: "/srv/static"}
+	assert.NoError(t, args.Validate())
+
+	args.Path = "/"
+	assert.ErrorContains(t, args.Validate(), "'Path'")
+
+	args.Path = "srv/static"
+	assert.ErrorContains(t, args.Validate(), "'Path'")
+
+	args = RemoteDirectoryArgs{Path: "/srv/static"}
+	assert.ErrorContains(t, args.Validate(), "'Source'")
+}
+
+func TestRemoteDirectoryPreview(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"index.html":    "<html></html>",
+		"css/site.css":  "body {}",
+		"js/app/app.js": "main()",
+	})
+
+	args := RemoteDirectoryArgs{Source: root, Path: "/srv/static"}
+
+	files, err := args.sync(context.Background(), true)
+	require.NoError(t, err)
+
+	var paths []string
+	for _, f := range files {
+		paths = append(paths, f.Path)
+	}
+
+	assert.Equal(t, []string{"css/site.css", "index.html", "js/app/app.js"}, paths)
+	assert.Equal(t, 0644, files[0].Mode)
+	assert.Equal(t, 7, files[0].Size)
+	assert.Equal(t, sha256Hex([]byte("body {}")), files[0].Sha256)
+}
+
+func TestRemoteDirectoryDiff(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"a.txt":     "a",
+		"sub/b.txt": "b",
+	})
+
+	args := RemoteDirectoryArgs{Source: root, Path: "/srv/static"}
+
+	files, err := args.sync(context.Background(), true)
+	require.NoError(t, err)
+
+	olds := RemoteDirectoryState{RemoteDirectoryArgs: args, Files: files}
+
+	diff := func(news RemoteDirectoryArgs) p.DiffResponse {
+		resp, err := RemoteDirectory{}.Diff(context.Background(), "id", olds, news)
+		require.NoError(t, err)
+		return resp
+	}
+
+	assert.False(t, diff(args).HasChanges)
+
+	news := args
+	news.Path = "/srv/static/"
+	assert.False(t, diff(news).HasChanges)
+
+	news.Path = "/srv/other"
+	assert.Equal(t, p.UpdateReplace, diff(news).DetailedDiff["path"].Kind)
+
+	news = args
+	news.DeleteExtraneous = ptr(true)
+	assert.Equal(t, p.Update, diff(news).DetailedDiff["deleteExtraneous"].Kind)
+
+	// A file removed on the host by hand, as found by Read.
+	olds.Files = files[:1]
+	assert.Equal(t, p.Update, diff(args).DetailedDiff["source"].Kind)
+	olds.Files = files
+
+	// A file added on the host is only drift if it would be deleted.
+	olds.Extraneous = []string{"other.log"}
+	assert.False(t, diff(args).HasChanges)
+	olds.DeleteExtraneous = ptr(true)
+	news = args
+	news.DeleteExtraneous = ptr(true)
+	assert.Equal(t, p.Update, diff(news).DetailedDiff["extraneous"].Kind)
+	olds = RemoteDirectoryState{RemoteDirectoryArgs: args, Files: files}
+
+	writeTree(t, root, map[string]string{"sub/b.txt": "changed"})
+	assert.Equal(t, p.Update, diff(args).DetailedDiff["source"].Kind)
+}
+
+func TestRemoteDirectoryRead(t *testing.T) {
+	server := sshtest.NewServer(t)
+
+	source := t.TempDir()
+	writeTree(t, source, map[string]string{"a.txt": "a", "a/c.txt": "c", "sub/b.txt": "b"})
+
+	args := RemoteDirectoryArgs{
+		Connection: testConnection(t, server),
+		Source:     source,
+		Path:       filepath.Join(t.TempDir(), "static"),
+	}
+
+	_, state, err := RemoteDirectory{}.Create(context.Background(), "static", args, false)
+	require.NoError(t, err)
+
+	read := func(state RemoteDirectoryState) RemoteDirectoryState {
+		_, _, state, err := RemoteDirectory{}.Read(context.Background(), "static", args, state)
+		require.NoError(t, err)
+		return state
+	}
+
+	// The remote files are listed in the same order as the local ones.
+	resp, err := RemoteDirectory{}.Diff(context.Background(), "static", read(state), args)
+	require.NoError(t, err)
+	assert.False(t, resp.HasChanges)
+
+	// A file the resource doesn't manage, and an edit to one it does.
+	writeTree(t, args.Path, map[string]string{"other.log": "not ours", "a.txt": "edited"})
+
+	assert.Equal(t, []SyncedFile{
+		{Path: "a/c.txt", Mode: 0644, Size: 1, Sha256: sha256Hex([]byte("c"))},
+		{Path: "a.txt", Mode: 0644, Size: 6, Sha256: sha256Hex([]byte("edited"))},
+		{Path: "sub/b.txt", Mode: 0644, Size: 1, Sha256: sha256Hex([]byte("b"))},
+	}, read(state).Files)
+
+	// When it would be deleted, the other file's presence is drift, but
+	// it isn't part of the manifest.
+	state.DeleteExtraneous = ptr(true)
+	refreshed := read(state)
+	assert.Len(t, refreshed.Files, 3)
+	assert.Equal(t, []string{"other.log"}, refreshed.Extraneous)
+}
+
+func TestRemoteDirectoryRefreshDelete(t *testing.T) {
+	server := sshtest.NewServer(t)
+
+	source := t.TempDir()
+	writeTree(t, source, map[string]string{"a.txt": "a"})
+
+	args := RemoteDirectoryArgs{
+		Connection:       testConnection(t, server),
+		Source:           source,
+		Path:             filepath.Join(t.TempDir(), "static"),
+		DeleteExtraneous: ptr(true),
+	}
+
+	_, state, err := RemoteDirectory{}.Create(context.Background(), "static", args, false)
+	require.NoError(t, err)
+
+	writeTree(t, args.Path, map[string]string{"other.log": "not ours"})
+
+	_, _, state, err = RemoteDirectory{}.Read(context.Background(), "static", args, state)
+	require.NoError(t, err)
+
+	resp, err := RemoteDirectory{}.Diff(context.Background(), "static", state, args)
+	require.NoError(t, err)
+	assert.Equal(t, p.Update, resp.DetailedDiff["extraneous"].Kind)
+
+	// Only the files the resource put there are removed.
+	require.NoError(t, RemoteDirectory{}.Delete(context.Background(), "static", state))
+	assert.NoFileExists(t, filepath.Join(args.Path, "a.txt"))
+	assert.FileExists(t, filepath.Join(args.Path, "other.log"))
+}
@@ -0,0 +1,359 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"reflect"
+
+	"github.com/abklabs/pulumi-runner/pkg/runner/core/deployer"
+	"github.com/abklabs/pulumi-runner/pkg/ssh"
+	p "github.com/pulumi/pulumi-go-provider"
+	"github.com/pulumi/pulumi-go-provider/infer"
+	cryptossh "golang.org/x/crypto/ssh"
+)
+
+const (
+	defaultRemoteFileMode = 0o644
+
+	// An existing file is kept alongside the managed one under this
+	// suffix, and put back when the resource is deleted.
+	remoteFileBackupSuffix = ".runner-orig"
+)
+
+type RemoteFile struct{}
+
+type RemoteFileArgs struct {
+	Connection ssh.Connection `pulumi:"connection"`
+	Path       string         `pulumi:"path"`
+	Contents   *string        `pulumi:"contents,optional"`
+	Asset      *FileAsset     `pulumi:"asset,optional"`
+	Mode       *int           `pulumi:"mode,optional"`
+	Owner      *string        `pulumi:"owner,optional"`
+	Group      *string        `pulumi:"group,optional"`
+}
+
+func (r *RemoteFileArgs) Annotate(a infer.Annotator) {
+	a.Describe(&r.Connection, "The connection to the host to place the file on.")
+	a.Describe(&r.Path, "The absolute path of the file on the host.")
+	a.Describe(&r.Contents, "The contents of the file. Exactly one of contents and asset must be set.")
+	a.Describe(&r.Asset, "A file asset providing the contents of the file. Its filename is ignored.")
+	a.Describe(&r.Mode, "The permission bits of the file. Defaults to the asset's mode, or 0644.")
+	a.Describe(&r.Owner, "The user to own the file. Defaults to root.")
+	a.Describe(&r.Group, "The group to own the file. Defaults to root's group.")
+}
+
+type RemoteFileState struct {
+	RemoteFileArgs
+	Sha256     string  `pulumi:"sha256"`
+	BackupPath *string `pulumi:"backupPath,optional"`
+}
+
+func (r *RemoteFileState) Annotate(a infer.Annotator) {
+	a.Describe(&r.Sha256, "The hex encoded SHA-256 of the file's contents on the host.")
+	a.Describe(&r.BackupPath, "Where the file that was at path before creation was kept, to be restored on delete.")
+}
+
+func (r *RemoteFile) Annotate(a infer.Annotator) {
+	a.Describe(&r, "Manage a single file on a remote host. The connection must be as root.")
+}
+
+// Validate ensures the RemoteFileArgs are properly configured
+func (r *RemoteFileArgs) Validate() error {
+	var errs []error
+
+	if !path.IsAbs(r.Path) {
+		errs = append(errs, fmt.Errorf("'Path' must be absolute (got %q)", r.Path))
+	}
+
+	if (r.Contents == nil) == (r.Asset == nil) {
+		errs = append(errs, fmt.Errorf("exactly one of Contents or Asset must be set"))
+	}
+
+	if r.Asset != nil {
+		hasLocalPath := !IsEmptyStr(r.Asset.LocalPath)
+		hasContents := r.Asset.Contents != nil
+
+		if hasLocalPath == hasContents {
+			errs = append(errs, fmt.Errorf("exactly one of LocalPath or Contents must be set on Asset"))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// contents returns the desired contents of the file.
+func (r *RemoteFileArgs) contents() ([]byte, error) {
+	switch {
+	case r.Contents != nil:
+		return []byte(*r.Contents), nil
+	case r.Asset.Contents != nil:
+		return []byte(*r.Asset.Contents), nil
+	}
+
+	data, err := os.ReadFile(*r.Asset.LocalPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read local file %s: %w", *r.Asset.LocalPath, err)
+	}
+
+	return data, nil
+}
+
+func (r *RemoteFileArgs) mode() fs.FileMode {
+	switch {
+	case r.Mode != nil:
+		return fs.FileMode(*r.Mode).Perm()
+	case r.Asset != nil && r.Asset.Mode != nil:
+		return fs.FileMode(*r.Asset.Mode).Perm()
+	}
+
+	return defaultRemoteFileMode
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// withClient dials the connection for the duration of f.
+func withClient(ctx context.Context, con ssh.Connection, f func(client *cryptossh.Client) error) (err error) {
+	client, err := con.Dial(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to dial SSH connection to host: %w", err)
+	}
+
+	defer func() {
+		err = errors.Join(err, client.Close())
+	}()
+
+	return f(client)
+}
+
+// requireRoot refuses a connection that isn't as root.  The file, its
+// backup and its ownership are all changed over SFTP and plain exec, with
+// no sudo, so anyone else would fail partway through.
+func requireRoot(client *cryptossh.Client) error {
+	uid, err := deployer.RemoteUID(client)
+	if err != nil {
+		return err
+	}
+
+	if uid != 0 {
+		return fmt.Errorf("RemoteFile must connect as root (connected as uid %d)", uid)
+	}
+
+	return nil
+}
+
+// write places the desired contents on the host.
+func (r *RemoteFileArgs) write(client *cryptossh.Client, contents []byte) error {
+	return deployer.WriteRemoteFile(client, r.Path, bytes.NewReader(contents), r.mode(), deref(r.Owner), deref(r.Group))
+}
+
+func (RemoteFile) Create(ctx context.Context, name string, input RemoteFileArgs, preview bool) (string, RemoteFileState, error) {
+	state := RemoteFileState{RemoteFileArgs: input}
+
+	if err := input.Validate(); err != nil {
+		return "", state, err
+	}
+
+	contents, err := input.contents()
+	if err != nil {
+		return "", state, err
+	}
+
+	state.Sha256 = sha256Hex(contents)
+
+	if preview {
+		return name, state, nil
+	}
+
+	err = withClient(ctx, input.Connection, func(client *cryptossh.Client) error {
+		if err := requireRoot(client); err != nil {
+			return err
+		}
+
+		backupPath, err := backupRemoteFile(client, input.Path)
+		if err != nil {
+			return err
+		}
+
+		state.BackupPath = backupPath
+
+		return input.write(client, contents)
+	})
+	if err != nil {
+		return "", state, err
+	}
+
+	return name, state, nil
+}
+
+// backupRemoteFile hard links any existing file at path to its backup
+// path, so it survives being replaced.  A backup already there is
+// replaced, since it can be stale, left by a resource that's gone.
+func backupRemoteFile(client *cryptossh.Client, filePath string) (*string, error) {
+	exists, err := deployer.RemoteFileExists(client, filePath)
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	backupPath := filePath + remoteFileBackupSuffix
+
+	// Link under a temporary name, and rename that over any old backup,
+	// so there's a backup throughout.
+	tmpPath := backupPath + ".new"
+
+	if err := deployer.RemoveRemoteFile(client, tmpPath); err != nil {
+		return nil, err
+	}
+
+	if err := deployer.LinkRemoteFile(client, filePath, tmpPath); err != nil {
+		return nil, err
+	}
+
+	if err := deployer.RenameRemoteFile(client, tmpPath, backupPath); err != nil {
+		return nil, err
+	}
+
+	return &backupPath, nil
+}
+
+func (RemoteFile) Diff(ctx context.Context, id string, olds RemoteFileState, news RemoteFileArgs) (p.DiffResponse, error) {
+	diff := map[string]p.PropertyDiff{}
+
+	if olds.Path != news.Path {
+		diff["path"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+
+	if deref(olds.Connection.Host) != deref(news.Connection.Host) {
+		diff["connection"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	} else if !reflect.DeepEqual(olds.Connection, news.Connection) {
+		diff["connection"] = p.PropertyDiff{Kind: p.Update}
+	}
+
+	// Contents that can't be read are reported as a change, so that the
+	// error surfaces during the update.
+	contents, err := news.contents()
+	if err != nil || sha256Hex(contents) != olds.Sha256 {
+		key := "contents"
+		if news.Contents == nil {
+			key = "asset"
+		}
+		diff[key] = p.PropertyDiff{Kind: p.Update}
+	}
+
+	if olds.mode() != news.mode() {
+		diff["mode"] = p.PropertyDiff{Kind: p.Update}
+	}
+
+	if news.Owner != nil && deref(olds.Owner) != *news.Owner {
+		diff["owner"] = p.PropertyDiff{Kind: p.Update}
+	}
+
+	if news.Group != nil && deref(olds.Group) != *news.Group {
+		diff["group"] = p.PropertyDiff{Kind: p.Update}
+	}
+
+	return p.DiffResponse{
+		HasChanges:   len(diff) > 0,
+		DetailedDiff: diff,
+	}, nil
+}
+
+func (RemoteFile) Read(ctx context.Context, id string, inputs RemoteFileArgs, state RemoteFileState) (string, RemoteFileArgs, RemoteFileState, error) {
+	var (
+		info deployer.RemoteFileInfo
+		sum  string
+	)
+
+	err := withClient(ctx, state.Connection, func(client *cryptossh.Client) (err error) {
+		info, sum, err = deployer.HashRemoteFile(client, state.Path)
+		return err
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		// The file is gone, so the resource is too.
+		return "", inputs, state, nil
+	}
+	if err != nil {
+		return "", inputs, state, err
+	}
+
+	state.Sha256 = sum
+
+	// The mode is only recorded when it has drifted from what was asked
+	// for, and ownership only when it was asked for.
+	if info.Mode != state.mode() {
+		mode := int(info.Mode)
+		state.Mode = &mode
+	}
+
+	if state.Owner != nil {
+		state.Owner = &info.Owner
+	}
+
+	if state.Group != nil {
+		state.Group = &info.Group
+	}
+
+	return id, inputs, state, nil
+}
+
+func (RemoteFile) Update(ctx context.Context, id string, olds RemoteFileState, news RemoteFileArgs, preview bool) (RemoteFileState, error) {
+	state := RemoteFileState{
+		RemoteFileArgs: news,
+		BackupPath:     olds.BackupPath,
+	}
+
+	if err := news.Validate(); err != nil {
+		return state, err
+	}
+
+	contents, err := news.contents()
+	if err != nil {
+		return state, err
+	}
+
+	state.Sha256 = sha256Hex(contents)
+
+	if preview {
+		return state, nil
+	}
+
+	err = withClient(ctx, news.Connection, func(client *cryptossh.Client) error {
+		if err := requireRoot(client); err != nil {
+			return err
+		}
+
+		return news.write(client, contents)
+	})
+	if err != nil {
+		return RemoteFileState{}, err
+	}
+
+	return state, nil
+}
+
+func (RemoteFile) Delete(ctx context.Context, id string, state RemoteFileState) error {
+	return withClient(ctx, state.Connection, func(client *cryptossh.Client) error {
+		if state.BackupPath != nil {
+			return deployer.RenameRemoteFile(client, *state.BackupPath, state.Path)
+		}
+
+		return deployer.RemoveRemoteFile(client, state.Path)
+	})
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+
+	return *s
+}
@@ -0,0 +1,178 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/abklabs/pulumi-runner/pkg/ssh"
+	"github.com/abklabs/pulumi-runner/pkg/ssh/sshtest"
+	p "github.com/pulumi/pulumi-go-provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// testConnection returns a connection to server, without an agent.
+func testConnection(t *testing.T, server *sshtest.Server) ssh.Connection {
+	t.Helper()
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	host, port := server.HostPort()
+
+	con := ssh.Connection{}
+	con.User = ptr("test")
+	con.Host = &host
+	con.Port = ptr(float64(port))
+	con.DialErrorLimit = ptr(1)
+	con.PerDialTimeout = ptr(5)
+
+	return con
+}
+
+func newRemoteFileArgs(contents string) RemoteFileArgs {
+	return RemoteFileArgs{
+		Connection: ssh.Connection{},
+		Path:       "/etc/example.conf",
+		Contents:   &contents,
+	}
+}
+
+func TestRemoteFileValidate(t *testing.T) {
+	args := newRemoteFileArgs("hello")
+	assert.NoError(t, args.Validate())
+
+	args.Path = "etc/example.conf"
+	assert.ErrorContains(t, args.Validate(), "must be absolute")
+
+	args = newRemoteFileArgs("hello")
+	args.Asset = &FileAsset{Contents: ptr("hello")}
+	assert.ErrorContains(t, args.Validate(), "exactly one of Contents or Asset")
+
+	args.Contents = nil
+	assert.NoError(t, args.Validate())
+
+	args.Asset = &FileAsset{}
+	assert.ErrorContains(t, args.Validate(), "on Asset")
+}
+
+func TestRemoteFileMode(t *testing.T) {
+	args := newRemoteFileArgs("hello")
+	assert.EqualValues(t, 0o644, args.mode())
+
+	args.Contents = nil
+	args.Asset = &FileAsset{Contents: ptr("hello"), Mode: ptr(0o755)}
+	assert.EqualValues(t, 0o755, args.mode())
+
+	args.Mode = ptr(0o600)
+	assert.EqualValues(t, 0o600, args.mode())
+}
+
+func TestRemoteFileDiff(t *testing.T) {
+	olds := RemoteFileState{
+		RemoteFileArgs: newRemoteFileArgs("hello"),
+		Sha256:         sha256Hex([]byte("hello")),
+	}
+
+	diff := func(news RemoteFileArgs) p.DiffResponse {
+		resp, err := RemoteFile{}.Diff(context.Background(), "id", olds, news)
+		require.NoError(t, err)
+		return resp
+	}
+
+	assert.False(t, diff(newRemoteFileArgs("hello")).HasChanges)
+
+	// The same contents from an asset aren't a change.
+	news := newRemoteFileArgs("")
+	news.Contents = nil
+	news.Asset = &FileAsset{Contents: ptr("hello")}
+	assert.False(t, diff(news).HasChanges)
+
+	resp := diff(newRemoteFileArgs("changed"))
+	assert.True(t, resp.HasChanges)
+	assert.Equal(t, p.Update, resp.DetailedDiff["contents"].Kind)
+
+	// Drift found by Read changes the recorded hash.
+	olds.Sha256 = sha256Hex([]byte("edited by hand"))
+	assert.True(t, diff(newRemoteFileArgs("hello")).HasChanges)
+	olds.Sha256 = sha256Hex([]byte("hello"))
+
+	news = newRemoteFileArgs("hello")
+	news.Path = "/etc/other.conf"
+	assert.Equal(t, p.UpdateReplace, diff(news).DetailedDiff["path"].Kind)
+
+	news = newRemoteFileArgs("hello")
+	news.Connection.Host = ptr("other")
+	assert.Equal(t, p.UpdateReplace, diff(news).DetailedDiff["connection"].Kind)
+
+	news = newRemoteFileArgs("hello")
+	news.Mode = ptr(0o644)
+	assert.False(t, diff(news).HasChanges)
+
+	news.Mode = ptr(0o600)
+	assert.Equal(t, p.Update, diff(news).DetailedDiff["mode"].Kind)
+
+	news = newRemoteFileArgs("hello")
+	news.Owner = ptr("sol")
+	assert.Equal(t, p.Update, diff(news).DetailedDiff["owner"].Kind)
+
+	olds.Owner = ptr("sol")
+	assert.False(t, diff(news).HasChanges)
+}
+
+func TestRemoteFileReplacesStaleBackup(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("RemoteFile needs to connect as root")
+	}
+
+	server := sshtest.NewServer(t)
+
+	path := filepath.Join(t.TempDir(), "example.conf")
+	require.NoError(t, os.WriteFile(path, []byte("original"), 0o644))
+
+	// Left by a resource that's since gone.
+	require.NoError(t, os.WriteFile(path+remoteFileBackupSuffix, []byte("stale"), 0o644))
+
+	args := newRemoteFileArgs("managed")
+	args.Connection = testConnection(t, server)
+	args.Path = path
+
+	_, state, err := RemoteFile{}.Create(context.Background(), "motd", args, false)
+	require.NoError(t, err)
+	assert.Equal(t, path+remoteFileBackupSuffix, deref(state.BackupPath))
+
+	read := func(path string) string {
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	assert.Equal(t, "managed", read(path))
+	assert.Equal(t, "original", read(path+remoteFileBackupSuffix))
+	assert.NoFileExists(t, path+remoteFileBackupSuffix+".new")
+
+	require.NoError(t, RemoteFile{}.Delete(context.Background(), "motd", state))
+	assert.Equal(t, "original", read(path))
+	assert.NoFileExists(t, path+remoteFileBackupSuffix)
+}
+
+func TestRemoteFileRequiresRoot(t *testing.T) {
+	server := sshtest.NewServer(t)
+
+	// Whoever the tests run as, the host says it isn't root.
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "id"), []byte("#!/bin/sh\necho 1000\n"), 0o755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	args := newRemoteFileArgs("managed")
+	args.Connection = testConnection(t, server)
+	args.Path = filepath.Join(t.TempDir(), "example.conf")
+
+	_, _, err := RemoteFile{}.Create(context.Background(), "motd", args, false)
+	assert.ErrorContains(t, err, "RemoteFile must connect as root (connected as uid 1000)")
+	assert.NoFileExists(t, args.Path)
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	svmkitRunner "github.com/abklabs/pulumi-runner/pkg/runner/core"
+	"github.com/abklabs/pulumi-runner/pkg/runner/core/deployer"
 )
 
 // SSHCommand encapsulates a shell command and its execution context for remote
@@ -16,17 +17,24 @@ import (
 // needed for remote command execution.
 type SSHCommand struct {
 	command     string
+	steps       []Step
+	startStep   string
 	environment map[string]string
+	secretEnv   map[string]string
 	payload     []FileAsset
+	forwards    []Forward
+	fetch       []FetchFile
+	fetched     []FetchedFile
 	config      *svmkitRunner.Config
 }
 
 // NewSSHCommand creates a new SSHCommand instance
-func NewSSHCommand(command string, environment map[string]string, payload []FileAsset, config *svmkitRunner.Config) *SSHCommand {
+func NewSSHCommand(command string, environment map[string]string, payload []FileAsset, forwards []Forward, config *svmkitRunner.Config) *SSHCommand {
 	return &SSHCommand{
 		command:     command,
 		environment: environment,
 		payload:     payload,
+		forwards:    forwards,
 		config:      config,
 	}
 }
@@ -34,17 +42,49 @@ func NewSSHCommand(command string, environment map[string]string, payload []File
 // Check validates the command and payload
 func (c *SSHCommand) Check() error {
 	// Validate the command
-	if c.command == "" {
+	if c.command == "" && len(c.steps) == 0 {
 		return fmt.Errorf("command cannot be empty")
 	}
 
+	if c.command != "" && len(c.steps) != 0 {
+		return fmt.Errorf("only one of command and steps can be given")
+	}
+
 	var errs []error
 
+	if err := validateSteps(c.steps); err != nil {
+		errs = append(errs, err)
+	}
+
+	for k := range c.secretEnv {
+		if !envNameRegexp.MatchString(k) {
+			errs = append(errs, fmt.Errorf("%q is not a valid secret environment variable name", k))
+		}
+	}
+
 	for _, asset := range c.payload {
 		if err := asset.Validate(); err != nil {
 			errs = append(errs, err)
 		}
 	}
+
+	names := make(map[string]bool, len(c.forwards))
+	for _, fwd := range c.forwards {
+		if err := fwd.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+
+		if names[fwd.Name] {
+			errs = append(errs, fmt.Errorf("duplicate forward name %q", fwd.Name))
+		}
+		names[fwd.Name] = true
+	}
+
+	for _, f := range c.fetch {
+		if err := f.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
 	return errors.Join(errs...)
 }
 
@@ -55,6 +95,14 @@ func (c *SSHCommand) Env() *svmkitRunner.EnvBuilder {
 	return env
 }
 
+// SecretEnv returns the environment to send over stdin rather than in
+// the payload
+func (c *SSHCommand) SecretEnv() *svmkitRunner.EnvBuilder {
+	env := svmkitRunner.NewEnvBuilder()
+	env.SetMap(c.secretEnv)
+	return env
+}
+
 // AddToPayload adds file assets to the payload
 // Asset validation is done in FileAsset.Validate()
 func (c *SSHCommand) AddToPayload(p *svmkitRunner.Payload) error {
@@ -82,13 +130,49 @@ func (c *SSHCommand) AddToPayload(p *svmkitRunner.Payload) error {
 			Path:   *asset.Filename,
 			Reader: content,
 			Mode:   os.FileMode(*asset.Mode),
+			Secret: asset.Secret != nil && *asset.Secret,
 		})
 
 	}
-	p.AddString("steps.sh", c.command)
+	if len(c.steps) != 0 {
+		addStepsToPayload(p, c.steps)
+	} else {
+		p.AddString("steps.sh", c.command)
+	}
 	return errors.Join(errs...)
 }
 
+// StartStep returns the step to resume from, if any
+func (c *SSHCommand) StartStep() string {
+	return c.startStep
+}
+
+// Forwards returns the connection forwards to set up while the command runs
+func (c *SSHCommand) Forwards() []deployer.Forward {
+	res := make([]deployer.Forward, len(c.forwards))
+	for i, fwd := range c.forwards {
+		res[i] = fwd.deployerForward()
+	}
+	return res
+}
+
+// Fetches returns the files to download once the command has run
+func (c *SSHCommand) Fetches() []deployer.Fetch {
+	res := make([]deployer.Fetch, len(c.fetch))
+	for i, f := range c.fetch {
+		res[i] = deployer.Fetch{Remote: f.Path, Local: f.LocalPath}
+	}
+	return res
+}
+
+// Fetched records the files downloaded once the command has run
+func (c *SSHCommand) Fetched(results []deployer.FetchResult) {
+	c.fetched = make([]FetchedFile, len(results))
+	for i, res := range results {
+		c.fetched[i] = newFetchedFile(res)
+	}
+}
+
 func (c *SSHCommand) Config() *svmkitRunner.Config {
 	if c.config == nil {
 		return nil
@@ -0,0 +1,47 @@
+package runner
+
+import (
+	"io"
+	"testing"
+
+	svmkitRunner "github.com/abklabs/pulumi-runner/pkg/runner/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSHCommandSecrets(t *testing.T) {
+	payload := []FileAsset{
+		{Filename: ptr("config.toml"), Contents: ptr("a = 1"), Mode: ptr(0644)},
+		{Filename: ptr("keys/validator.json"), Contents: ptr("[1,2,3]"), Mode: ptr(0600), Secret: ptr(true)},
+	}
+
+	cmd := NewSSHCommand("./start.sh", map[string]string{"MODE": "full"}, payload, nil, nil)
+	cmd.secretEnv = map[string]string{"API_TOKEN": "t0ken value"}
+	require.NoError(t, cmd.Check())
+
+	assert.Equal(t, "export API_TOKEN='t0ken value'\n", cmd.SecretEnv().Exports().String())
+
+	var _ svmkitRunner.SecretEnver = cmd
+
+	p := &svmkitRunner.Payload{}
+	require.NoError(t, svmkitRunner.PrepareCommandPayload(p, cmd))
+
+	secret := map[string]bool{}
+	for _, f := range p.Files {
+		secret[f.Path] = f.Secret
+
+		if f.Path == "env" {
+			b, err := io.ReadAll(f.Reader)
+			require.NoError(t, err)
+			assert.Equal(t, "MODE=full\n", string(b))
+		}
+	}
+
+	assert.Equal(t, map[string]bool{
+		"opsh": false, "lib.bash": false, "run.sh": false, "env": false, "steps.sh": false,
+		"config.toml": false, "keys/validator.json": true,
+	}, secret)
+
+	cmd.secretEnv = map[string]string{"BAD NAME": "x"}
+	assert.ErrorContains(t, cmd.Check(), `"BAD NAME" is not a valid secret environment variable name`)
+}
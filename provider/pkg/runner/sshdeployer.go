@@ -2,21 +2,32 @@ package runner
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"maps"
 	"os"
+	"slices"
 
 	svmkitRunner "github.com/abklabs/pulumi-runner/pkg/runner/core"
 	"github.com/abklabs/pulumi-runner/pkg/ssh"
 	"github.com/abklabs/pulumi-runner/pkg/utils"
+	p "github.com/pulumi/pulumi-go-provider"
+	"github.com/pulumi/pulumi-go-provider/infer"
 )
 
 type SSHDeployer struct{}
 
 type CommandDefinition struct {
-	Command     string            `pulumi:"command"`
+	Command     string            `pulumi:"command,optional"`
+	Steps       []Step            `pulumi:"steps,optional"`
 	Environment map[string]string `pulumi:"environment,optional"`
 	Payload     []FileAsset       `pulumi:"payload,optional"`
+	Forwards    []Forward         `pulumi:"forwards,optional"`
+	Fetch       []FetchFile       `pulumi:"fetch,optional"`
+
+	// SecretEnvironment is sent over the command's stdin rather than
+	// written to the host's disk.
+	SecretEnvironment map[string]string `pulumi:"secretEnvironment,optional" provider:"secret"`
 }
 
 type SSHDeployerArgs struct {
@@ -27,22 +38,55 @@ type SSHDeployerArgs struct {
 	Update      *CommandDefinition   `pulumi:"update,optional"`
 	Delete      *CommandDefinition   `pulumi:"delete,optional"`
 	Config      *svmkitRunner.Config `pulumi:"config,optional"`
+
+	// ResumeFrom picks up a run that failed partway through its steps:
+	// "auto" starts again at the step that failed, or a step name
+	// starts there.
+	ResumeFrom *string `pulumi:"resumeFrom,optional"`
+
+	// SecretEnvironment is merged with each command's, as Environment is.
+	SecretEnvironment map[string]string `pulumi:"secretEnvironment,optional" provider:"secret"`
 }
 
 // SSHDeployerState represents the state of an SSHDeployer resource
 type SSHDeployerState struct {
 	SSHDeployerArgs
+	Fetched []FetchedFile `pulumi:"fetched,optional"`
+
+	// FailedStep is the step the last run failed in, if it failed
+	// partway through its steps.
+	FailedStep *string `pulumi:"failedStep,optional"`
+
+	// FailedCommand is which command, "create" or "update", failed.
+	FailedCommand *string `pulumi:"failedCommand,optional"`
+}
+
+// recordFailedStep records command failing partway through its steps,
+// so the next update can resume it, and reports whether it did.  The
+// state is kept by returning it along with an
+// infer.ResourceInitFailedError.
+func recordFailedStep(state *SSHDeployerState, command string, err error) bool {
+	var stepErr *utils.StepError
+	if !errors.As(err, &stepErr) {
+		return false
+	}
+
+	step := stepName(stepErr.Step)
+	state.FailedStep = &step
+	state.FailedCommand = &command
+
+	return true
 }
 
 // runDeployerCommand executes a deployment command
-func runDeployerCommand(ctx context.Context, def *CommandDefinition, state *SSHDeployerState, preview bool) (err error) {
+func runDeployerCommand(ctx context.Context, operation string, def *CommandDefinition, state *SSHDeployerState, failed string, preview bool) (err error) {
 
 	// Command not defined so this is just null op.
 	if def == nil {
 		return
 	}
 
-	if def.Command == "" {
+	if def.Command == "" && len(def.Steps) == 0 {
 		return fmt.Errorf("command is empty")
 	}
 
@@ -53,13 +97,60 @@ func runDeployerCommand(ctx context.Context, def *CommandDefinition, state *SSHD
 	maps.Copy(environment, state.Environment)
 	maps.Copy(environment, def.Environment)
 
-	cmd := NewSSHCommand(def.Command, environment, payload, state.Config)
+	secretEnv := make(map[string]string)
+	maps.Copy(secretEnv, state.SecretEnvironment)
+	maps.Copy(secretEnv, def.SecretEnvironment)
+
+	// These are secret whether or not the program said so.
+	secrets := slices.Collect(maps.Values(secretEnv))
+	for _, asset := range payload {
+		if asset.Secret == nil || !*asset.Secret {
+			continue
+		}
+
+		switch {
+		case asset.Contents != nil:
+			secrets = append(secrets, *asset.Contents)
+		case asset.LocalPath != nil:
+			// A file that can't be read fails the run when it's
+			// added to the payload.
+			if data, err := os.ReadFile(*asset.LocalPath); err == nil {
+				secrets = append(secrets, string(data))
+			}
+		}
+	}
+	ctx = utils.WithSecretValues(ctx, secrets...)
+
+	cmd := NewSSHCommand(def.Command, environment, payload, def.Forwards, state.Config)
+	cmd.steps = def.Steps
+	cmd.secretEnv = secretEnv
+	cmd.fetch = def.Fetch
+
+	start, err := startStep(def.Steps, deref(state.ResumeFrom), failed)
+	if err != nil {
+		if deref(state.ResumeFrom) != resumeAuto {
+			return err
+		}
+		p.GetLogger(ctx).Warningf("%s; running every step", err)
+		err = nil
+	}
+
+	cmd.startStep = start
 
 	if preview {
 		return
 	}
 
-	err = utils.RunnerHelper(ctx, utils.RunnerArgs{Connection: state.Connection}, cmd)
+	if start != "" {
+		p.GetLogger(ctx).Infof("resuming from step %s", stepName(start))
+	}
+
+	err = utils.RunnerHelper(ctx, utils.RunnerArgs{Connection: state.Connection, Operation: operation}, cmd)
+	if err != nil {
+		return
+	}
+
+	state.Fetched = cmd.fetched
 
 	return
 }
@@ -76,15 +167,20 @@ func (SSHDeployer) Create(ctx context.Context, name string, input SSHDeployerArg
 		SSHDeployerArgs: input,
 	}
 
-	err := runDeployerCommand(ctx, def, &state, preview)
+	err := runDeployerCommand(ctx, "create", def, &state, "", preview)
 	if err != nil {
+		if recordFailedStep(&state, "create", err) {
+			return name, state, infer.ResourceInitFailedError{Reasons: []string{err.Error()}}
+		}
 		return "", SSHDeployerState{}, err
 	}
 
 	return name, state, nil
 }
 
-func (SSHDeployer) Update(ctx context.Context, name string, state SSHDeployerState, newInput SSHDeployerArgs, preview bool) (SSHDeployerState, error) {
+func (SSHDeployer) Update(ctx context.Context, name string, olds SSHDeployerState, newInput SSHDeployerArgs, preview bool) (SSHDeployerState, error) {
+	command := "update"
+
 	var def *CommandDefinition
 	if newInput.Update != nil {
 		def = newInput.Update
@@ -92,12 +188,29 @@ func (SSHDeployer) Update(ctx context.Context, name string, state SSHDeployerSta
 		def = newInput.Create
 	}
 
-	state = SSHDeployerState{
+	// A create that failed partway through is finished by running it
+	// again, rather than the update.
+	if deref(olds.FailedCommand) == "create" && newInput.Create != nil {
+		command = "create"
+		def = newInput.Create
+	}
+
+	state := SSHDeployerState{
 		SSHDeployerArgs: newInput,
 	}
 
-	err := runDeployerCommand(ctx, def, &state, preview)
+	// Only resume from a step that failed in the same command, as the
+	// step names and numbers of the others don't apply.
+	failed := ""
+	if deref(olds.FailedCommand) == command {
+		failed = deref(olds.FailedStep)
+	}
+
+	err := runDeployerCommand(ctx, command, def, &state, failed, preview)
 	if err != nil {
+		if recordFailedStep(&state, command, err) {
+			return state, infer.ResourceInitFailedError{Reasons: []string{err.Error()}}
+		}
 		return SSHDeployerState{}, err
 	}
 
@@ -105,7 +218,7 @@ func (SSHDeployer) Update(ctx context.Context, name string, state SSHDeployerSta
 }
 
 func (SSHDeployer) Delete(ctx context.Context, name string, state SSHDeployerState) error {
-	err := runDeployerCommand(ctx, state.Delete, &state, false)
+	err := runDeployerCommand(ctx, "delete", state.Delete, &state, "", false)
 	return err
 }
 
@@ -126,6 +239,7 @@ func (LocalFile) Call(ctx context.Context, input FileAsset) (asset FileAsset, er
 		Filename:  fname,
 		LocalPath: input.LocalPath,
 		Mode:      input.Mode,
+		Secret:    input.Secret,
 	}
 
 	if asset.Mode == nil {
@@ -147,6 +261,7 @@ func (StringFile) Call(ctx context.Context, input FileAsset) (asset FileAsset, e
 		Filename: input.Filename,
 		Contents: input.Contents,
 		Mode:     input.Mode,
+		Secret:   input.Secret,
 	}
 	return
 }
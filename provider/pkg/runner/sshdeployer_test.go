@@ -0,0 +1,203 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	svmkitRunner "github.com/abklabs/pulumi-runner/pkg/runner/core"
+	"github.com/abklabs/pulumi-runner/pkg/ssh/sshtest"
+	"github.com/pulumi/pulumi-go-provider/infer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fetchPayloadRoot runs a create that reports its payload root in a
+// fetched file, returning the state and the payload root.
+func fetchPayloadRoot(t *testing.T, config *svmkitRunner.Config) (SSHDeployerState, string) {
+	t.Helper()
+
+	server := sshtest.NewServer(t)
+	sshtest.StubSudo(t)
+
+	local := filepath.Join(t.TempDir(), "root.txt")
+
+	_, state, err := SSHDeployer{}.Create(context.Background(), "test", SSHDeployerArgs{
+		Connection: testConnection(t, server),
+		Config:     config,
+		Create: &CommandDefinition{
+			Command: "mkdir -p out && pwd > out/root.txt",
+			Fetch:   []FetchFile{{Path: "out/root.txt", LocalPath: local}},
+		},
+	}, false)
+	require.NoError(t, err)
+
+	root, err := os.ReadFile(local)
+	require.NoError(t, err)
+
+	return state, strings.TrimSpace(string(root))
+}
+
+func TestSSHDeployerFetch(t *testing.T) {
+	state, root := fetchPayloadRoot(t, nil)
+
+	require.Len(t, state.Fetched, 1)
+	assert.Equal(t, "out/root.txt", state.Fetched[0].Path)
+	assert.Equal(t, len(root)+1, state.Fetched[0].Size)
+	assert.Equal(t, sha256Hex([]byte(root+"\n")), state.Fetched[0].Sha256)
+
+	// The payload is kept for the fetch, and removed after it.
+	assert.True(t, strings.HasPrefix(root, "/tmp/runner-"), root)
+	assert.NoDirExists(t, root)
+}
+
+func TestSSHDeployerFetchKeepPayload(t *testing.T) {
+	_, root := fetchPayloadRoot(t, &svmkitRunner.Config{KeepPayload: ptr(true)})
+	t.Cleanup(func() { _ = os.RemoveAll(root) })
+
+	assert.DirExists(t, root)
+}
+
+func TestSSHDeployerSteps(t *testing.T) {
+	server := sshtest.NewServer(t)
+	sshtest.StubSudo(t)
+
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	ready := filepath.Join(dir, "ready")
+
+	args := SSHDeployerArgs{
+		Connection: testConnection(t, server),
+		Create: &CommandDefinition{
+			Steps: []Step{
+				{Name: "first", Command: "echo first $GREETING >> " + log, Environment: map[string]string{"GREETING": "hello"}},
+				{Name: "second", Command: "echo second >> " + log + " ; [[ -e " + ready + " ]] || exit 3"},
+				{Name: "third", Command: "echo third >> " + log},
+			},
+		},
+		ResumeFrom: ptr(resumeAuto),
+	}
+
+	_, state, err := SSHDeployer{}.Create(context.Background(), "test", args, false)
+	var initErr infer.ResourceInitFailedError
+	require.ErrorAs(t, err, &initErr)
+	require.Len(t, initErr.Reasons, 1)
+	assert.Contains(t, initErr.Reasons[0], "step 20-second failed")
+	assert.Equal(t, "second", deref(state.FailedStep))
+	assert.Equal(t, "create", deref(state.FailedCommand))
+
+	data, err := os.ReadFile(log)
+	require.NoError(t, err)
+	assert.Equal(t, "first hello\nsecond\n", string(data))
+
+	require.NoError(t, os.WriteFile(ready, nil, 0644))
+
+	state, err = SSHDeployer{}.Update(context.Background(), "test", state, args, false)
+	require.NoError(t, err)
+	assert.Nil(t, state.FailedStep)
+
+	data, err = os.ReadFile(log)
+	require.NoError(t, err)
+	assert.Equal(t, "first hello\nsecond\nsecond\nthird\n", string(data))
+}
+
+func TestSSHDeployerRedactsSecretLocalFile(t *testing.T) {
+	server := sshtest.NewServer(t)
+	sshtest.StubSudo(t)
+
+	local := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(local, []byte("s3cret-token-value"), 0600))
+
+	_, _, err := SSHDeployer{}.Create(context.Background(), "test", SSHDeployerArgs{
+		Connection: testConnection(t, server),
+		Create: &CommandDefinition{
+			Command: "cat token ; exit 1",
+			Payload: []FileAsset{{LocalPath: &local, Filename: ptr("token"), Mode: ptr(0600), Secret: ptr(true)}},
+		},
+	}, false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "[secret]")
+	assert.NotContains(t, err.Error(), "s3cret-token-value")
+}
+
+func TestSSHDeployerStepsStdin(t *testing.T) {
+	server := sshtest.NewServer(t)
+	sshtest.StubSudo(t)
+
+	log := filepath.Join(t.TempDir(), "log")
+
+	// A step reading stdin mustn't take the names of the steps after it.
+	args := SSHDeployerArgs{
+		Connection: testConnection(t, server),
+		Create: &CommandDefinition{
+			Steps: []Step{
+				{Name: "read", Command: "cat >> " + log + " ; echo read >> " + log},
+				{Name: "after", Command: "echo after >> " + log},
+			},
+		},
+	}
+
+	_, _, err := SSHDeployer{}.Create(context.Background(), "test", args, false)
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(log)
+	require.NoError(t, err)
+	assert.Equal(t, "read\nafter\n", string(data))
+}
+
+func TestSSHDeployerResumeOnlySameCommand(t *testing.T) {
+	server := sshtest.NewServer(t)
+	sshtest.StubSudo(t)
+
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	logDir := filepath.Join(dir, "logs")
+
+	steps := []Step{
+		{Name: "first", Command: "echo first >> " + log},
+		{Name: "second", Command: "echo second >> " + log},
+	}
+
+	// A step from a failed create doesn't apply to the update.
+	olds := SSHDeployerState{FailedStep: ptr("second"), FailedCommand: ptr("create")}
+	args := SSHDeployerArgs{
+		Connection: testConnection(t, server),
+		Config:     &svmkitRunner.Config{LogDir: &logDir},
+		Update:     &CommandDefinition{Steps: steps},
+		ResumeFrom: ptr(resumeAuto),
+	}
+
+	_, err := SSHDeployer{}.Update(context.Background(), "test", olds, args, false)
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(log)
+	require.NoError(t, err)
+	assert.Equal(t, "first\nsecond\n", string(data))
+
+	// Re-running the failed create resumes it, and is logged as one.
+	args.Create = &CommandDefinition{Steps: steps}
+
+	_, err = SSHDeployer{}.Update(context.Background(), "test", olds, args, false)
+	require.NoError(t, err)
+
+	data, err = os.ReadFile(log)
+	require.NoError(t, err)
+	assert.Equal(t, "first\nsecond\nsecond\n", string(data))
+
+	logs, err := filepath.Glob(filepath.Join(logDir, "run-*.log"))
+	require.NoError(t, err)
+	require.Len(t, logs, 2)
+
+	var operations []string
+	for _, l := range logs {
+		data, err := os.ReadFile(l)
+		require.NoError(t, err)
+
+		_, rest, _ := strings.Cut(string(data), "# operation: ")
+		operation, _, _ := strings.Cut(rest, "\n")
+		operations = append(operations, operation)
+	}
+	assert.ElementsMatch(t, []string{"update", "create"}, operations)
+}
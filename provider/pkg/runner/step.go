@@ -0,0 +1,174 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	svmkitRunner "github.com/abklabs/pulumi-runner/pkg/runner/core"
+)
+
+var stepNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// stepsDir is where the step scripts are placed in the payload.
+const stepsDir = "steps"
+
+// Step is one of an ordered list of commands making up a
+// CommandDefinition, run as its own script so it can be timed and
+// reported on separately.
+type Step struct {
+	// Name of the step, shown in progress and errors
+	Name string `pulumi:"name"`
+
+	// Shell commands to run for the step
+	Command string `pulumi:"command"`
+
+	// Environment variables for this step only
+	Environment map[string]string `pulumi:"environment,optional"`
+
+	// Seconds the step may run for before it's killed
+	Timeout *int `pulumi:"timeout,optional"`
+}
+
+// Validate ensures the Step is properly configured
+func (s *Step) Validate() error {
+	var errs []error
+
+	if !stepNameRegexp.MatchString(s.Name) {
+		errs = append(errs, fmt.Errorf("step name %q may only contain letters, digits, '_' and '-', and must start with a letter or digit", s.Name))
+	}
+
+	if strings.TrimSpace(s.Command) == "" {
+		errs = append(errs, fmt.Errorf("step %s: 'Command' must be set", s.Name))
+	}
+
+	if s.Timeout != nil && *s.Timeout <= 0 {
+		errs = append(errs, fmt.Errorf("step %s: 'Timeout' must be positive", s.Name))
+	}
+
+	for k := range s.Environment {
+		if !envNameRegexp.MatchString(k) {
+			errs = append(errs, fmt.Errorf("step %s: %q is not a valid environment variable name", s.Name, k))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func validateSteps(steps []Step) error {
+	var errs []error
+
+	names := make(map[string]bool, len(steps))
+	for _, s := range steps {
+		if err := s.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+
+		if names[s.Name] {
+			errs = append(errs, fmt.Errorf("duplicate step name %q", s.Name))
+		}
+		names[s.Name] = true
+	}
+
+	return errors.Join(errs...)
+}
+
+// stepIDs numbers the steps in tens, padded so that steps::run, which
+// runs them in lexical order, runs them in the order given.
+func stepIDs(steps []Step) []string {
+	width := max(2, len(fmt.Sprint(len(steps)*10)))
+
+	ids := make([]string, len(steps))
+	for i, s := range steps {
+		ids[i] = fmt.Sprintf("%0*d-%s", width, (i+1)*10, s.Name)
+	}
+
+	return ids
+}
+
+// stepScriptHeader sets a step script up as run.sh does for steps.sh.
+const stepScriptHeader = `#!/usr/bin/env ./opsh
+# shellcheck shell=bash
+
+PATH="$PWD:$PATH"
+
+source ./lib.bash
+source ./env
+`
+
+// addStepsToPayload generates a script for each step, and a steps.sh
+// defining the step::NN-name functions that run them.
+func addStepsToPayload(p *svmkitRunner.Payload, steps []Step) {
+	var functions strings.Builder
+
+	functions.WriteString("# Generated from the command's steps.\n")
+
+	for i, id := range stepIDs(steps) {
+		s := steps[i]
+
+		script := path.Join(stepsDir, id+".sh")
+
+		env := svmkitRunner.NewEnvBuilder()
+		env.SetMap(s.Environment)
+
+		var b strings.Builder
+		b.WriteString(stepScriptHeader)
+		b.WriteString(env.Buffer().String())
+		b.WriteString("\n")
+		b.WriteString(s.Command)
+		b.WriteString("\n")
+
+		p.Add(svmkitRunner.PayloadFile{Path: script, Reader: strings.NewReader(b.String()), Mode: 0755})
+
+		timeout := 0
+		if s.Timeout != nil {
+			timeout = *s.Timeout
+		}
+
+		fmt.Fprintf(&functions, "\nstep::%s() {\n    svmkit::run-step %s %d ./%s\n}\n", id, id, timeout, script)
+	}
+
+	p.AddString(svmkitRunner.ScriptNameSteps, functions.String())
+}
+
+// resumeAuto is the resumeFrom value that resumes at whichever step
+// failed.
+const resumeAuto = "auto"
+
+// stepName is the name of the step with the given id.
+func stepName(id string) string {
+	_, name, _ := strings.Cut(id, "-")
+	return name
+}
+
+// startStep returns the id of the step to start from, or "" to run them
+// all.  A run only resumes if the last one failed, at the step named by
+// resumeFrom, or the failed step if it's "auto".
+func startStep(steps []Step, resumeFrom string, failed string) (string, error) {
+	if resumeFrom == "" || failed == "" {
+		return "", nil
+	}
+
+	name := resumeFrom
+	if name == resumeAuto {
+		name = failed
+	}
+
+	id := ""
+	for i, v := range stepIDs(steps) {
+		if steps[i].Name == name {
+			id = v
+		}
+	}
+
+	if id == "" {
+		if resumeFrom == resumeAuto {
+			return "", fmt.Errorf("step %s, which failed last time, is no longer defined", name)
+		}
+		return "", fmt.Errorf("'ResumeFrom' names step %s, which isn't defined", name)
+	}
+
+	return id, nil
+}
@@ -0,0 +1,133 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	svmkitRunner "github.com/abklabs/pulumi-runner/pkg/runner/core"
+	"github.com/abklabs/pulumi-runner/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStepValidate(t *testing.T) {
+	steps := []Step{
+		{Name: "build", Command: "make"},
+		{Name: "install-files", Command: "make install", Timeout: ptr(60)},
+	}
+	assert.NoError(t, validateSteps(steps))
+
+	steps = []Step{
+		{Name: "build", Command: "make"},
+		{Name: "build", Command: "make"},
+		{Name: "-bad name", Command: "true"},
+		{Name: "empty", Command: "  "},
+		{Name: "slow", Command: "sleep 1", Timeout: ptr(0)},
+		{Name: "env", Command: "true", Environment: map[string]string{"1BAD": "x"}},
+	}
+
+	err := validateSteps(steps)
+	assert.ErrorContains(t, err, `duplicate step name "build"`)
+	assert.ErrorContains(t, err, `step name "-bad name" may only contain`)
+	assert.ErrorContains(t, err, "step empty: 'Command' must be set")
+	assert.ErrorContains(t, err, "step slow: 'Timeout' must be positive")
+	assert.ErrorContains(t, err, `step env: "1BAD" is not a valid environment variable name`)
+}
+
+func TestStepIDs(t *testing.T) {
+	assert.Equal(t, []string{"10-a", "20-b"}, stepIDs([]Step{{Name: "a"}, {Name: "b"}}))
+
+	steps := make([]Step, 10)
+	for i := range steps {
+		steps[i].Name = "s"
+	}
+
+	ids := stepIDs(steps)
+	assert.Equal(t, "010-s", ids[0])
+	assert.Equal(t, "100-s", ids[9])
+}
+
+func TestSSHCommandSteps(t *testing.T) {
+	cmd := NewSSHCommand("", nil, nil, nil, nil)
+	cmd.steps = []Step{
+		{Name: "build", Command: "make", Environment: map[string]string{"TARGET": "all things"}},
+		{Name: "install", Command: "make install", Timeout: ptr(60)},
+	}
+	require.NoError(t, cmd.Check())
+
+	p := &svmkitRunner.Payload{}
+	require.NoError(t, cmd.AddToPayload(p))
+
+	files := map[string]svmkitRunner.PayloadFile{}
+	for _, f := range p.Files {
+		files[f.Path] = f
+	}
+
+	read := func(name string) string {
+		f, ok := files[name]
+		require.True(t, ok, name)
+		b, err := io.ReadAll(f.Reader)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	assert.Equal(t, `# Generated from the command's steps.
+
+step::10-build() {
+    svmkit::run-step 10-build 0 ./steps/10-build.sh
+}
+
+step::20-install() {
+    svmkit::run-step 20-install 60 ./steps/20-install.sh
+}
+`, read(svmkitRunner.ScriptNameSteps))
+
+	build := read("steps/10-build.sh")
+	assert.Contains(t, build, "source ./lib.bash\nsource ./env\nTARGET='all things'\n\nmake\n")
+	assert.Equal(t, 0755, int(files["steps/10-build.sh"].Mode))
+
+	cmd.command = "make"
+	assert.ErrorContains(t, cmd.Check(), "only one of command and steps")
+}
+
+func TestStartStep(t *testing.T) {
+	steps := []Step{{Name: "fetch"}, {Name: "build"}, {Name: "install"}}
+
+	tests := []struct {
+		resumeFrom, failed, want, err string
+	}{
+		{"", "build", "", ""},
+		{"auto", "", "", ""},
+		{"auto", "build", "20-build", ""},
+		{"fetch", "install", "10-fetch", ""},
+		{"fetch", "", "", ""},
+		{"auto", "gone", "", "step gone, which failed last time, is no longer defined"},
+		{"missing", "build", "", "'ResumeFrom' names step missing, which isn't defined"},
+	}
+
+	for _, tt := range tests {
+		got, err := startStep(steps, tt.resumeFrom, tt.failed)
+		if tt.err != "" {
+			assert.EqualError(t, err, tt.err)
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, got, "resumeFrom %q, failed %q", tt.resumeFrom, tt.failed)
+	}
+
+	assert.Equal(t, "install-files", stepName("20-install-files"))
+}
+
+func TestRecordFailedStep(t *testing.T) {
+	state := SSHDeployerState{}
+
+	assert.False(t, recordFailedStep(&state, "create", errors.New("dial failed")))
+	assert.Nil(t, state.FailedStep)
+
+	err := fmt.Errorf("run: %w", &utils.StepError{Step: "20-install-files", Err: errors.New("exit 1")})
+	assert.True(t, recordFailedStep(&state, "update", err))
+	assert.Equal(t, "install-files", deref(state.FailedStep))
+	assert.Equal(t, "update", deref(state.FailedCommand))
+}
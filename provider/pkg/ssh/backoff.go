@@ -0,0 +1,273 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pulumi/pulumi-go-provider/infer"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/util/retry"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	dialPhaseTCP       = "tcp"
+	dialPhaseHandshake = "handshake"
+	dialPhaseAuth      = "auth"
+)
+
+type DialBackoff struct {
+	InitialDelay *float64 `pulumi:"initialDelay,optional"`
+	Multiplier   *float64 `pulumi:"multiplier,optional"`
+	MaxDelay     *float64 `pulumi:"maxDelay,optional"`
+	Jitter       *float64 `pulumi:"jitter,optional"`
+	Deadline     *float64 `pulumi:"deadline,optional"`
+}
+
+func (b *DialBackoff) Annotate(a infer.Annotator) {
+	a.Describe(&b, "Pacing of the retries when dialing the remote host.")
+	a.Describe(&b.InitialDelay, "Seconds to wait before the first retry. Default value is 0.1 seconds.")
+	a.Describe(&b.Multiplier, "Factor the delay grows by after each retry. Default value is 1.5.")
+	a.Describe(&b.MaxDelay, "Max number of seconds to wait between retries. Default value is 5 seconds.")
+	a.Describe(&b.Jitter, "Fraction of each delay, between 0 and 1, to randomly add or subtract. Default value is 0.")
+	a.Describe(&b.Deadline, "Max number of seconds to keep retrying for, across all attempts. 0 implies no maximum. Default value is 0.")
+}
+
+func (b *DialBackoff) Validate() error {
+	if b == nil {
+		return nil
+	}
+
+	var errs []error
+
+	for _, v := range []struct {
+		name  string
+		value *float64
+	}{
+		{"initialDelay", b.InitialDelay},
+		{"maxDelay", b.MaxDelay},
+		{"deadline", b.Deadline},
+	} {
+		if v.value != nil && *v.value < 0 {
+			errs = append(errs, fmt.Errorf("dialBackoff: %s must not be negative", v.name))
+		}
+	}
+
+	if b.Multiplier != nil && *b.Multiplier < 1 {
+		errs = append(errs, fmt.Errorf("dialBackoff: multiplier must be at least 1"))
+	}
+
+	if b.Jitter != nil && (*b.Jitter < 0 || *b.Jitter > 1) {
+		errs = append(errs, fmt.Errorf("dialBackoff: jitter must be between 0 and 1"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func seconds(v float64) time.Duration {
+	return time.Duration(v * float64(time.Second))
+}
+
+// deadline returns the overall time limit for dialing, or zero if there
+// is none.
+func (b *DialBackoff) deadline() time.Duration {
+	if b == nil || b.Deadline == nil {
+		return 0
+	}
+
+	return seconds(*b.Deadline)
+}
+
+// acceptor fills in the pacing of a retry.Acceptor; unset values fall
+// back to the retry package defaults.
+func (b *DialBackoff) acceptor(accept retry.Acceptance) retry.Acceptor {
+	a := retry.Acceptor{Accept: accept}
+
+	if b == nil {
+		return a
+	}
+
+	if b.InitialDelay != nil {
+		d := seconds(*b.InitialDelay)
+		a.Delay = &d
+	}
+
+	a.Backoff = b.Multiplier
+
+	if b.MaxDelay != nil {
+		d := seconds(*b.MaxDelay)
+		a.MaxDelay = &d
+	}
+
+	return a
+}
+
+// retryer returns a retry.Retryer that applies the jitter to each delay.
+func (b *DialBackoff) retryer() *retry.Retryer {
+	if b == nil || b.Jitter == nil || *b.Jitter == 0 {
+		return &retry.Retryer{}
+	}
+
+	jitter := *b.Jitter
+
+	return &retry.Retryer{
+		After: func(d time.Duration) <-chan time.Time {
+			factor := 1 + jitter*(2*rand.Float64()-1)
+			return time.After(time.Duration(float64(d) * factor))
+		},
+	}
+}
+
+// dialError records which phase of establishing a connection failed.
+type dialError struct {
+	phase string
+	err   error
+}
+
+func (e *dialError) Error() string {
+	return fmt.Sprintf("%s: %v", e.phase, e.err)
+}
+
+func (e *dialError) Unwrap() error {
+	return e.err
+}
+
+// retryable reports whether trying again could succeed.  Failed
+// authentication and host key mismatches won't fix themselves.
+func (e *dialError) retryable() bool {
+	if e.phase == dialPhaseAuth {
+		return false
+	}
+
+	var keyErr *knownhosts.KeyError
+	var revokedErr *knownhosts.RevokedError
+
+	return !errors.As(e.err, &keyErr) && !errors.As(e.err, &revokedErr)
+}
+
+// isRetryable reports whether an error from a dial attempt is worth
+// retrying.  Errors that weren't classified are assumed to be.
+func isRetryable(err error) bool {
+	var dialErr *dialError
+	if errors.As(err, &dialErr) {
+		return dialErr.retryable()
+	}
+
+	return true
+}
+
+func dialPhase(err error) string {
+	var dialErr *dialError
+	if errors.As(err, &dialErr) {
+		return dialErr.phase
+	}
+
+	return "dial"
+}
+
+// authFailureMessage is part of how x/crypto reports that none of the
+// authentication methods succeeded.  It's only relied on when no attempt
+// was observed, as when the server refuses "none" and the client has no
+// other methods to offer.
+const authFailureMessage = "unable to authenticate"
+
+// authAttempts follows a single attempt at establishing a client, to tell
+// a failure to authenticate from one earlier in the handshake.  Its
+// methods can be called on a nil *authAttempts, which observes nothing.
+type authAttempts struct {
+	mu       sync.Mutex
+	keyed    bool
+	attempts int
+}
+
+func (a *authAttempts) reset() {
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.keyed, a.attempts = false, 0
+}
+
+// observe is passed to clientConfig, to be called as each method is
+// attempted.
+func (a *authAttempts) observe(method string) {
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.attempts++
+}
+
+func (a *authAttempts) wrapHostKeyCallback(cb ssh.HostKeyCallback) ssh.HostKeyCallback {
+	if a == nil {
+		return cb
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if err := cb(hostname, remote, key); err != nil {
+			return err
+		}
+
+		a.mu.Lock()
+		defer a.mu.Unlock()
+
+		a.keyed = true
+		return nil
+	}
+}
+
+// authenticating reports whether the handshake got as far as
+// authentication: the host key was accepted and a method was tried.
+func (a *authAttempts) authenticating() bool {
+	if a == nil {
+		return false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.keyed && a.attempts > 0
+}
+
+// newClient establishes an SSH client over an existing connection,
+// classifying any failure as a handshake or authentication error.  The
+// config's authentication methods and host key callback should report
+// to attempts.
+func newClient(conn net.Conn, endpoint string, config *ssh.ClientConfig, attempts *authAttempts) (*ssh.Client, error) {
+	attempts.reset()
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, endpoint, config)
+	if err != nil {
+		conn.Close()
+
+		phase := dialPhaseHandshake
+		if attempts.authenticating() || strings.Contains(err.Error(), authFailureMessage) {
+			phase = dialPhaseAuth
+		}
+
+		return nil, &dialError{phase: phase, err: err}
+	}
+
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// dialClient dials endpoint directly and establishes an SSH client.
+func dialClient(endpoint string, config *ssh.ClientConfig, attempts *authAttempts) (*ssh.Client, error) {
+	conn, err := net.DialTimeout("tcp", endpoint, config.Timeout)
+	if err != nil {
+		return nil, &dialError{phase: dialPhaseTCP, err: err}
+	}
+
+	return newClient(conn, endpoint, config, attempts)
+}
@@ -0,0 +1,178 @@
+package ssh
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestDialWithRetryAuthNotRetried(t *testing.T) {
+	attempts := 0
+
+	_, err := dialWithRetry(context.Background(), "Dial", dialErrorUnlimited, nil, func() (int, error) {
+		attempts++
+		return 0, &dialError{phase: dialPhaseAuth, err: errors.New("ssh: unable to authenticate")}
+	})
+
+	assert.ErrorContains(t, err, "not retryable: auth: ssh: unable to authenticate")
+	assert.Equal(t, 1, attempts)
+}
+
+func TestDialWithRetryLimit(t *testing.T) {
+	attempts := 0
+	backoff := &DialBackoff{InitialDelay: ptr(0.001), Jitter: ptr(0.5)}
+
+	_, err := dialWithRetry(context.Background(), "Dial", 2, backoff, func() (int, error) {
+		attempts++
+		return 0, &dialError{phase: dialPhaseTCP, err: errors.New("connection refused")}
+	})
+
+	assert.ErrorContains(t, err, "after 2 failed attempts: tcp: connection refused")
+	assert.Equal(t, 3, attempts)
+}
+
+func TestDialWithRetryDeadline(t *testing.T) {
+	backoff := &DialBackoff{InitialDelay: ptr(0.01), Multiplier: ptr(1.0), Deadline: ptr(0.05)}
+
+	_, err := dialWithRetry(context.Background(), "Dial", dialErrorUnlimited, backoff, func() (int, error) {
+		return 0, &dialError{phase: dialPhaseHandshake, err: errors.New("connection reset")}
+	})
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, "handshake: connection reset")
+}
+
+func TestDialWithRetrySuccess(t *testing.T) {
+	attempts := 0
+	backoff := &DialBackoff{InitialDelay: ptr(0.001)}
+
+	v, err := dialWithRetry(context.Background(), "Dial", dialErrorDefault, backoff, func() (int, error) {
+		attempts++
+		if attempts < 3 {
+			return 0, errors.New("not yet")
+		}
+		return 42, nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 42, v)
+}
+
+func TestDialBackoffValidate(t *testing.T) {
+	assert.NoError(t, (*DialBackoff)(nil).Validate())
+
+	backoff := &DialBackoff{InitialDelay: ptr(-1.0), Multiplier: ptr(0.5), Jitter: ptr(2.0)}
+	err := backoff.Validate()
+
+	assert.ErrorContains(t, err, "initialDelay must not be negative")
+	assert.ErrorContains(t, err, "multiplier must be at least 1")
+	assert.ErrorContains(t, err, "jitter must be between 0 and 1")
+}
+
+// passwordServer starts a server that only takes the password "right",
+// returning its address.
+func passwordServer(t *testing.T) string {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if string(password) != "right" {
+				return nil, errors.New("wrong password")
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				_, _, _, _ = ssh.NewServerConn(conn, config)
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func dialPasswordServer(t *testing.T, config *ssh.ClientConfig, attempts *authAttempts) error {
+	t.Helper()
+
+	config.User = "test"
+	config.Timeout = 5 * time.Second
+	if config.HostKeyCallback == nil {
+		config.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+	}
+	config.HostKeyCallback = attempts.wrapHostKeyCallback(config.HostKeyCallback)
+
+	client, err := dialClient(passwordServer(t), config, attempts)
+	if err == nil {
+		_ = client.Close()
+	}
+
+	return err
+}
+
+func TestNewClientAuthObserved(t *testing.T) {
+	attempts := &authAttempts{}
+
+	err := dialPasswordServer(t, &ssh.ClientConfig{
+		Auth: []ssh.AuthMethod{ssh.PasswordCallback(func() (string, error) {
+			attempts.observe(authMethodPassword)
+			return "wrong", nil
+		})},
+	}, attempts)
+
+	assert.Equal(t, dialPhaseAuth, dialPhase(err))
+	assert.True(t, attempts.authenticating())
+}
+
+func TestNewClientHostKeyRejected(t *testing.T) {
+	attempts := &authAttempts{}
+
+	err := dialPasswordServer(t, &ssh.ClientConfig{
+		Auth: []ssh.AuthMethod{ssh.PasswordCallback(func() (string, error) {
+			attempts.observe(authMethodPassword)
+			return "right", nil
+		})},
+		HostKeyCallback: func(string, net.Addr, ssh.PublicKey) error {
+			return errors.New("unknown host key")
+		},
+	}, attempts)
+
+	assert.Equal(t, dialPhaseHandshake, dialPhase(err))
+	assert.False(t, attempts.authenticating())
+}
+
+// TestAuthFailureMessage pins the message the fallback looks for, as
+// x/crypto reports it when no method could even be attempted.
+func TestAuthFailureMessage(t *testing.T) {
+	err := dialPasswordServer(t, &ssh.ClientConfig{}, nil)
+
+	assert.ErrorContains(t, err, "ssh: handshake failed: ssh: "+authFailureMessage+", attempted methods [none], no supported methods remain")
+	assert.Equal(t, dialPhaseAuth, dialPhase(err))
+}
@@ -16,6 +16,7 @@ package ssh
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os"
@@ -23,7 +24,6 @@ import (
 
 	p "github.com/pulumi/pulumi-go-provider"
 	"github.com/pulumi/pulumi-go-provider/infer"
-	"github.com/pulumi/pulumi/sdk/v3/go/common/util/retry"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
 )
@@ -39,19 +39,22 @@ var (
 
 type Connection struct {
 	connectionBase
-	Proxy *ProxyConnection `pulumi:"proxy,optional"`
+	Proxy        *ProxyConnection `pulumi:"proxy,optional"`
+	SSHConfig    *string          `pulumi:"sshConfig,optional"`
+	ForwardAgent *bool            `pulumi:"forwardAgent,optional"`
 }
 
 type connectionBase struct {
-	User               *string  `pulumi:"user,optional"`
-	Password           *string  `pulumi:"password,optional"`
-	Host               *string  `pulumi:"host"`
-	Port               *float64 `pulumi:"port,optional"`
-	PrivateKey         *string  `pulumi:"privateKey,optional"`
-	PrivateKeyPassword *string  `pulumi:"privateKeyPassword,optional"`
-	AgentSocketPath    *string  `pulumi:"agentSocketPath,optional"`
-	DialErrorLimit     *int     `pulumi:"dialErrorLimit,optional"`
-	PerDialTimeout     *int     `pulumi:"perDialTimeout,optional"`
+	User               *string      `pulumi:"user,optional"`
+	Password           *string      `pulumi:"password,optional"`
+	Host               *string      `pulumi:"host"`
+	Port               *float64     `pulumi:"port,optional"`
+	PrivateKey         *string      `pulumi:"privateKey,optional"`
+	PrivateKeyPassword *string      `pulumi:"privateKeyPassword,optional"`
+	AgentSocketPath    *string      `pulumi:"agentSocketPath,optional"`
+	DialErrorLimit     *int         `pulumi:"dialErrorLimit,optional"`
+	PerDialTimeout     *int         `pulumi:"perDialTimeout,optional"`
+	DialBackoff        *DialBackoff `pulumi:"dialBackoff,optional"`
 }
 
 func (c *Connection) Annotate(a infer.Annotator) {
@@ -70,9 +73,24 @@ func (c *Connection) Annotate(a infer.Annotator) {
 	a.SetDefault(&c.DialErrorLimit, dialErrorDefault)
 	a.Describe(&c.PerDialTimeout, "Max number of seconds for each dial attempt. 0 implies no maximum. Default value is 15 seconds.")
 	a.SetDefault(&c.PerDialTimeout, 15)
+	a.Describe(&c.DialBackoff, "Pacing of the retries when dialing the remote host. Authentication failures are never retried.")
+	a.Describe(&c.SSHConfig, "An OpenSSH client configuration, either as a path to a file or as inline contents, used to resolve HostName, User, Port, IdentityFile, ProxyJump and UserKnownHostsFile for the host. Explicit inputs take precedence, except that a user of root and a port of 22 can't be told from the defaults, so the configuration overrides them, which is logged.")
+	a.Describe(&c.ForwardAgent, "Forward the local SSH agent to the remote command's session. Defaults to false.")
 }
 
 func (con *connectionBase) SShConfig() (*ssh.ClientConfig, error) {
+	return con.clientConfig(nil)
+}
+
+// clientConfig builds the client configuration, calling observe (if not
+// nil) with the name of each authentication method as it's attempted.
+func (con *connectionBase) clientConfig(observe func(method string)) (*ssh.ClientConfig, error) {
+	attempt := func(method string) {
+		if observe != nil {
+			observe(method)
+		}
+	}
+
 	config := &ssh.ClientConfig{
 		User:            *con.User,
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
@@ -89,12 +107,19 @@ func (con *connectionBase) SShConfig() (*ssh.ClientConfig, error) {
 		if err != nil {
 			return nil, err
 		}
-		config.Auth = append(config.Auth, ssh.PublicKeys(signer))
+		config.Auth = append(config.Auth, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			attempt(authMethodPublicKey)
+			return []ssh.Signer{signer}, nil
+		}))
 	}
 	if con.Password != nil {
-		config.Auth = append(config.Auth, ssh.Password(*con.Password))
+		config.Auth = append(config.Auth, ssh.PasswordCallback(func() (string, error) {
+			attempt(authMethodPassword)
+			return *con.Password, nil
+		}))
 		config.Auth = append(config.Auth, ssh.KeyboardInteractive(
 			func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+				attempt(authMethodKeyboardInteractive)
 				answers := make([]string, len(questions))
 				for i := range questions {
 					answers[i] = *con.Password
@@ -102,34 +127,75 @@ func (con *connectionBase) SShConfig() (*ssh.ClientConfig, error) {
 				return answers, nil
 			}))
 	}
-	var sshAgentSocketPath *string
-	if con.AgentSocketPath != nil {
-		sshAgentSocketPath = con.AgentSocketPath
-	}
-	if envAgentSocketPath := os.Getenv(sshAgentSocketEnvVar); sshAgentSocketPath == nil && envAgentSocketPath != "" {
-		sshAgentSocketPath = &envAgentSocketPath
-	}
-	if sshAgentSocketPath != nil {
+	if sshAgentSocketPath := con.agentSocketPath(); sshAgentSocketPath != nil {
 		conn, err := net.Dial("unix", *sshAgentSocketPath)
 		if err != nil {
 			return nil, err
 		}
-		config.Auth = append(config.Auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		agentClient := agent.NewClient(conn)
+		config.Auth = append(config.Auth, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			attempt(authMethodAgent)
+			return agentClient.Signers()
+		}))
 	}
 
 	return config, nil
 }
 
-func dialWithRetry[T any](ctx context.Context, msg string, maxAttempts int, f func() (T, error)) (T, error) {
+func (con *connectionBase) agentSocketPath() *string {
+	if con.AgentSocketPath != nil {
+		return con.AgentSocketPath
+	}
+	if envAgentSocketPath := os.Getenv(sshAgentSocketEnvVar); envAgentSocketPath != "" {
+		return &envAgentSocketPath
+	}
+	return nil
+}
+
+// dialAgent connects to the SSH agent used for the connection, for use
+// in agent forwarding.
+func (con *connectionBase) dialAgent() (net.Conn, error) {
+	sshAgentSocketPath := con.agentSocketPath()
+	if sshAgentSocketPath == nil {
+		return nil, fmt.Errorf("no SSH agent socket available; set agentSocketPath or %s", sshAgentSocketEnvVar)
+	}
+
+	conn, err := net.Dial("unix", *sshAgentSocketPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SSH agent: %w", err)
+	}
+
+	return conn, nil
+}
+
+func dialWithRetry[T any](ctx context.Context, msg string, maxAttempts int, backoff *DialBackoff, f func() (T, error)) (T, error) {
+	var t T
+
+	if err := backoff.Validate(); err != nil {
+		return t, err
+	}
+
+	if deadline := backoff.deadline(); deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, deadline)
+		defer cancel()
+	}
+
 	var userError error
-	_, data, err := retry.Until(ctx, retry.Acceptor{
-		Accept: func(try int, _ time.Duration) (bool, any, error) {
+	ok, data, err := backoff.retryer().Until(ctx, backoff.acceptor(
+		func(try int, nextRetry time.Duration) (bool, any, error) {
 			var result T
 			result, userError = f()
 			if userError == nil {
 				return true, result, nil
 			}
 			dials := try + 1
+			phase := dialPhase(userError)
+			if !isRetryable(userError) {
+				p.GetLogger(ctx).InfoStatusf("%s %d failed during %s (not retryable)",
+					msg, dials, phase)
+				return true, nil, fmt.Errorf("not retryable: %w", userError)
+			}
 			if reachedDialingErrorLimit(dials, maxAttempts) {
 				return true, nil, fmt.Errorf("after %d failed attempts: %w",
 					try, userError)
@@ -140,73 +206,108 @@ func dialWithRetry[T any](ctx context.Context, msg string, maxAttempts int, f fu
 			} else {
 				limit = fmt.Sprintf("%d", maxAttempts)
 			}
-			p.GetLogger(ctx).InfoStatusf("%s %d/%s failed: retrying",
-				msg, dials, limit)
+			p.GetLogger(ctx).InfoStatusf("%s %d/%s failed during %s (retryable): retrying in %s",
+				msg, dials, limit, phase, nextRetry.Round(time.Millisecond))
 			return false, nil, nil
-		},
-	})
-	if err == nil {
-		return data.(T), nil
+		}))
+	if err != nil {
+		return t, err
 	}
 
-	var t T
-	return t, err
+	if !ok {
+		return t, fmt.Errorf("gave up retrying: %w", errors.Join(ctx.Err(), userError))
+	}
+
+	return data.(T), nil
 }
 
 // Dial a ssh client connection from a ssh client configuration, retrying as necessary.
+// If the connection forwards the agent, it's set up on the client here,
+// once, so each session only has to request it.
 func (con *Connection) Dial(ctx context.Context) (*ssh.Client, error) {
-	config, err := con.SShConfig()
+	client, err := con.dial(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if con.AgentForwarding() {
+		if err := con.forwardAgent(client); err != nil {
+			return nil, errors.Join(err, client.Close())
+		}
+	}
+
+	return client, nil
+}
+
+func (con *Connection) dial(ctx context.Context, obs *dialObserver) (*ssh.Client, error) {
+	con, hostKeyCallback, err := con.resolveSSHConfig(p.GetLogger(ctx).Infof)
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := &authAttempts{}
+
+	config, err := con.clientConfig(func(method string) {
+		attempts.observe(method)
+		obs.observeAuth(method)
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	if hostKeyCallback != nil {
+		config.HostKeyCallback = hostKeyCallback
+	}
+
+	config.HostKeyCallback = attempts.wrapHostKeyCallback(obs.wrapHostKeyCallback(config.HostKeyCallback))
+
 	endpoint := net.JoinHostPort(*con.Host, fmt.Sprintf("%d", int(*con.Port)))
 	tries := con.getDialErrorLimit()
 	if con.Proxy == nil {
-		return dialWithRetry(ctx, "Dial", tries, func() (*ssh.Client, error) {
-			return ssh.Dial("tcp", endpoint, config)
+		return dialWithRetry(ctx, "Dial", tries, con.DialBackoff, func() (*ssh.Client, error) {
+			return dialClient(endpoint, config, attempts)
 		})
 	}
 
-	proxyConfig, err := con.Proxy.SShConfig()
+	proxyAttempts := &authAttempts{}
+
+	proxyConfig, err := con.Proxy.clientConfig(proxyAttempts.observe)
 	if err != nil {
 		return nil, fmt.Errorf("proxy: %w", err)
 	}
 
+	if hostKeyCallback != nil {
+		proxyConfig.HostKeyCallback = hostKeyCallback
+	}
+
+	proxyConfig.HostKeyCallback = proxyAttempts.wrapHostKeyCallback(proxyConfig.HostKeyCallback)
+
 	proxyTries := con.Proxy.getDialErrorLimit()
 	// The user has specified a proxy connection. First, connect to the proxy:
-	proxyClient, err := dialWithRetry(ctx, "Dial proxy", proxyTries, func() (*ssh.Client, error) {
-		return ssh.Dial("tcp",
+	proxyClient, err := dialWithRetry(ctx, "Dial proxy", proxyTries, con.Proxy.DialBackoff, func() (*ssh.Client, error) {
+		return dialClient(
 			net.JoinHostPort(*con.Proxy.Host, fmt.Sprintf("%d", int(*con.Proxy.Port))),
-			proxyConfig)
+			proxyConfig, proxyAttempts)
 	})
 	if err != nil {
 		return nil, fmt.Errorf("proxy: %w", err)
 	}
 
 	// Having connected with the proxy, we establish a connection from our proxy to
-	// our server.
-	conn, err := dialWithRetry(ctx, "Dial from proxy", tries, func() (net.Conn, error) {
-		return proxyClient.Dial("tcp", endpoint)
-	})
-	if err != nil {
-		return nil, fmt.Errorf("proxy: %w", err)
-	}
+	// our server, and initiate a SSH connection over that bridge.
+	client, err := dialWithRetry(ctx, "Dial from proxy", tries, con.DialBackoff, func() (*ssh.Client, error) {
+		conn, err := proxyClient.Dial("tcp", endpoint)
+		if err != nil {
+			return nil, &dialError{phase: dialPhaseTCP, err: err}
+		}
 
-	// We initiate a SSH connection over the bridge we just established.
-	var channel <-chan ssh.NewChannel
-	var req <-chan *ssh.Request
-	proxyConn, err := dialWithRetry(ctx, "Dial", tries, func() (ssh.Conn, error) {
-		c, ch, r, err := ssh.NewClientConn(conn, endpoint, config)
-		channel = ch
-		req = r
-		return c, err
+		return newClient(conn, endpoint, config, attempts)
 	})
 	if err != nil {
 		return nil, fmt.Errorf("proxy: %w", err)
 	}
 
-	return ssh.NewClient(proxyConn, channel, req), nil
+	return client, nil
 }
 
 func (con connectionBase) getDialErrorLimit() int {
@@ -220,3 +321,29 @@ func reachedDialingErrorLimit(dials, dialErrorLimit int) bool {
 	return dialErrorLimit > dialErrorUnlimited &&
 		dials > dialErrorLimit
 }
+
+// AgentForwarding reports whether the connection forwards the local
+// SSH agent to remote sessions.
+func (con *Connection) AgentForwarding() bool {
+	return con.ForwardAgent != nil && *con.ForwardAgent
+}
+
+// forwardAgent serves the agent channels the remote host opens over
+// client from the local agent, until the client is closed.
+func (con *Connection) forwardAgent(client *ssh.Client) error {
+	conn, err := con.dialAgent()
+	if err != nil {
+		return err
+	}
+
+	if err := agent.ForwardToAgent(client, agent.NewClient(conn)); err != nil {
+		return errors.Join(fmt.Errorf("failed to set up SSH agent forwarding: %w", err), conn.Close())
+	}
+
+	go func() {
+		_ = client.Wait()
+		_ = conn.Close()
+	}()
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package ssh
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/abklabs/pulumi-runner/pkg/ssh/sshtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// serveAgent serves an agent holding one key on a Unix socket.
+func serveAgent(t *testing.T) string {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	keyring := agent.NewKeyring()
+	require.NoError(t, keyring.Add(agent.AddedKey{PrivateKey: key}))
+
+	path := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_ = agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+
+	return path
+}
+
+func TestDialForwardsAgentOnce(t *testing.T) {
+	server := sshtest.NewServer(t)
+	host, port := server.HostPort()
+
+	con := Connection{
+		connectionBase: connectionBase{
+			User:            ptr("test"),
+			Host:            &host,
+			Port:            ptr(float64(port)),
+			AgentSocketPath: ptr(serveAgent(t)),
+			DialErrorLimit:  ptr(1),
+			PerDialTimeout:  ptr(5),
+		},
+		ForwardAgent: ptr(true),
+	}
+	require.True(t, con.AgentForwarding())
+
+	client, err := con.Dial(context.Background())
+	require.NoError(t, err)
+	defer client.Close()
+
+	for range 2 {
+		session, err := client.NewSession()
+		require.NoError(t, err)
+		require.NoError(t, agent.RequestAgentForwarding(session))
+		require.NoError(t, session.Run("true"))
+	}
+
+	assert.Equal(t, []int{1, 1}, server.AgentKeys())
+}
@@ -0,0 +1,239 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kballard/go-shellquote"
+	"github.com/pulumi/pulumi-go-provider/infer"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	authMethodPublicKey           = "publickey"
+	authMethodPassword            = "password"
+	authMethodKeyboardInteractive = "keyboard-interactive"
+	authMethodAgent               = "agent"
+
+	// The runner places its payloads under this directory.
+	defaultPayloadRoot = "/tmp"
+)
+
+// factsScript reports the host facts as key=value lines, followed by the
+// contents of /etc/os-release prefixed with "os.".
+const factsScript = `
+echo "arch=$(uname -m)"
+echo "kernel=$(uname -r)"
+echo "bash=$BASH_VERSION"
+echo "cpus=$(getconf _NPROCESSORS_ONLN)"
+echo "memory=$(awk '/^MemTotal:/ { print $2 * 1024 }' /proc/meminfo)"
+echo "freeDisk=$(( $(stat -f -c '%a * %S' "$1") ))"
+if [[ -r /etc/os-release ]]; then
+    sed -n 's/^\([A-Za-z0-9_]*=\)/os.\1/p' /etc/os-release
+fi
+`
+
+// dialObserver records details of how a connection was established.
+type dialObserver struct {
+	mu         sync.Mutex
+	hostKey    ssh.PublicKey
+	authMethod string
+}
+
+func (o *dialObserver) observeAuth(method string) {
+	if o == nil {
+		return
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	// Methods are attempted in turn until one succeeds, so the last
+	// one attempted is the one that was used.
+	o.authMethod = method
+}
+
+func (o *dialObserver) wrapHostKeyCallback(cb ssh.HostKeyCallback) ssh.HostKeyCallback {
+	if o == nil {
+		return cb
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if err := cb(hostname, remote, key); err != nil {
+			return err
+		}
+
+		o.mu.Lock()
+		defer o.mu.Unlock()
+
+		o.hostKey = key
+		return nil
+	}
+}
+
+type ProbeArgs struct {
+	Connection  Connection `pulumi:"connection"`
+	PayloadRoot *string    `pulumi:"payloadRoot,optional"`
+}
+
+func (p *ProbeArgs) Annotate(a infer.Annotator) {
+	a.Describe(&p.Connection, "The connection to check.")
+	a.Describe(&p.PayloadRoot, "The directory to report free disk space for. Defaults to /tmp, where payloads are placed.")
+	a.SetDefault(&p.PayloadRoot, defaultPayloadRoot)
+}
+
+type HostFacts struct {
+	OSRelease     map[string]string `pulumi:"osRelease"`
+	Arch          string            `pulumi:"arch"`
+	Kernel        string            `pulumi:"kernel"`
+	BashVersion   string            `pulumi:"bashVersion"`
+	CPUs          int               `pulumi:"cpus"`
+	MemoryBytes   float64           `pulumi:"memoryBytes"`
+	FreeDiskBytes float64           `pulumi:"freeDiskBytes"`
+
+	// PackageManager is empty if the host's distribution isn't one
+	// the runner knows how to install packages on.  It's filled in from
+	// OSRelease by the caller, as ProbeHost doesn't know the package
+	// managers.
+	PackageManager string `pulumi:"packageManager,optional"`
+}
+
+func (f *HostFacts) Annotate(a infer.Annotator) {
+	a.Describe(&f.OSRelease, "The contents of /etc/os-release.")
+	a.Describe(&f.Arch, "The machine architecture, as reported by uname -m.")
+	a.Describe(&f.Kernel, "The kernel release, as reported by uname -r.")
+	a.Describe(&f.BashVersion, "The version of bash on the host.")
+	a.Describe(&f.CPUs, "The number of online CPUs.")
+	a.Describe(&f.MemoryBytes, "The total memory in bytes.")
+	a.Describe(&f.FreeDiskBytes, "The free disk space in bytes at the payload root.")
+	a.Describe(&f.PackageManager, "The host's package manager, apt or dnf, as detected from its os-release.")
+}
+
+type ProbeResult struct {
+	HostKeyFingerprint string    `pulumi:"hostKeyFingerprint"`
+	ServerVersion      string    `pulumi:"serverVersion"`
+	AuthMethod         string    `pulumi:"authMethod"`
+	Facts              HostFacts `pulumi:"facts"`
+}
+
+func (r *ProbeResult) Annotate(a infer.Annotator) {
+	a.Describe(&r.HostKeyFingerprint, "The SHA256 fingerprint of the host key.")
+	a.Describe(&r.ServerVersion, "The SSH server's version string.")
+	a.Describe(&r.AuthMethod, "The authentication method used: publickey, agent, password or keyboard-interactive.")
+	a.Describe(&r.Facts, "Facts gathered from the host.")
+}
+
+// ProbeHost dials a connection and reports details of the host.
+func ProbeHost(ctx context.Context, input ProbeArgs) (result ProbeResult, err error) {
+	obs := &dialObserver{}
+
+	client, err := input.Connection.dial(ctx, obs)
+	if err != nil {
+		return result, fmt.Errorf("failed to dial SSH connection to host: %w", err)
+	}
+
+	defer func() {
+		err = errors.Join(err, client.Close())
+	}()
+
+	result.ServerVersion = string(client.ServerVersion())
+	result.AuthMethod = obs.authMethod
+
+	if obs.hostKey != nil {
+		result.HostKeyFingerprint = ssh.FingerprintSHA256(obs.hostKey)
+	}
+
+	payloadRoot := defaultPayloadRoot
+	if input.PayloadRoot != nil {
+		payloadRoot = *input.PayloadRoot
+	}
+
+	result.Facts, err = gatherFacts(client, payloadRoot)
+
+	return result, err
+}
+
+func gatherFacts(client *ssh.Client, payloadRoot string) (facts HostFacts, err error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return facts, fmt.Errorf("failed to create SSH session: %w", err)
+	}
+
+	defer func() {
+		if closeErr := session.Close(); closeErr != io.EOF {
+			err = errors.Join(err, closeErr)
+		}
+	}()
+
+	session.Stdin = strings.NewReader(factsScript)
+
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+
+	out, err := session.Output("bash -s -- " + shellquote.Join(payloadRoot))
+	if err != nil {
+		return facts, fmt.Errorf("failed to gather host facts (output: %q): %w", stderr.String(), err)
+	}
+
+	return parseFacts(out)
+}
+
+func parseFacts(out []byte) (HostFacts, error) {
+	facts := HostFacts{OSRelease: map[string]string{}}
+
+	var errs []error
+
+	parseNumber := func(key, value string) float64 {
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s %q", key, value))
+		}
+		return n
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		key, value, ok := strings.Cut(s.Text(), "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "arch":
+			facts.Arch = value
+		case "kernel":
+			facts.Kernel = value
+		case "bash":
+			facts.BashVersion = value
+		case "cpus":
+			facts.CPUs = int(parseNumber(key, value))
+		case "memory":
+			facts.MemoryBytes = parseNumber(key, value)
+		case "freeDisk":
+			facts.FreeDiskBytes = parseNumber(key, value)
+		default:
+			name, ok := strings.CutPrefix(key, "os.")
+			if !ok {
+				continue
+			}
+
+			words, err := shellquote.Split(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid os-release value for %s: %w", name, err))
+				continue
+			}
+
+			facts.OSRelease[name] = strings.Join(words, " ")
+		}
+	}
+
+	return facts, errors.Join(errs...)
+}
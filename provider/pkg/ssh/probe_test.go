@@ -0,0 +1,56 @@
+package ssh
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFacts(t *testing.T) {
+	out := `arch=x86_64
+kernel=6.1.0-18-amd64
+bash=5.2.15(1)-release
+cpus=8
+memory=33554432000
+freeDisk=107374182400
+os.PRETTY_NAME="Debian GNU/Linux 12 (bookworm)"
+os.ID=debian
+os.VERSION_ID="12"
+`
+
+	facts, err := parseFacts([]byte(out))
+	require.NoError(t, err)
+
+	assert.Equal(t, "x86_64", facts.Arch)
+	assert.Equal(t, "6.1.0-18-amd64", facts.Kernel)
+	assert.Equal(t, "5.2.15(1)-release", facts.BashVersion)
+	assert.Equal(t, 8, facts.CPUs)
+	assert.Equal(t, float64(33554432000), facts.MemoryBytes)
+	assert.Equal(t, float64(107374182400), facts.FreeDiskBytes)
+	assert.Equal(t, map[string]string{
+		"PRETTY_NAME": "Debian GNU/Linux 12 (bookworm)",
+		"ID":          "debian",
+		"VERSION_ID":  "12",
+	}, facts.OSRelease)
+}
+
+func TestParseFactsInvalid(t *testing.T) {
+	_, err := parseFacts([]byte("cpus=many\nos.NAME=\"unterminated\n"))
+
+	assert.ErrorContains(t, err, `invalid cpus "many"`)
+	assert.ErrorContains(t, err, "invalid os-release value for NAME")
+}
+
+func TestDialObserver(t *testing.T) {
+	var obs *dialObserver
+
+	// A nil observer is a no-op.
+	obs.observeAuth(authMethodPassword)
+
+	obs = &dialObserver{}
+	obs.observeAuth(authMethodPublicKey)
+	obs.observeAuth(authMethodAgent)
+
+	assert.Equal(t, authMethodAgent, obs.authMethod)
+}
@@ -35,4 +35,5 @@ func (c *ProxyConnection) Annotate(a infer.Annotator) {
 	a.SetDefault(&c.DialErrorLimit, dialErrorDefault)
 	a.Describe(&c.PerDialTimeout, "Max number of seconds for each dial attempt. 0 implies no maximum. Default value is 15 seconds.")
 	a.SetDefault(&c.PerDialTimeout, 15)
+	a.Describe(&c.DialBackoff, "Pacing of the retries when dialing the remote host. Authentication failures are never retried.")
 }
@@ -0,0 +1,306 @@
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kevinburke/ssh_config"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	defaultUser = "root"
+	defaultPort = 22
+)
+
+// sshConfig is a parsed OpenSSH client configuration.
+type sshConfig struct {
+	cfg *ssh_config.Config
+}
+
+// loadSSHConfig parses an OpenSSH client configuration.  The spec is
+// treated as inline contents if it spans multiple lines, otherwise it
+// is treated as a path to a configuration file.
+func loadSSHConfig(spec string) (*sshConfig, error) {
+	var (
+		cfg *ssh_config.Config
+		err error
+	)
+
+	if strings.Contains(spec, "\n") {
+		cfg, err = ssh_config.DecodeBytes([]byte(spec))
+	} else {
+		var f *os.File
+
+		f, err = os.Open(expandHome(strings.TrimSpace(spec)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open ssh config: %w", err)
+		}
+		defer f.Close()
+
+		cfg, err = ssh_config.Decode(f)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ssh config: %w", err)
+	}
+
+	return &sshConfig{cfg: cfg}, nil
+}
+
+// get returns the first value of key for the given host alias, or the
+// empty string if the configuration doesn't set it.
+func (c *sshConfig) get(alias, key string) (val string, err error) {
+	// The parser panics on directives it can't evaluate (e.g. Match).
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("ssh config lookup of %s for %q failed: %v", key, alias, r)
+		}
+	}()
+
+	return c.cfg.Get(alias, key)
+}
+
+// getAll returns every value of key for the given host alias.
+func (c *sshConfig) getAll(alias, key string) (vals []string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("ssh config lookup of %s for %q failed: %v", key, alias, r)
+		}
+	}()
+
+	return c.cfg.GetAll(alias, key)
+}
+
+// apply fills in the connection settings from the configuration for the
+// connection's host alias.  Explicit inputs take precedence; the schema
+// defaults for user and port are treated as unset, as an explicit root or
+// 22 can't be told from them, so logf (if not nil) is told when the
+// configuration replaces one.  It returns the ProxyJump and
+// UserKnownHostsFile settings for the alias, if any.
+func (c *sshConfig) apply(con *connectionBase, logf func(format string, args ...any)) (proxyJump string, knownHosts []string, err error) {
+	alias := *con.Host
+
+	replaced := func(key string, value, def any) {
+		if logf != nil {
+			logf("ssh config sets %s %v for %q, replacing the default %v, which an explicit %v can't be told from", key, value, alias, def, def)
+		}
+	}
+
+	hostName, err := c.get(alias, "HostName")
+	if err != nil {
+		return "", nil, err
+	}
+
+	if hostName != "" {
+		hostName = strings.ReplaceAll(hostName, "%h", alias)
+		con.Host = &hostName
+	}
+
+	if con.User == nil || *con.User == defaultUser {
+		user, err := c.get(alias, "User")
+		if err != nil {
+			return "", nil, err
+		}
+
+		if user != "" {
+			if con.User != nil && user != defaultUser {
+				replaced("User", user, defaultUser)
+			}
+
+			con.User = &user
+		}
+	}
+
+	if con.Port == nil || int(*con.Port) == defaultPort {
+		port, err := c.get(alias, "Port")
+		if err != nil {
+			return "", nil, err
+		}
+
+		if port != "" {
+			n, err := strconv.Atoi(port)
+			if err != nil {
+				return "", nil, fmt.Errorf("invalid Port %q in ssh config for %q: %w", port, alias, err)
+			}
+
+			if con.Port != nil && n != defaultPort {
+				replaced("Port", n, defaultPort)
+			}
+
+			f := float64(n)
+			con.Port = &f
+		}
+	}
+
+	if con.PrivateKey == nil {
+		files, err := c.getAll(alias, "IdentityFile")
+		if err != nil {
+			return "", nil, err
+		}
+
+		for _, file := range files {
+			key, err := os.ReadFile(expandHome(file))
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			if err != nil {
+				return "", nil, fmt.Errorf("failed to read IdentityFile for %q: %w", alias, err)
+			}
+
+			s := string(key)
+			con.PrivateKey = &s
+			break
+		}
+	}
+
+	proxyJump, err = c.get(alias, "ProxyJump")
+	if err != nil {
+		return "", nil, err
+	}
+
+	if strings.EqualFold(proxyJump, "none") {
+		proxyJump = ""
+	}
+
+	files, err := c.get(alias, "UserKnownHostsFile")
+	if err != nil {
+		return "", nil, err
+	}
+
+	for _, file := range strings.Fields(files) {
+		if strings.EqualFold(file, "none") || file == os.DevNull {
+			continue
+		}
+
+		knownHosts = append(knownHosts, expandHome(file))
+	}
+
+	return proxyJump, knownHosts, nil
+}
+
+// proxyFromJump builds a proxy connection from a ProxyJump value of the
+// form [user@]host[:port], inheriting the dial settings of the target.
+func proxyFromJump(jump string, con *connectionBase) (*ProxyConnection, error) {
+	if strings.Contains(jump, ",") {
+		return nil, fmt.Errorf("ProxyJump %q: multiple jump hosts are not supported", jump)
+	}
+
+	jump = strings.TrimPrefix(jump, "ssh://")
+
+	user := defaultUser
+	port := float64(defaultPort)
+
+	proxy := &ProxyConnection{}
+	proxy.User = &user
+	proxy.Port = &port
+	proxy.AgentSocketPath = con.AgentSocketPath
+	proxy.DialErrorLimit = con.DialErrorLimit
+	proxy.PerDialTimeout = con.PerDialTimeout
+	proxy.DialBackoff = con.DialBackoff
+
+	if u, rest, ok := strings.Cut(jump, "@"); ok {
+		user = u
+		jump = rest
+	}
+
+	host := jump
+	if h, p, err := net.SplitHostPort(jump); err == nil {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, fmt.Errorf("ProxyJump %q: invalid port: %w", jump, err)
+		}
+
+		port = float64(n)
+		host = h
+	}
+
+	if host == "" {
+		return nil, fmt.Errorf("ProxyJump %q: missing host", jump)
+	}
+
+	proxy.Host = &host
+
+	return proxy, nil
+}
+
+// resolveSSHConfig returns a copy of the connection with the settings
+// from the OpenSSH client configuration applied, along with a host key
+// callback if the configuration names known hosts files.  If no
+// configuration is given, the connection is returned unchanged.  logf,
+// if not nil, is told of defaults the configuration replaces.
+func (con *Connection) resolveSSHConfig(logf func(format string, args ...any)) (*Connection, ssh.HostKeyCallback, error) {
+	if con.SSHConfig == nil {
+		return con, nil, nil
+	}
+
+	cfg, err := loadSSHConfig(*con.SSHConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resolved := *con
+
+	proxyJump, knownHosts, err := cfg.apply(&resolved.connectionBase, logf)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if resolved.Proxy != nil {
+		proxy := *resolved.Proxy
+		resolved.Proxy = &proxy
+	} else if proxyJump != "" {
+		resolved.Proxy, err = proxyFromJump(proxyJump, &resolved.connectionBase)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if resolved.Proxy != nil {
+		proxyJump, proxyKnownHosts, err := cfg.apply(&resolved.Proxy.connectionBase, logf)
+		if err != nil {
+			return nil, nil, fmt.Errorf("proxy: %w", err)
+		}
+
+		if proxyJump != "" && con.Proxy == nil {
+			return nil, nil, fmt.Errorf("proxy: nested ProxyJump %q is not supported", proxyJump)
+		}
+
+		for _, file := range proxyKnownHosts {
+			if !slices.Contains(knownHosts, file) {
+				knownHosts = append(knownHosts, file)
+			}
+		}
+	}
+
+	if len(knownHosts) == 0 {
+		return &resolved, nil, nil
+	}
+
+	callback, err := knownhosts.New(knownHosts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load known hosts: %w", err)
+	}
+
+	return &resolved, callback, nil
+}
+
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
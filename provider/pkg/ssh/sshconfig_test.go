@@ -0,0 +1,159 @@
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ptr[T any](in T) *T {
+	return &in
+}
+
+func newConnection(host string) *Connection {
+	con := &Connection{}
+	con.Host = ptr(host)
+	con.User = ptr(defaultUser)
+	con.Port = ptr(float64(defaultPort))
+	con.DialErrorLimit = ptr(dialErrorDefault)
+	con.PerDialTimeout = ptr(15)
+	return con
+}
+
+func TestResolveSSHConfigNone(t *testing.T) {
+	con := newConnection("example.com")
+
+	resolved, callback, err := con.resolveSSHConfig(nil)
+	require.NoError(t, err)
+
+	assert.Same(t, con, resolved)
+	assert.Nil(t, callback)
+}
+
+func TestResolveSSHConfigInline(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "id_test")
+	require.NoError(t, os.WriteFile(keyFile, []byte("not really a key"), 0600))
+
+	con := newConnection("validator")
+	con.SSHConfig = ptr(`
+Host validator
+    HostName 10.0.0.5
+    User sol
+    Port 2222
+    IdentityFile ` + filepath.Join(dir, "missing") + `
+    IdentityFile ` + keyFile + `
+    ProxyJump admin@bastion:2200
+
+Host bastion
+    HostName bastion.example.com
+`)
+
+	resolved, callback, err := con.resolveSSHConfig(nil)
+	require.NoError(t, err)
+	assert.Nil(t, callback)
+
+	assert.Equal(t, "10.0.0.5", *resolved.Host)
+	assert.Equal(t, "sol", *resolved.User)
+	assert.Equal(t, float64(2222), *resolved.Port)
+	assert.Equal(t, "not really a key", *resolved.PrivateKey)
+
+	if assert.NotNil(t, resolved.Proxy) {
+		assert.Equal(t, "bastion.example.com", *resolved.Proxy.Host)
+		assert.Equal(t, "admin", *resolved.Proxy.User)
+		assert.Equal(t, float64(2200), *resolved.Proxy.Port)
+		assert.Equal(t, 15, *resolved.Proxy.PerDialTimeout)
+	}
+
+	// The original connection is left untouched.
+	assert.Equal(t, "validator", *con.Host)
+	assert.Nil(t, con.Proxy)
+}
+
+func TestResolveSSHConfigExplicitInputs(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config")
+	require.NoError(t, os.WriteFile(configFile, []byte(`
+Host *
+    User sol
+    Port 2222
+    IdentityFile `+filepath.Join(dir, "id_test")+`
+    ProxyJump bastion
+`), 0600))
+
+	con := newConnection("example.com")
+	con.SSHConfig = ptr(configFile)
+	con.User = ptr("ubuntu")
+	con.Port = ptr(float64(2022))
+	con.PrivateKey = ptr("explicit key")
+	con.Proxy = &ProxyConnection{}
+	con.Proxy.Host = ptr("explicit-bastion")
+	con.Proxy.User = ptr(defaultUser)
+	con.Proxy.Port = ptr(float64(defaultPort))
+
+	var logged []string
+	resolved, _, err := con.resolveSSHConfig(func(format string, args ...any) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "example.com", *resolved.Host)
+	assert.Equal(t, "ubuntu", *resolved.User)
+	assert.Equal(t, float64(2022), *resolved.Port)
+	assert.Equal(t, "explicit key", *resolved.PrivateKey)
+	assert.Equal(t, "explicit-bastion", *resolved.Proxy.Host)
+
+	// The explicit proxy still picks up unset values from the config.
+	assert.Equal(t, "sol", *resolved.Proxy.User)
+	assert.Equal(t, defaultUser, *con.Proxy.User)
+
+	// The proxy's user and port can't be told from the defaults, so
+	// replacing them is logged.
+	assert.Equal(t, []string{
+		`ssh config sets User sol for "explicit-bastion", replacing the default root, which an explicit root can't be told from`,
+		`ssh config sets Port 2222 for "explicit-bastion", replacing the default 22, which an explicit 22 can't be told from`,
+	}, logged)
+}
+
+func TestResolveSSHConfigErrors(t *testing.T) {
+	{
+		con := newConnection("example.com")
+		con.SSHConfig = ptr(filepath.Join(t.TempDir(), "nonexistent"))
+
+		_, _, err := con.resolveSSHConfig(nil)
+		assert.ErrorContains(t, err, "failed to open ssh config")
+	}
+
+	{
+		con := newConnection("example.com")
+		con.SSHConfig = ptr("Host *\n    ProxyJump one,two\n")
+
+		_, _, err := con.resolveSSHConfig(nil)
+		assert.ErrorContains(t, err, "multiple jump hosts are not supported")
+	}
+
+	{
+		con := newConnection("example.com")
+		con.SSHConfig = ptr("Host *\n    Port twentytwo\n")
+
+		_, _, err := con.resolveSSHConfig(nil)
+		assert.ErrorContains(t, err, "invalid Port")
+	}
+}
+
+func TestResolveSSHConfigKnownHosts(t *testing.T) {
+	dir := t.TempDir()
+	knownHosts := filepath.Join(dir, "known_hosts")
+	require.NoError(t, os.WriteFile(knownHosts, nil, 0600))
+
+	con := newConnection("example.com")
+	con.SSHConfig = ptr("Host example.com\n    UserKnownHostsFile " + knownHosts + "\n")
+
+	_, callback, err := con.resolveSSHConfig(nil)
+	require.NoError(t, err)
+	assert.NotNil(t, callback)
+}
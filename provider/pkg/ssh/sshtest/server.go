@@ -0,0 +1,480 @@
+// Package sshtest runs an SSH server in the test process, so code that
+// works over an *ssh.Client can be tested without a remote host.
+// Commands are run with the local bash, SFTP is served from the local
+// filesystem, and TCP forwards in both directions are supported.
+package sshtest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Server is an SSH server listening on a local port.
+type Server struct {
+	listener net.Listener
+	config   *ssh.ServerConfig
+
+	mu sync.Mutex
+
+	// agentKeys has, for each session that requested agent
+	// forwarding, how many keys it could list through the forwarded
+	// agent, or -1 if it couldn't.
+	agentKeys []int
+
+	// rejected are the session request types to refuse.
+	rejected map[string]bool
+
+	closers []io.Closer
+	wg      sync.WaitGroup
+}
+
+// NewServer starts a server, which is stopped when the test finishes.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{listener: listener, config: config}
+
+	s.wg.Add(1)
+	go s.serve()
+
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// Addr is the "host:port" the server listens on.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// HostPort returns the host and port the server listens on.
+func (s *Server) HostPort() (string, int) {
+	host, port, _ := net.SplitHostPort(s.Addr())
+	n, _ := strconv.Atoi(port)
+	return host, n
+}
+
+// Dial connects a client to the server, which is closed when the test
+// finishes.
+func (s *Server) Dial(t testing.TB) *ssh.Client {
+	t.Helper()
+
+	client, err := ssh.Dial("tcp", s.Addr(), &ssh.ClientConfig{
+		User:            "test",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = client.Close() })
+
+	return client
+}
+
+// AgentKeys returns, for each session that requested agent forwarding,
+// how many keys it listed through the forwarded agent, or -1 if it
+// couldn't reach it.
+func (s *Server) AgentKeys() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]int{}, s.agentKeys...)
+}
+
+// Reject has the server refuse session requests of the given type, such
+// as "exec", from now on.
+func (s *Server) Reject(reqType string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rejected == nil {
+		s.rejected = map[string]bool{}
+	}
+	s.rejected[reqType] = true
+}
+
+func (s *Server) isRejected(reqType string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.rejected[reqType]
+}
+
+// Close stops the server and closes its connections.
+func (s *Server) Close() {
+	_ = s.listener.Close()
+
+	s.mu.Lock()
+	for _, c := range s.closers {
+		_ = c.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// track closes c when the server is closed.
+func (s *Server) track(c io.Closer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closers = append(s.closers, c)
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.track(conn)
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handleConn(conn)
+		}()
+	}
+}
+
+func (s *Server) handleConn(nc net.Conn) {
+	conn, chans, reqs, err := ssh.NewServerConn(nc, s.config)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	fwds := &remoteForwards{conn: conn, listeners: map[string]net.Listener{}}
+	defer fwds.close()
+
+	go func() {
+		for req := range reqs {
+			fwds.handle(req)
+		}
+	}()
+
+	for newCh := range chans {
+		switch newCh.ChannelType() {
+		case "session":
+			go s.handleSession(conn, newCh)
+		case "direct-tcpip":
+			go handleDirect(newCh)
+		default:
+			_ = newCh.Reject(ssh.UnknownChannelType, newCh.ChannelType())
+		}
+	}
+}
+
+func (s *Server) handleSession(conn *ssh.ServerConn, newCh ssh.NewChannel) {
+	ch, reqs, err := newCh.Accept()
+	if err != nil {
+		return
+	}
+	defer ch.Close()
+
+	var (
+		env          []string
+		agentRequest bool
+	)
+
+	for req := range reqs {
+		if s.isRejected(req.Type) {
+			_ = req.Reply(false, nil)
+			continue
+		}
+
+		switch req.Type {
+		case "env":
+			var kv struct{ Name, Value string }
+			if err := ssh.Unmarshal(req.Payload, &kv); err != nil {
+				_ = req.Reply(false, nil)
+				continue
+			}
+			env = append(env, kv.Name+"="+kv.Value)
+			_ = req.Reply(true, nil)
+
+		case "auth-agent-req@openssh.com":
+			agentRequest = true
+			_ = req.Reply(true, nil)
+
+		case "exec":
+			var payload struct{ Command string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+				_ = req.Reply(false, nil)
+				continue
+			}
+			_ = req.Reply(true, nil)
+
+			if agentRequest {
+				s.checkAgent(conn)
+			}
+
+			status := run(ch, payload.Command, env)
+			_, _ = ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+			return
+
+		case "subsystem":
+			var payload struct{ Name string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil || payload.Name != "sftp" {
+				_ = req.Reply(false, nil)
+				continue
+			}
+			_ = req.Reply(true, nil)
+
+			server, err := sftp.NewServer(ch)
+			if err != nil {
+				return
+			}
+			_ = server.Serve()
+			return
+
+		default:
+			_ = req.Reply(false, nil)
+		}
+	}
+}
+
+// checkAgent lists the keys of the agent forwarded over conn.
+func (s *Server) checkAgent(conn *ssh.ServerConn) {
+	n := -1
+
+	ch, reqs, err := conn.OpenChannel("auth-agent@openssh.com", nil)
+	if err == nil {
+		go ssh.DiscardRequests(reqs)
+
+		if keys, err := agent.NewClient(ch).List(); err == nil {
+			n = len(keys)
+		}
+		_ = ch.Close()
+	}
+
+	s.mu.Lock()
+	s.agentKeys = append(s.agentKeys, n)
+	s.mu.Unlock()
+}
+
+// run runs command with bash, returning its exit status.
+func run(ch ssh.Channel, command string, env []string) uint32 {
+	cmd := exec.Command("bash", "-c", command)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = ch
+	cmd.Stdout = ch
+	cmd.Stderr = ch.Stderr()
+
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exitErr) && exitErr.ExitCode() >= 0:
+		return uint32(exitErr.ExitCode())
+	}
+
+	return 255
+}
+
+// forwardPayload is the payload of direct-tcpip and forwarded-tcpip
+// channels.
+type forwardPayload struct {
+	Addr       string
+	Port       uint32
+	OriginAddr string
+	OriginPort uint32
+}
+
+func handleDirect(newCh ssh.NewChannel) {
+	var payload forwardPayload
+	if err := ssh.Unmarshal(newCh.ExtraData(), &payload); err != nil {
+		_ = newCh.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+
+	out, err := net.Dial("tcp", net.JoinHostPort(payload.Addr, strconv.Itoa(int(payload.Port))))
+	if err != nil {
+		_ = newCh.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+
+	ch, reqs, err := newCh.Accept()
+	if err != nil {
+		_ = out.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	pipe(ch, out)
+}
+
+// pipe copies between a and b until both directions are done.
+func pipe(a io.ReadWriteCloser, b net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(a, b)
+		_ = a.Close()
+	}()
+
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(b, a)
+		_ = b.Close()
+	}()
+
+	wg.Wait()
+}
+
+// remoteForwards serves the tcpip-forward requests of a connection.
+type remoteForwards struct {
+	conn *ssh.ServerConn
+
+	mu        sync.Mutex
+	listeners map[string]net.Listener
+}
+
+func (f *remoteForwards) handle(req *ssh.Request) {
+	var payload struct {
+		Addr string
+		Port uint32
+	}
+
+	switch req.Type {
+	case "tcpip-forward":
+		if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+			_ = req.Reply(false, nil)
+			return
+		}
+
+		listener, err := net.Listen("tcp", net.JoinHostPort(payload.Addr, strconv.Itoa(int(payload.Port))))
+		if err != nil {
+			_ = req.Reply(false, nil)
+			return
+		}
+
+		port := uint32(listener.Addr().(*net.TCPAddr).Port)
+
+		f.mu.Lock()
+		f.listeners[fmt.Sprintf("%s:%d", payload.Addr, port)] = listener
+		f.mu.Unlock()
+
+		go f.accept(listener, payload.Addr, port)
+
+		_ = req.Reply(true, ssh.Marshal(struct{ Port uint32 }{port}))
+
+	case "cancel-tcpip-forward":
+		if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+			_ = req.Reply(false, nil)
+			return
+		}
+
+		key := fmt.Sprintf("%s:%d", payload.Addr, payload.Port)
+
+		f.mu.Lock()
+		listener, ok := f.listeners[key]
+		delete(f.listeners, key)
+		f.mu.Unlock()
+
+		if ok {
+			_ = listener.Close()
+		}
+		_ = req.Reply(ok, nil)
+
+	default:
+		if req.WantReply {
+			_ = req.Reply(false, nil)
+		}
+	}
+}
+
+func (f *remoteForwards) accept(listener net.Listener, addr string, port uint32) {
+	for {
+		in, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			origin := in.RemoteAddr().(*net.TCPAddr)
+
+			ch, reqs, err := f.conn.OpenChannel("forwarded-tcpip", ssh.Marshal(forwardPayload{
+				Addr:       addr,
+				Port:       port,
+				OriginAddr: origin.IP.String(),
+				OriginPort: uint32(origin.Port),
+			}))
+			if err != nil {
+				_ = in.Close()
+				return
+			}
+			go ssh.DiscardRequests(reqs)
+
+			pipe(ch, in)
+		}()
+	}
+}
+
+func (f *remoteForwards) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, l := range f.listeners {
+		_ = l.Close()
+	}
+}
+
+// StubSudo puts a sudo on the PATH of the commands the server runs that
+// runs its arguments as they are, after any -E, so lib.bash can be used
+// where there's no sudo.  The test is skipped unless it's running as root, since
+// lib.bash needs root to take the package manager lock.
+func StubSudo(t *testing.T) {
+	t.Helper()
+
+	if os.Geteuid() != 0 {
+		t.Skip("running lib.bash needs root")
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "sudo"), []byte("#!/bin/sh\n[ \"$1\" = -E ] && shift\nexec \"$@\"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
@@ -0,0 +1,275 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	runner "github.com/abklabs/pulumi-runner/pkg/runner/core"
+	p "github.com/pulumi/pulumi-go-provider"
+)
+
+// EventSchemaVersion is the version of the events' schema.  Fields may
+// be added without changing it; it changes if any are removed or
+// change meaning.
+const EventSchemaVersion = 1
+
+// The types of event.
+const (
+	EventRunStart   = "run.start"
+	EventDialStart  = "dial.start"
+	EventDialFinish = "dial.finish"
+	EventUpload     = "upload"
+	EventStepStart  = "step.start"
+	EventStepEnd    = "step.end"
+	EventOutput     = "output"
+	EventRunFinish  = "run.finish"
+)
+
+// Event is a line of the JSON event stream.  Which fields are set
+// depends on its Type.
+type Event struct {
+	Version   int       `json:"version"`
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	URN       string    `json:"urn,omitempty"`
+	Host      string    `json:"host,omitempty"`
+	Operation string    `json:"operation,omitempty"`
+
+	// upload: the file, bytes copied so far and its full size.
+	File  string `json:"file,omitempty"`
+	Bytes *int   `json:"bytes,omitempty"`
+	Size  *int   `json:"size,omitempty"`
+
+	// step.start, step.end
+	Step string `json:"step,omitempty"`
+
+	// output: the stream, opsh level if any, and the line.
+	Stream string  `json:"stream,omitempty"`
+	Level  string  `json:"level,omitempty"`
+	Text   *string `json:"text,omitempty"`
+
+	// dial.finish, run.finish: "succeeded" or "failed".
+	Status string `json:"status,omitempty"`
+
+	// step.end, run.finish; -1 if the command didn't exit.
+	ExitCode *int `json:"exitCode,omitempty"`
+
+	// dial.finish, step.end, run.finish
+	DurationMs *int64 `json:"durationMs,omitempty"`
+
+	// dial.finish, run.finish, if they failed
+	Error string `json:"error,omitempty"`
+}
+
+// EventSink writes events as JSON lines to a file or Unix socket.  Its
+// methods do nothing on a nil sink, so callers needn't check.
+//
+// Events are queued and written by a goroutine of the sink's own, so a
+// slow reader never holds up the command's output.  Events that don't
+// fit in the queue are dropped.
+type EventSink struct {
+	mu      sync.Mutex
+	w       io.WriteCloser
+	info    RunLogInfo
+	queue   chan []byte
+	closed  bool
+	dropped int
+
+	// done is closed once the writer has stopped; err is then the
+	// first error writing.
+	done chan struct{}
+	err  error
+}
+
+// eventQueueSize is how many events may wait to be written.
+const eventQueueSize = 1024
+
+// eventFlushTimeout is how long Close waits for a socket's reader to
+// take the queued events.
+var eventFlushTimeout = 5 * time.Second
+
+// OpenEventSink opens target, which is "unix:/path" for a Unix socket
+// or otherwise a file to append to.
+func OpenEventSink(target string, info RunLogInfo) (*EventSink, error) {
+	var (
+		w   io.WriteCloser
+		err error
+	)
+
+	if path, ok := strings.CutPrefix(target, "unix:"); ok {
+		w, err = net.Dial("unix", path)
+	} else {
+		w, err = os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event sink: %w", err)
+	}
+
+	s := &EventSink{
+		w:     w,
+		info:  info,
+		queue: make(chan []byte, eventQueueSize),
+		done:  make(chan struct{}),
+	}
+
+	go s.write()
+
+	return s, nil
+}
+
+// write writes the queued events until the queue is closed.  After a
+// write fails, the rest are discarded.
+func (s *EventSink) write() {
+	defer close(s.done)
+
+	for line := range s.queue {
+		if s.err == nil {
+			_, s.err = s.w.Write(line)
+		}
+	}
+}
+
+// Emit queues an event, filling in its version, time and which run it's
+// for.  It never waits for the event to be written.
+func (s *EventSink) Emit(e Event) {
+	if s == nil {
+		return
+	}
+
+	e.Version = EventSchemaVersion
+	e.Time = time.Now().UTC()
+	e.URN = s.info.URN
+	e.Host = s.info.Host
+	e.Operation = s.info.Operation
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	select {
+	case s.queue <- line:
+	default:
+		s.dropped++
+	}
+}
+
+// Finish emits the result of something that started at start and
+// ended with err.
+func (s *EventSink) Finish(typ string, start time.Time, err error) {
+	if s == nil {
+		return
+	}
+
+	e := Event{Type: typ, Status: "succeeded", DurationMs: durationMs(time.Since(start))}
+
+	if err != nil {
+		e.Status = "failed"
+		e.Error = err.Error()
+	}
+
+	if typ == EventRunFinish {
+		code := exitCode(err)
+		e.ExitCode = &code
+	}
+
+	s.Emit(e)
+}
+
+// Close writes the queued events and closes the sink, returning the
+// first error writing to it and how many events were dropped.  A socket
+// is given eventFlushTimeout to take the events still queued.
+func (s *EventSink) Close() error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	s.closed = true
+	close(s.queue)
+	dropped := s.dropped
+	s.mu.Unlock()
+
+	if conn, ok := s.w.(net.Conn); ok {
+		_ = conn.SetWriteDeadline(time.Now().Add(eventFlushTimeout))
+	}
+
+	<-s.done
+
+	var errs []error
+
+	if dropped != 0 {
+		errs = append(errs, fmt.Errorf("dropped %d events the sink couldn't keep up with", dropped))
+	}
+
+	return errors.Join(append(errs, s.err, s.w.Close())...)
+}
+
+func durationMs(d time.Duration) *int64 {
+	ms := d.Milliseconds()
+	return &ms
+}
+
+func outputEvent(line LogLine) Event {
+	e := Event{Type: EventOutput, Stream: line.Stream.String(), Text: &line.Raw}
+
+	if line.Level != LevelNone {
+		e.Level = line.Level.String()
+	}
+
+	return e
+}
+
+func stepEvent(ev runner.StepEvent, d time.Duration) Event {
+	if ev.Start {
+		return Event{Type: EventStepStart, Step: ev.Name}
+	}
+
+	code := ev.ExitCode
+	return Event{Type: EventStepEnd, Step: ev.Name, ExitCode: &code, DurationMs: durationMs(d)}
+}
+
+func uploadEvent(filename string, copied int, size int) Event {
+	return Event{Type: EventUpload, File: filename, Bytes: &copied, Size: &size}
+}
+
+// openEventSink opens the event sink config names, if any.  Failing to
+// is only worth a warning.
+func openEventSink(ctx context.Context, runnerArgs RunnerArgs, config *runner.Config) *EventSink {
+	if config == nil || config.EventSink == nil {
+		return nil
+	}
+
+	s, err := OpenEventSink(*config.EventSink, runInfo(ctx, runnerArgs))
+	if err != nil {
+		p.GetLogger(ctx).Warningf("not sending events: %s", err)
+		return nil
+	}
+
+	return s
+}
+
+// closeEventSink closes s, warning if any events were lost.
+func closeEventSink(ctx context.Context, s *EventSink) {
+	if err := s.Close(); err != nil {
+		p.GetLogger(ctx).Warningf("failed to send events: %s", err)
+	}
+}
@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readEvents(t *testing.T, data string) []map[string]any {
+	t.Helper()
+
+	var events []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(data), "\n") {
+		var e map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &e), line)
+		events = append(events, e)
+	}
+
+	return events
+}
+
+func TestEventSinkFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	info := RunLogInfo{URN: "urn:pulumi:dev::p::runner:index:SSHDeployer::node", Host: "10.0.0.1", Operation: "update"}
+
+	s, err := OpenEventSink(path, info)
+	require.NoError(t, err)
+
+	h := MakePulumiLogger(context.Background(), nil)
+	h.events = s
+
+	start := time.Now()
+	s.Emit(Event{Type: EventRunStart})
+	s.Emit(uploadEvent("run.sh", 512, 1024))
+
+	stderr := strings.NewReader("::svmkit-step:: start 10-build\nWARN:\tslow\n::svmkit-step:: end 10-build 0\n")
+
+	done := make(chan struct{})
+	require.NoError(t, h.IngestReaders(done, strings.NewReader("\n"), stderr))
+	<-done
+
+	s.Finish(EventRunFinish, start, errors.New("exit status 3"))
+	require.NoError(t, s.Close())
+	require.NoError(t, h.Close(false))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	events := readEvents(t, string(data))
+
+	types := map[string]map[string]any{}
+	for _, e := range events {
+		assert.EqualValues(t, EventSchemaVersion, e["version"])
+		assert.Equal(t, info.URN, e["urn"])
+		assert.Equal(t, "10.0.0.1", e["host"])
+		assert.Equal(t, "update", e["operation"])
+		assert.NotEmpty(t, e["time"])
+
+		if e["type"] == EventOutput && e["stream"] == "stdout" {
+			// An empty line still has its text.
+			assert.Equal(t, "", e["text"])
+			continue
+		}
+		types[e["type"].(string)] = e
+	}
+
+	assert.Equal(t, EventRunStart, events[0]["type"])
+	assert.Equal(t, EventRunFinish, events[len(events)-1]["type"])
+
+	assert.Equal(t, "run.sh", types[EventUpload]["file"])
+	assert.EqualValues(t, 512, types[EventUpload]["bytes"])
+	assert.EqualValues(t, 1024, types[EventUpload]["size"])
+
+	assert.Equal(t, "10-build", types[EventStepStart]["step"])
+	assert.Equal(t, "10-build", types[EventStepEnd]["step"])
+	assert.EqualValues(t, 0, types[EventStepEnd]["exitCode"])
+	assert.Contains(t, types[EventStepEnd], "durationMs")
+
+	assert.Equal(t, "stderr", types[EventOutput]["stream"])
+	assert.Equal(t, "warn", types[EventOutput]["level"])
+	assert.Equal(t, "WARN:\tslow", types[EventOutput]["text"])
+
+	finish := types[EventRunFinish]
+	assert.Equal(t, "failed", finish["status"])
+	assert.Equal(t, "exit status 3", finish["error"])
+	assert.EqualValues(t, -1, finish["exitCode"])
+}
+
+func TestEventSinkSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "events")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "sock")
+	l, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	defer l.Close()
+
+	received := make(chan string)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			close(received)
+			return
+		}
+		defer conn.Close()
+
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		received <- line
+	}()
+
+	s, err := OpenEventSink("unix:"+path, RunLogInfo{})
+	require.NoError(t, err)
+
+	s.Emit(Event{Type: EventDialStart})
+
+	events := readEvents(t, <-received)
+	assert.Equal(t, EventDialStart, events[0]["type"])
+	assert.NotContains(t, events[0], "urn")
+
+	require.NoError(t, s.Close())
+
+	var nilSink *EventSink
+	nilSink.Emit(Event{Type: EventRunStart})
+	assert.NoError(t, nilSink.Close())
+
+	_, err = OpenEventSink("unix:"+filepath.Join(dir, "missing"), RunLogInfo{})
+	assert.ErrorContains(t, err, "failed to open event sink")
+}
+
+func TestEventSinkSlowSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "events")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "sock")
+	l, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	defer l.Close()
+
+	// The reader accepts the connection, but never reads from it.
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+
+	s, err := OpenEventSink("unix:"+path, RunLogInfo{})
+	require.NoError(t, err)
+
+	conn := <-accepted
+	defer conn.Close()
+
+	defer func(timeout time.Duration) { eventFlushTimeout = timeout }(eventFlushTimeout)
+	eventFlushTimeout = 100 * time.Millisecond
+
+	text := strings.Repeat("x", 4096)
+
+	emitted := make(chan struct{})
+	go func() {
+		for range 4 * eventQueueSize {
+			s.Emit(Event{Type: EventOutput, Text: &text})
+		}
+		close(emitted)
+	}()
+
+	select {
+	case <-emitted:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Emit blocked on the socket")
+	}
+
+	err = s.Close()
+	assert.ErrorContains(t, err, "events the sink couldn't keep up with")
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+}
@@ -1,13 +1,15 @@
 package utils
 
 import (
-	"bufio"
 	"context"
 	"fmt"
 	"io"
 	"strings"
 	"sync"
+	"time"
 
+	runner "github.com/abklabs/pulumi-runner/pkg/runner/core"
+	"github.com/abklabs/pulumi-runner/pkg/runner/core/deployer"
 	p "github.com/pulumi/pulumi-go-provider"
 )
 
@@ -15,33 +17,63 @@ func cleanupLine(s string) string {
 	return strings.ReplaceAll(strings.TrimSpace(s), "\t", " ")
 }
 
+// StepResult is how a step of a command went.
+type StepResult struct {
+	Name     string
+	Duration time.Duration
+
+	// ExitCode is -1 if the step never finished.
+	ExitCode int
+}
+
 type PulumiLoggerHandler struct {
-	ctx   context.Context
-	lines []string
+	ctx context.Context
+
+	// output is both streams, as they were read, spooled to a file so
+	// all of it is available if the command fails.
+	output *deployer.OutputBuffer
+	stdout *deployer.OutputBuffer
+	stderr *deployer.OutputBuffer
+
+	// tail is how many of the last lines of output are shown if the
+	// command fails.
+	tail int
+
+	steps   []StepResult
+	started map[string]time.Time
+
+	// runLog, if set, gets everything the command does.
+	runLog *RunLog
+
+	events *EventSink
+
+	// redactor removes the resource's secrets from every line before
+	// it goes anywhere.
+	redactor *Redactor
 }
 
 func (h *PulumiLoggerHandler) IngestReaders(done chan<- struct{}, stdout io.Reader, stderr io.Reader) error {
-	logger := p.GetLogger(h.ctx)
+	if err := h.output.Spool(""); err != nil {
+		p.GetLogger(h.ctx).Warningf("not keeping the full output: %s", err)
+	}
 
 	var wg sync.WaitGroup
 	wg.Add(2)
 
-	ingest := make(chan string)
-
-	engine := func(r io.Reader) {
-		s := bufio.NewScanner(r)
-
-		for s.Scan() {
-			txt := s.Text()
-			logger.InfoStatus(cleanupLine(txt))
-			ingest <- txt
+	ingest := make(chan LogLine)
 
+	engine := func(stream Stream, r io.Reader) {
+		err := deployer.ReadLines(r, deployer.MaxLineLength, func(line string) {
+			ingest <- ParseLogLine(stream, h.redactor.RedactLine(line))
+		})
+		if err != nil {
+			p.GetLogger(h.ctx).Warningf("failed to read the command's %s: %s", stream, err)
 		}
 		wg.Done()
 	}
 
-	go engine(stdout)
-	go engine(stderr)
+	go engine(Stdout, stdout)
+	go engine(Stderr, stderr)
 
 	go func() {
 		wg.Wait()
@@ -50,7 +82,12 @@ func (h *PulumiLoggerHandler) IngestReaders(done chan<- struct{}, stdout io.Read
 
 	go func() {
 		for line := range ingest {
-			h.lines = append(h.lines, line)
+			if ev, ok := runner.ParseStepMarker(line.Raw); ok {
+				h.observeStep(ev)
+				continue
+			}
+
+			h.observeLine(line)
 		}
 		close(done)
 	}()
@@ -58,10 +95,163 @@ func (h *PulumiLoggerHandler) IngestReaders(done chan<- struct{}, stdout io.Read
 	return nil
 }
 
+// observeLine reports a line of output, as a diagnostic that stays in
+// the output for opsh warnings and errors, and as status otherwise.
+func (h *PulumiLoggerHandler) observeLine(line LogLine) {
+	logger := p.GetLogger(h.ctx)
+
+	switch line.Level {
+	case LevelWarn:
+		logger.Warning(cleanupLine(line.Text))
+	case LevelError, LevelFatal:
+		logger.Error(cleanupLine(line.Text))
+	default:
+		logger.InfoStatus(cleanupLine(line.Raw))
+	}
+
+	h.output.Add(line.Raw)
+
+	if h.runLog != nil {
+		h.runLog.Line(line)
+	}
+
+	h.events.Emit(outputEvent(line))
+
+	if line.Stream == Stderr {
+		h.stderr.Add(line.Raw)
+	} else {
+		h.stdout.Add(line.Raw)
+	}
+}
+
+// Stdout returns the first and last lines the command wrote to stdout.
+func (h *PulumiLoggerHandler) Stdout() []string {
+	return h.stdout.Lines()
+}
+
+// Stderr returns the first and last lines the command wrote to stderr,
+// other than step markers.
+func (h *PulumiLoggerHandler) Stderr() []string {
+	return h.stderr.Lines()
+}
+
+// observeStep reports a step starting or ending.
+func (h *PulumiLoggerHandler) observeStep(ev runner.StepEvent) {
+	logger := p.GetLogger(h.ctx)
+
+	if h.runLog != nil {
+		h.runLog.Step(ev)
+	}
+
+	if ev.Start {
+		h.started[ev.Name] = time.Now()
+		h.events.Emit(stepEvent(ev, 0))
+		logger.InfoStatusf("step %s: running", ev.Name)
+		return
+	}
+
+	res := StepResult{Name: ev.Name, ExitCode: ev.ExitCode}
+
+	if start, ok := h.started[ev.Name]; ok {
+		res.Duration = time.Since(start).Round(time.Millisecond)
+		delete(h.started, ev.Name)
+	}
+
+	h.steps = append(h.steps, res)
+	h.events.Emit(stepEvent(ev, res.Duration))
+
+	if res.ExitCode == 0 {
+		logger.Infof("step %s: succeeded in %s", res.Name, res.Duration)
+	} else {
+		logger.Errorf("step %s: failed with exit code %d after %s", res.Name, res.ExitCode, res.Duration)
+	}
+}
+
+// Steps returns how each step that ran went, in the order they ran.  A
+// step that started but never finished is included with an exit code
+// of -1.
+func (h *PulumiLoggerHandler) Steps() []StepResult {
+	steps := append([]StepResult{}, h.steps...)
+
+	for name, start := range h.started {
+		steps = append(steps, StepResult{Name: name, Duration: time.Since(start).Round(time.Millisecond), ExitCode: -1})
+	}
+
+	return steps
+}
+
+// FailedStep returns the step the command failed in, if it was running
+// steps.
+func (h *PulumiLoggerHandler) FailedStep() (StepResult, bool) {
+	steps := h.Steps()
+
+	for i := len(steps) - 1; i >= 0; i-- {
+		if steps[i].ExitCode != 0 {
+			return steps[i], true
+		}
+	}
+
+	return StepResult{}, false
+}
+
 func (h *PulumiLoggerHandler) AugmentError(err error) error {
-	return fmt.Errorf("\n%s\n%w", strings.Join(h.lines, "\n"), err)
+	if step, ok := h.FailedStep(); ok {
+		err = fmt.Errorf("step %s failed: %w", step.Name, err)
+	}
+
+	return fmt.Errorf("\n%s%s%w", h.stderrSummary(), h.output.Summary(), err)
 }
 
-func MakePulumiLogger(ctx context.Context) *PulumiLoggerHandler {
-	return &PulumiLoggerHandler{ctx: ctx}
+// stderrSummary is the last lines of stderr, where opsh reports errors,
+// that output after them pushed out of the output summary.
+func (h *PulumiLoggerHandler) stderrSummary() string {
+	shown := h.output.Tail(h.tail)
+	lines := h.stderr.Tail(h.tail)
+
+	// Match the stderr lines to the ones shown from the end, to find
+	// those that came before them.
+	i, j := len(lines), len(shown)
+	for i > 0 && j > 0 {
+		if lines[i-1] == shown[j-1] {
+			i--
+		}
+		j--
+	}
+
+	if i == 0 {
+		return ""
+	}
+
+	var s strings.Builder
+
+	s.WriteString("... earlier lines of stderr ...\n")
+	for _, line := range lines[:i] {
+		s.WriteString(line)
+		s.WriteString("\n")
+	}
+
+	return s.String()
+}
+
+// Close finishes with the output, keeping the full copy of it if
+// keepLog is set.
+func (h *PulumiLoggerHandler) Close(keepLog bool) error {
+	return h.output.Close(keepLog)
+}
+
+// MakePulumiLogger returns a handler keeping as much output as config
+// says, which may be nil for the defaults.
+func MakePulumiLogger(ctx context.Context, config *runner.Config) *PulumiLoggerHandler {
+	head, tail := config.OutputLimits()
+
+	return &PulumiLoggerHandler{
+		ctx:     ctx,
+		output:  deployer.NewOutputBuffer(head, tail),
+		stdout:  deployer.NewOutputBuffer(head, tail),
+		stderr:  deployer.NewOutputBuffer(head, tail),
+		tail:    tail,
+		started: map[string]time.Time{},
+
+		redactor: RedactorFrom(ctx),
+	}
 }
@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	runner "github.com/abklabs/pulumi-runner/pkg/runner/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPulumiLoggerHandlerStreams(t *testing.T) {
+	h := MakePulumiLogger(context.Background(), nil)
+
+	stdout := strings.NewReader("built\ninstalled\n")
+	stderr := strings.NewReader("WARN:\tslow mirror\n::svmkit-step:: start 10-build\n::svmkit-step:: end 10-build 0\nERROR:\tno space left\n")
+
+	done := make(chan struct{})
+	require.NoError(t, h.IngestReaders(done, stdout, stderr))
+	<-done
+
+	assert.Equal(t, []string{"built", "installed"}, h.Stdout())
+	assert.Equal(t, []string{"WARN:\tslow mirror", "ERROR:\tno space left"}, h.Stderr())
+	assert.Equal(t, 4, h.output.Len())
+
+	steps := h.Steps()
+	require.Len(t, steps, 1)
+	assert.Equal(t, "10-build", steps[0].Name)
+
+	require.NoError(t, h.Close(false))
+}
+
+func TestPulumiLoggerHandlerAugmentError(t *testing.T) {
+	head, tail := 1, 2
+	h := MakePulumiLogger(context.Background(), &runner.Config{OutputHeadLines: &head, OutputTailLines: &tail})
+
+	stderr := strings.NewReader("::svmkit-step:: start 10-build\none\ntwo\nthree\nfour\n::svmkit-step:: end 10-build 2\n")
+
+	done := make(chan struct{})
+	require.NoError(t, h.IngestReaders(done, strings.NewReader(""), stderr))
+	<-done
+
+	path := h.output.Path()
+	require.NotEmpty(t, path)
+
+	err := h.AugmentError(errors.New("exit status 2"))
+	assert.EqualError(t, err, "\n... last 2 of 4 lines ...\nthree\nfour\nfull output: "+path+"\nstep 10-build failed: exit status 2")
+	assert.Equal(t, []string{"one", "... 1 lines omitted ...", "three", "four"}, h.Stderr())
+
+	require.NoError(t, h.Close(true))
+	data, rerr := os.ReadFile(path)
+	require.NoError(t, rerr)
+	assert.Equal(t, "one\ntwo\nthree\nfour\n", string(data))
+	require.NoError(t, os.Remove(path))
+}
+
+func TestPulumiLoggerHandlerAugmentErrorStderr(t *testing.T) {
+	tail := 2
+	h := MakePulumiLogger(context.Background(), &runner.Config{OutputTailLines: &tail})
+
+	// The error is on stderr, before output on stdout that pushes it
+	// out of the last lines.
+	h.observeLine(ParseLogLine(Stderr, "ERROR:\tno space left"))
+	for _, line := range []string{"cleaning", "up", "done"} {
+		h.observeLine(ParseLogLine(Stdout, line))
+	}
+
+	err := h.AugmentError(errors.New("exit status 1"))
+	assert.EqualError(t, err, "\n... earlier lines of stderr ...\nERROR:\tno space left\n... last 2 of 4 lines ...\nup\ndone\nexit status 1")
+
+	// Nothing is repeated when the stderr lines are already shown.
+	h.observeLine(ParseLogLine(Stderr, "ERROR:\tstill no space"))
+
+	err = h.AugmentError(errors.New("exit status 1"))
+	assert.EqualError(t, err, "\n... earlier lines of stderr ...\nERROR:\tno space left\n... last 2 of 5 lines ...\ndone\nERROR:\tstill no space\nexit status 1")
+
+	h = MakePulumiLogger(context.Background(), &runner.Config{OutputTailLines: &tail})
+	h.observeLine(ParseLogLine(Stdout, "built"))
+	h.observeLine(ParseLogLine(Stderr, "ERROR:\tfailed"))
+
+	err = h.AugmentError(errors.New("exit status 1"))
+	assert.EqualError(t, err, "\nbuilt\nERROR:\tfailed\nexit status 1")
+}
+
+func TestPulumiLoggerHandlerLongLines(t *testing.T) {
+	h := MakePulumiLogger(context.Background(), nil)
+
+	stdoutR, stdoutW := io.Pipe()
+	stderrR, stderrW := io.Pipe()
+
+	done := make(chan struct{})
+	require.NoError(t, h.IngestReaders(done, stdoutR, stderrR))
+
+	// Writes to a pipe block until they're read, so these only finish
+	// if both streams keep being drained.
+	go func() {
+		_, _ = stdoutW.Write([]byte(strings.Repeat("a", 1<<20) + "\nend\n"))
+		_ = stdoutW.Close()
+	}()
+	go func() {
+		_, _ = stderrW.Write([]byte(strings.Repeat("\x00\xff", 1<<18) + "\n"))
+		_ = stderrW.Close()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("output wasn't drained")
+	}
+
+	stdout := h.Stdout()
+	assert.Equal(t, "end", stdout[len(stdout)-1])
+
+	require.NoError(t, h.Close(false))
+}
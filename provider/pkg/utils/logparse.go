@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Stream is which of a command's outputs a line was read from.
+type Stream int
+
+const (
+	Stdout Stream = iota
+	Stderr
+)
+
+func (s Stream) String() string {
+	if s == Stderr {
+		return "stderr"
+	}
+	return "stdout"
+}
+
+// Level is the opsh log level of a line, from its log::output prefix.
+type Level int
+
+const (
+	// LevelNone is a line that isn't from opsh's logging.
+	LevelNone Level = iota
+	LevelDebug
+	LevelInfo
+	LevelWarn
+	LevelError
+	LevelFatal
+)
+
+var levelNames = map[string]Level{
+	"debug": LevelDebug,
+	"info":  LevelInfo,
+	"warn":  LevelWarn,
+	"error": LevelError,
+	"fatal": LevelFatal,
+}
+
+func (l Level) String() string {
+	for name, v := range levelNames {
+		if v == l {
+			return name
+		}
+	}
+	return "none"
+}
+
+// opshLevelRegexp matches log::output's "LEVEL:\tmessage", where the
+// level is colored if stdout was a terminal.
+var opshLevelRegexp = regexp.MustCompile(`^(?:\x1b\[[0-9;]*m)*([A-Za-z]+)(?:\x1b\[[0-9;]*m)*:\t(.*)$`)
+
+// LogLine is a line of a command's output.
+type LogLine struct {
+	Stream Stream
+	Level  Level
+
+	// Text is the line, less any level prefix.
+	Text string
+
+	// Raw is the line as read.
+	Raw string
+}
+
+// ParseLogLine classifies a line read from stream.  Only stderr is
+// given a level, as that's where opsh logs to; stdout is the command's
+// own output, whatever it looks like.
+func ParseLogLine(stream Stream, raw string) LogLine {
+	line := LogLine{Stream: stream, Text: raw, Raw: raw}
+
+	if stream != Stderr {
+		return line
+	}
+
+	m := opshLevelRegexp.FindStringSubmatch(raw)
+	if m == nil {
+		return line
+	}
+
+	level, ok := levelNames[strings.ToLower(m[1])]
+	if !ok {
+		return line
+	}
+
+	line.Level = level
+	line.Text = m[2]
+
+	return line
+}
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLogLine(t *testing.T) {
+	tests := []struct {
+		stream Stream
+		raw    string
+		level  Level
+		text   string
+	}{
+		{Stderr, "INFO:\trunning step step::10-build...", LevelInfo, "running step step::10-build..."},
+		{Stderr, "WARN:\tstarting steps with step::20-install...", LevelWarn, "starting steps with step::20-install..."},
+		{Stderr, "\x1b[0;31mERROR\x1b[0m:\tdisk full", LevelError, "disk full"},
+		{Stderr, "FATAL:\topsh is too old", LevelFatal, "opsh is too old"},
+		{Stderr, "DEBUG:\tcleaning up", LevelDebug, "cleaning up"},
+		{Stderr, "warn:\tlower case", LevelWarn, "lower case"},
+		{Stderr, "error: no tab, not from opsh", LevelNone, "error: no tab, not from opsh"},
+		{Stderr, "NOTICE:\tunknown level", LevelNone, "NOTICE:\tunknown level"},
+		{Stderr, "+ set -x output", LevelNone, "+ set -x output"},
+		{Stdout, "ERROR:\tprinted by the command", LevelNone, "ERROR:\tprinted by the command"},
+	}
+
+	for _, tt := range tests {
+		line := ParseLogLine(tt.stream, tt.raw)
+		assert.Equal(t, tt.level, line.Level, tt.raw)
+		assert.Equal(t, tt.text, line.Text, tt.raw)
+		assert.Equal(t, tt.raw, line.Raw)
+		assert.Equal(t, tt.stream, line.Stream)
+	}
+
+	assert.Equal(t, "warn", LevelWarn.String())
+	assert.Equal(t, "none", LevelNone.String())
+	assert.Equal(t, "stderr", Stderr.String())
+}
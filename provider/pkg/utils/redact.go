@@ -0,0 +1,245 @@
+package utils
+
+import (
+	"context"
+	"encoding/base64"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+)
+
+const (
+	// Redacted replaces secrets.
+	Redacted = "[secret]"
+
+	// minSecretLength is the shortest secret redacted; shorter ones
+	// would mostly redact innocent text.
+	minSecretLength = 4
+
+	// minFragmentLength is the shortest piece of a secret redacted
+	// where a line starts or ends partway through it.
+	minFragmentLength = 8
+
+	// base64LineLength is where base64 and similar tools wrap lines.
+	base64LineLength = 76
+)
+
+// Redactor replaces secrets, and common encodings of them, in text.
+// Its methods do nothing on a nil Redactor.
+type Redactor struct {
+	replacer *strings.Replacer
+
+	// forms are the secrets and their encodings, longest first, for
+	// finding pieces of them at the ends of lines.
+	forms []string
+}
+
+// NewRedactor returns a Redactor for secrets, or nil if there are none
+// long enough to redact.
+func NewRedactor(secrets []string) *Redactor {
+	seen := map[string]bool{}
+
+	var forms []string
+	add := func(s string) {
+		s = strings.TrimSpace(s)
+		if len(s) >= minSecretLength && !seen[s] {
+			seen[s] = true
+			forms = append(forms, s)
+		}
+	}
+
+	for _, secret := range secrets {
+		if len(secret) < minSecretLength {
+			continue
+		}
+
+		add(secret)
+		add(url.QueryEscape(secret))
+		add(url.PathEscape(secret))
+
+		for _, enc := range []*base64.Encoding{base64.RawStdEncoding, base64.RawURLEncoding} {
+			for _, b64 := range base64Forms(enc, secret) {
+				add(b64)
+			}
+
+			// Wrapped, as by base64(1).
+			full := enc.EncodeToString([]byte(secret))
+			for i := 0; i < len(full); i += base64LineLength {
+				add(full[i:min(i+base64LineLength, len(full))])
+			}
+		}
+
+		// A multi-line secret, like a key, is output a line at a time.
+		for _, line := range strings.Split(secret, "\n") {
+			if len(strings.TrimSpace(line)) >= minFragmentLength {
+				add(line)
+			}
+		}
+	}
+
+	if len(forms) == 0 {
+		return nil
+	}
+
+	// strings.Replacer tries its old strings in order, so the longest
+	// has to come first.
+	sort.SliceStable(forms, func(i, j int) bool {
+		return len(forms[i]) > len(forms[j])
+	})
+
+	pairs := make([]string, 0, 2*len(forms))
+	for _, f := range forms {
+		pairs = append(pairs, f, Redacted)
+	}
+
+	return &Redactor{replacer: strings.NewReplacer(pairs...), forms: forms}
+}
+
+// base64Forms returns the characters of enc's encoding that only depend
+// on the secret, for each of the three ways it can be aligned in a
+// longer encoded string.
+func base64Forms(enc *base64.Encoding, secret string) []string {
+	var forms []string
+
+	for k := range 3 {
+		encoded := enc.EncodeToString(append(make([]byte, k), secret...))
+
+		start := (k*8 + 5) / 6
+		end := (k + len(secret)) * 8 / 6
+
+		forms = append(forms, encoded[start:end])
+	}
+
+	return forms
+}
+
+// Redact replaces the secrets in s.
+func (r *Redactor) Redact(s string) string {
+	if r == nil {
+		return s
+	}
+
+	return r.replacer.Replace(s)
+}
+
+// RedactLine is Redact for a line of output, which also replaces a
+// piece of a secret at its start or end, left by the secret having
+// been split over lines.
+func (r *Redactor) RedactLine(line string) string {
+	if r == nil {
+		return line
+	}
+
+	line = r.Redact(line)
+
+	for _, f := range r.forms {
+		for n := len(f) - 1; n >= minFragmentLength; n-- {
+			if strings.HasSuffix(line, f[:n]) {
+				line = line[:len(line)-n] + Redacted
+				break
+			}
+		}
+
+		for n := len(f) - 1; n >= minFragmentLength; n-- {
+			if strings.HasPrefix(line, f[len(f)-n:]) {
+				line = Redacted + line[n:]
+				break
+			}
+		}
+	}
+
+	return line
+}
+
+// redactedError is an error with secrets removed from its message,
+// which still unwraps to the original.
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// RedactError returns err with the secrets removed from its message.
+func (r *Redactor) RedactError(err error) error {
+	if r == nil || err == nil {
+		return err
+	}
+
+	msg := err.Error()
+	if redacted := r.Redact(msg); redacted != msg {
+		return &redactedError{msg: redacted, err: err}
+	}
+
+	return err
+}
+
+type redactorKey struct{}
+
+// secretSet is the secrets of the resource being operated on, and the
+// Redactor for them.
+type secretSet struct {
+	secrets  []string
+	redactor *Redactor
+}
+
+// WithSecrets returns a context for operating on a resource whose
+// secret inputs are in props, so they're redacted from what the run
+// reports.
+func WithSecrets(ctx context.Context, props ...resource.PropertyMap) context.Context {
+	var secrets []string
+	for _, m := range props {
+		secretStrings(resource.NewObjectProperty(m), false, &secrets)
+	}
+
+	return WithSecretValues(ctx, secrets...)
+}
+
+// WithSecretValues returns a context that redacts secrets as well as
+// any ctx already does, for values a resource always treats as secret.
+func WithSecretValues(ctx context.Context, secrets ...string) context.Context {
+	if set, ok := ctx.Value(redactorKey{}).(secretSet); ok {
+		secrets = append(append([]string{}, set.secrets...), secrets...)
+	}
+
+	return context.WithValue(ctx, redactorKey{}, secretSet{secrets: secrets, redactor: NewRedactor(secrets)})
+}
+
+// RedactorFrom returns the Redactor for the resource being operated on,
+// which is nil if it has no secrets.
+func RedactorFrom(ctx context.Context) *Redactor {
+	set, _ := ctx.Value(redactorKey{}).(secretSet)
+	return set.redactor
+}
+
+// secretStrings collects the strings in v that are, or are inside,
+// secrets.
+func secretStrings(v resource.PropertyValue, secret bool, out *[]string) {
+	switch {
+	case v.IsSecret():
+		secretStrings(v.SecretValue().Element, true, out)
+	case v.IsOutput():
+		o := v.OutputValue()
+		secretStrings(o.Element, secret || o.Secret, out)
+	case v.IsString():
+		if secret {
+			*out = append(*out, v.StringValue())
+		}
+	case v.IsArray():
+		for _, e := range v.ArrayValue() {
+			secretStrings(e, secret, out)
+		}
+	case v.IsObject():
+		for _, e := range v.ObjectValue() {
+			secretStrings(e, secret, out)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "hunter2-s3cr3t/value+more"
+
+func TestRedact(t *testing.T) {
+	r := NewRedactor([]string{testSecret, "abc"})
+	require.NotNil(t, r)
+
+	tests := []struct{ name, in string }{
+		{"plain", "token=" + testSecret + " ok"},
+		{"query", "curl https://x/?t=" + url.QueryEscape(testSecret)},
+		{"path", "GET /" + url.PathEscape(testSecret)},
+		{"base64", "Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(testSecret))},
+		{"base64url", base64.URLEncoding.EncodeToString([]byte(testSecret))},
+		{"base64 offset 1", base64.StdEncoding.EncodeToString([]byte("u:" + testSecret))},
+		{"base64 offset 2", base64.StdEncoding.EncodeToString([]byte("us:" + testSecret))},
+	}
+
+	for _, tt := range tests {
+		got := r.Redact(tt.in)
+		assert.Contains(t, got, Redacted, tt.name)
+		assert.NotContains(t, got, testSecret, tt.name)
+		assert.NotContains(t, got, "s3cr3t", tt.name)
+	}
+
+	// Too short to redact.
+	assert.Equal(t, "abc", r.Redact("abc"))
+	assert.Nil(t, NewRedactor([]string{"abc", ""}))
+
+	var none *Redactor
+	assert.Equal(t, testSecret, none.Redact(testSecret))
+	assert.Equal(t, testSecret, none.RedactLine(testSecret))
+}
+
+func TestRedactLine(t *testing.T) {
+	r := NewRedactor([]string{testSecret})
+
+	// Split over two lines, as by a terminal or a long line.
+	first := "the token is " + testSecret[:12]
+	second := testSecret[12:] + " and more"
+
+	assert.Equal(t, "the token is "+Redacted, r.RedactLine(first))
+	assert.Equal(t, Redacted+" and more", r.RedactLine(second))
+
+	// Pieces too short to tell from other text are left alone.
+	assert.Equal(t, "ends with hun", r.RedactLine("ends with hun"))
+
+	key := "-----BEGIN KEY-----\nMIIEowIBAAKCAQEAx1ZpV1\nQ2FrZXMgYXJlIGdvb2Qh\n-----END KEY-----"
+	r = NewRedactor([]string{key})
+	for _, line := range strings.Split(key, "\n") {
+		assert.Equal(t, Redacted, r.RedactLine(line))
+	}
+
+	long := strings.Repeat("0123456789", 12)
+	r = NewRedactor([]string{long})
+	wrapped := base64.StdEncoding.EncodeToString([]byte(long))
+	for i := 0; i < len(wrapped); i += 76 {
+		line := wrapped[i:min(i+76, len(wrapped))]
+		assert.NotContains(t, r.RedactLine(line), line[:min(len(line), 20)])
+	}
+}
+
+func TestRedactError(t *testing.T) {
+	r := NewRedactor([]string{testSecret})
+
+	step := &StepError{Step: "10-login", Err: fmt.Errorf("login with %s failed", testSecret)}
+	err := r.RedactError(fmt.Errorf("run: %w", step))
+
+	assert.EqualError(t, err, "run: login with "+Redacted+" failed")
+
+	var stepErr *StepError
+	require.True(t, errors.As(err, &stepErr))
+	assert.Equal(t, "10-login", stepErr.Step)
+
+	plain := errors.New("nothing secret")
+	assert.Same(t, plain, r.RedactError(plain))
+	assert.NoError(t, r.RedactError(nil))
+}
+
+func TestWithSecrets(t *testing.T) {
+	props := resource.PropertyMap{
+		"connection": resource.NewObjectProperty(resource.PropertyMap{
+			"host":     resource.NewStringProperty("10.0.0.1"),
+			"password": resource.MakeSecret(resource.NewStringProperty("p4ssw0rd!")),
+		}),
+		"environment": resource.MakeSecret(resource.NewObjectProperty(resource.PropertyMap{
+			"TOKEN": resource.NewStringProperty(testSecret),
+		})),
+		"payload": resource.NewArrayProperty([]resource.PropertyValue{
+			resource.NewOutputProperty(resource.Output{
+				Element: resource.NewStringProperty("file-contents-secret"),
+				Known:   true,
+				Secret:  true,
+			}),
+		}),
+	}
+
+	ctx := WithSecrets(context.Background(), props)
+	r := RedactorFrom(ctx)
+	require.NotNil(t, r)
+
+	assert.Equal(t, "10.0.0.1 "+Redacted+" "+Redacted+" "+Redacted,
+		r.Redact("10.0.0.1 p4ssw0rd! "+testSecret+" file-contents-secret"))
+
+	ctx = WithSecretValues(ctx, "another-secret")
+	assert.Equal(t, Redacted+" "+Redacted, RedactorFrom(ctx).Redact("p4ssw0rd! another-secret"))
+
+	assert.Nil(t, RedactorFrom(WithSecrets(context.Background(), resource.PropertyMap{})))
+	assert.Nil(t, RedactorFrom(context.Background()))
+}
+
+func TestPulumiLoggerHandlerRedacts(t *testing.T) {
+	ctx := WithSecretValues(context.Background(), testSecret)
+	h := MakePulumiLogger(ctx, nil)
+
+	stdout := strings.NewReader("export TOKEN=" + testSecret + "\n")
+
+	done := make(chan struct{})
+	require.NoError(t, h.IngestReaders(done, stdout, strings.NewReader("")))
+	<-done
+
+	assert.Equal(t, []string{"export TOKEN=" + Redacted}, h.Stdout())
+	assert.NotContains(t, h.AugmentError(errors.New("failed")).Error(), testSecret)
+	require.NoError(t, h.Close(false))
+}
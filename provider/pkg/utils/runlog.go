@@ -0,0 +1,278 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	runner "github.com/abklabs/pulumi-runner/pkg/runner/core"
+	p "github.com/pulumi/pulumi-go-provider"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+const (
+	runLogPrefix = "run-"
+	runLogSuffix = ".log"
+
+	// runLogTimeFormat sorts lexically in time order.
+	runLogTimeFormat = "20060102T150405.000Z"
+)
+
+type urnKey struct{}
+
+// WithURN returns a context for operating on the resource with the
+// given URN, so runs can be logged against it.
+func WithURN(ctx context.Context, urn string) context.Context {
+	return context.WithValue(ctx, urnKey{}, urn)
+}
+
+// URN returns the URN of the resource being operated on, if known.
+func URN(ctx context.Context) string {
+	urn, _ := ctx.Value(urnKey{}).(string)
+	return urn
+}
+
+var unsafeFileRegexp = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// RunLogInfo identifies a run in its log.
+type RunLogInfo struct {
+	URN       string
+	Host      string
+	Operation string
+}
+
+// runInfo identifies the run being made with runnerArgs.
+func runInfo(ctx context.Context, runnerArgs RunnerArgs) RunLogInfo {
+	info := RunLogInfo{URN: URN(ctx), Operation: runnerArgs.Operation}
+	if runnerArgs.Connection.Host != nil {
+		info.Host = *runnerArgs.Connection.Host
+	}
+
+	return info
+}
+
+// name is a readable part of a log's file name for the run.
+func (i RunLogInfo) name() string {
+	name := i.URN
+	if n := strings.LastIndex(name, "::"); n >= 0 {
+		name = name[n+2:]
+	}
+
+	parts := []string{}
+	for _, s := range []string{name, i.Operation} {
+		if s = strings.Trim(unsafeFileRegexp.ReplaceAllString(s, "_"), "_"); s != "" {
+			parts = append(parts, s)
+		}
+	}
+
+	return strings.Join(parts, "-")
+}
+
+// RunLog is a local log of a single run of a command: who it was for,
+// its step boundaries, all of its output and how it ended.
+type RunLog struct {
+	f     *os.File
+	start time.Time
+	err   error
+}
+
+// OpenRunLog starts a log of a run in dir, named for when it started.
+func OpenRunLog(dir string, info RunLogInfo) (*RunLog, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	start := time.Now()
+
+	name := runLogPrefix + start.UTC().Format(runLogTimeFormat)
+	if n := info.name(); n != "" {
+		name += "-" + n
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, name+runLogSuffix), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create run log: %w", err)
+	}
+
+	l := &RunLog{f: f, start: start}
+
+	l.printf("# urn: %s\n", info.URN)
+	l.printf("# host: %s\n", info.Host)
+	l.printf("# operation: %s\n", info.Operation)
+	l.printf("# started: %s\n", start.UTC().Format(time.RFC3339Nano))
+
+	return l, nil
+}
+
+// printf writes to the log, keeping the first error.
+func (l *RunLog) printf(format string, a ...any) {
+	if l.err != nil {
+		return
+	}
+
+	_, l.err = fmt.Fprintf(l.f, format, a...)
+}
+
+func (l *RunLog) elapsed() string {
+	return fmt.Sprintf("%10.3f", time.Since(l.start).Seconds())
+}
+
+// Path is the file the run is logged to.
+func (l *RunLog) Path() string {
+	return l.f.Name()
+}
+
+// Line logs a line of output.
+func (l *RunLog) Line(line LogLine) {
+	l.printf("%s %s %s\n", l.elapsed(), line.Stream, line.Raw)
+}
+
+// Step logs a step starting or ending.
+func (l *RunLog) Step(ev runner.StepEvent) {
+	if ev.Start {
+		l.printf("%s step %s start\n", l.elapsed(), ev.Name)
+	} else {
+		l.printf("%s step %s end %d\n", l.elapsed(), ev.Name, ev.ExitCode)
+	}
+}
+
+// DialStart logs the host starting to be dialed.
+func (l *RunLog) DialStart() {
+	l.printf("%s dial start\n", l.elapsed())
+}
+
+// DialFinish logs dialing the host finishing, with err being its error
+// if it failed.
+func (l *RunLog) DialFinish(err error) {
+	if err != nil {
+		l.printf("%s dial failed: %s\n", l.elapsed(), strings.ReplaceAll(err.Error(), "\n", " "))
+		return
+	}
+
+	l.printf("%s dial end\n", l.elapsed())
+}
+
+// Close logs how the run ended, with err being its error if it failed.
+func (l *RunLog) Close(err error) error {
+	l.printf("# duration: %s\n", time.Since(l.start).Round(time.Millisecond))
+	l.printf("# exit code: %d\n", exitCode(err))
+
+	if err != nil {
+		l.printf("# error: %s\n", strings.ReplaceAll(err.Error(), "\n", "\n#   "))
+	}
+
+	return errors.Join(l.err, l.f.Close())
+}
+
+// exitCode is the exit code of a command that finished with err, or -1
+// if it didn't exit.
+func exitCode(err error) int {
+	var (
+		sshErr  *gossh.ExitError
+		execErr *exec.ExitError
+	)
+
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &sshErr):
+		return sshErr.ExitStatus()
+	case errors.As(err, &execErr):
+		return execErr.ExitCode()
+	}
+
+	return -1
+}
+
+// PruneRunLogs removes run logs in dir beyond the newest keep of them,
+// and any older than maxAge.  Zero for either means no limit.
+func PruneRunLogs(dir string, keep int, maxAge time.Duration, now time.Time) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && strings.HasPrefix(e.Name(), runLogPrefix) && strings.HasSuffix(e.Name(), runLogSuffix) {
+			names = append(names, e.Name())
+		}
+	}
+
+	// Newest first.
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+
+	var errs []error
+
+	for i, name := range names {
+		path := filepath.Join(dir, name)
+
+		remove := keep > 0 && i >= keep
+
+		if !remove && maxAge > 0 {
+			info, err := os.Stat(path)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			remove = now.Sub(info.ModTime()) > maxAge
+		}
+
+		if remove {
+			if err := os.Remove(path); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// startRunLog opens a log of the run if config has a log directory.
+// Failing to is only worth a warning.
+func startRunLog(ctx context.Context, runnerArgs RunnerArgs, config *runner.Config) *RunLog {
+	if config == nil || config.LogDir == nil {
+		return nil
+	}
+
+	l, err := OpenRunLog(*config.LogDir, runInfo(ctx, runnerArgs))
+	if err != nil {
+		p.GetLogger(ctx).Warningf("not logging the run: %s", err)
+		return nil
+	}
+
+	return l
+}
+
+// finishRunLog closes the log of a run that ended with err, and prunes
+// the old ones.
+func finishRunLog(ctx context.Context, l *RunLog, config *runner.Config, err error) {
+	logger := p.GetLogger(ctx)
+
+	if cerr := l.Close(err); cerr != nil {
+		logger.Warningf("failed to write run log %s: %s", l.Path(), cerr)
+	} else {
+		logger.Infof("run logged to %s", l.Path())
+	}
+
+	keep := 0
+	if config.LogKeepCount != nil {
+		keep = *config.LogKeepCount
+	}
+
+	var maxAge time.Duration
+	if config.LogKeepDays != nil {
+		maxAge = time.Duration(*config.LogKeepDays * float64(24*time.Hour))
+	}
+
+	if perr := PruneRunLogs(*config.LogDir, keep, maxAge, time.Now()); perr != nil {
+		logger.Warningf("failed to remove old run logs: %s", perr)
+	}
+}
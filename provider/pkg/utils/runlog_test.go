@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	runner "github.com/abklabs/pulumi-runner/pkg/runner/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunLog(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+
+	info := RunLogInfo{
+		URN:       "urn:pulumi:dev::svmkit::runner:index:SSHDeployer::validator/bootstrap",
+		Host:      "10.0.0.1",
+		Operation: "create",
+	}
+
+	l, err := OpenRunLog(dir, info)
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasSuffix(l.Path(), "-validator_bootstrap-create.log"), l.Path())
+
+	l.Step(runner.StepEvent{Name: "10-build", Start: true})
+	l.Line(ParseLogLine(Stdout, "compiling"))
+	l.Line(ParseLogLine(Stderr, "ERROR:\tout of disk"))
+	l.Step(runner.StepEvent{Name: "10-build", ExitCode: 2})
+
+	require.NoError(t, l.Close(errors.New("command execution failed\nstep 10-build failed")))
+
+	data, err := os.ReadFile(l.Path())
+	require.NoError(t, err)
+
+	log := string(data)
+	assert.Contains(t, log, "# urn: "+info.URN+"\n# host: 10.0.0.1\n# operation: create\n# started: ")
+	assert.Regexp(t, `\n +[0-9.]+ step 10-build start\n +[0-9.]+ stdout compiling\n +[0-9.]+ stderr ERROR:\tout of disk\n +[0-9.]+ step 10-build end 2\n`, log)
+	assert.Contains(t, log, "# exit code: -1\n# error: command execution failed\n#   step 10-build failed\n")
+}
+
+func TestRunLogContext(t *testing.T) {
+	assert.Equal(t, "", URN(context.Background()))
+	assert.Equal(t, "urn:x", URN(WithURN(context.Background(), "urn:x")))
+
+	assert.Equal(t, 0, exitCode(nil))
+	assert.Equal(t, -1, exitCode(errors.New("dial failed")))
+}
+
+func TestPruneRunLogs(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	names := []string{
+		"run-20250101T000000.000Z-a-create.log",
+		"run-20250102T000000.000Z-a-update.log",
+		"run-20250103T000000.000Z-a-update.log",
+		"run-20250104T000000.000Z-a-update.log",
+	}
+
+	for i, name := range names {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, nil, 0600))
+
+		age := time.Duration(len(names)-i) * 24 * time.Hour
+		require.NoError(t, os.Chtimes(path, now.Add(-age), now.Add(-age)))
+	}
+
+	other := filepath.Join(dir, "notes.txt")
+	require.NoError(t, os.WriteFile(other, nil, 0600))
+	require.NoError(t, os.Chtimes(other, now.Add(-100*24*time.Hour), now.Add(-100*24*time.Hour)))
+
+	require.NoError(t, PruneRunLogs(dir, 3, 0, now))
+	assert.NoFileExists(t, filepath.Join(dir, names[0]))
+	assert.FileExists(t, filepath.Join(dir, names[1]))
+
+	require.NoError(t, PruneRunLogs(dir, 0, 36*time.Hour, now))
+	assert.NoFileExists(t, filepath.Join(dir, names[1]))
+	assert.NoFileExists(t, filepath.Join(dir, names[2]))
+	assert.FileExists(t, filepath.Join(dir, names[3]))
+	assert.FileExists(t, other)
+}
@@ -6,11 +6,15 @@ import (
 	"github.com/abklabs/pulumi-runner/pkg/runner/core"
 	"github.com/abklabs/pulumi-runner/pkg/ssh"
 	p "github.com/pulumi/pulumi-go-provider"
+	gossh "golang.org/x/crypto/ssh"
 	"time"
 )
 
 type RunnerArgs struct {
 	Connection ssh.Connection `pulumi:"connection"`
+
+	// Operation is what the run is for, such as "create", for its log.
+	Operation string
 }
 
 func RunnerHelper(ctx context.Context, runnerArgs RunnerArgs, command runner.Command) error {
@@ -18,13 +22,64 @@ func RunnerHelper(ctx context.Context, runnerArgs RunnerArgs, command runner.Com
 		return fmt.Errorf("failed to check component config: %w", err)
 	}
 
+	events := openEventSink(ctx, runnerArgs, command.Config())
+	defer closeEventSink(ctx, events)
+
+	events.Emit(Event{Type: EventRunStart})
+
+	// The log is started before dialing, so a run that can't connect
+	// is logged too.
+	runLog := startRunLog(ctx, runnerArgs, command.Config())
+
+	start := time.Now()
+	events.Emit(Event{Type: EventDialStart})
+	if runLog != nil {
+		runLog.DialStart()
+	}
+
 	client, err := runnerArgs.Connection.Dial(ctx)
+	err = RedactorFrom(ctx).RedactError(err)
+	events.Finish(EventDialFinish, start, err)
+	if runLog != nil {
+		runLog.DialFinish(err)
+	}
 
 	if err != nil {
-		return fmt.Errorf("failed to dial SSH connection to hosst: %w", err)
+		err = fmt.Errorf("failed to dial SSH connection to hosst: %w", err)
+		events.Finish(EventRunFinish, start, err)
+		if runLog != nil {
+			finishRunLog(ctx, runLog, command.Config(), err)
+		}
+		return err
 	}
 
+	return runOnClient(ctx, client, runnerArgs, command, events, runLog, start)
+}
+
+// RunOnClient checks and runs a command over a client dialed with
+// runnerArgs.Connection, for callers that need the connection for more
+// than the command.
+func RunOnClient(ctx context.Context, client *gossh.Client, runnerArgs RunnerArgs, command runner.Command) error {
+	if err := command.Check(); err != nil {
+		return fmt.Errorf("failed to check component config: %w", err)
+	}
+
+	events := openEventSink(ctx, runnerArgs, command.Config())
+	defer closeEventSink(ctx, events)
+
+	events.Emit(Event{Type: EventRunStart})
+
+	runLog := startRunLog(ctx, runnerArgs, command.Config())
+
+	return runOnClient(ctx, client, runnerArgs, command, events, runLog, time.Now())
+}
+
+// runOnClient runs the command, sending events about it to events from
+// the run having started at runStart, and logging it to runLog if set.
+func runOnClient(ctx context.Context, client *gossh.Client, runnerArgs RunnerArgs, command runner.Command, events *EventSink, runLog *RunLog, runStart time.Time) error {
 	pcb := func(filename string, copied int, size int, start time.Time) {
+		events.Emit(uploadEvent(filename, copied, size))
+
 		logger := p.GetLogger(ctx)
 		elapsed := time.Since(start).Seconds()
 		speed := float64(copied) / elapsed // bytes/sec
@@ -50,11 +105,51 @@ func RunnerHelper(ctx context.Context, runnerArgs RunnerArgs, command runner.Com
 
 	r := runner.NewRunner(client, command)
 
-	handler := MakePulumiLogger(ctx)
+	if runnerArgs.Connection.AgentForwarding() {
+		p.GetLogger(ctx).Infof("forwarding SSH agent to %s", *runnerArgs.Connection.Host)
+		r.ForwardAgent()
+	}
+
+	handler := MakePulumiLogger(ctx, command.Config())
+	handler.runLog = runLog
+	handler.events = events
+
+	err := RedactorFrom(ctx).RedactError(r.Run(ctx, handler, pcb))
+	events.Finish(EventRunFinish, runStart, err)
+
+	if handler.runLog != nil {
+		finishRunLog(ctx, handler.runLog, command.Config(), err)
+	}
+
+	// Keep the full output only if the run failed, for the error to
+	// point at.
+	if cerr := handler.Close(err != nil); cerr != nil {
+		p.GetLogger(ctx).Warningf("failed to clean up the command's output: %s", cerr)
+	}
 
-	if err := r.Run(ctx, handler, pcb); err != nil {
+	if err != nil {
+		if step, ok := handler.FailedStep(); ok {
+			return &StepError{Step: step.Name, Err: err}
+		}
 		return err
 	}
 
 	return nil
 }
+
+// StepError is returned when a command running steps fails in one of
+// them.
+type StepError struct {
+	// Step is the name of the failed step function, without the
+	// "step::" prefix.
+	Step string
+	Err  error
+}
+
+func (e *StepError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	runner "github.com/abklabs/pulumi-runner/pkg/runner/core"
+	"github.com/abklabs/pulumi-runner/pkg/ssh"
+	"github.com/abklabs/pulumi-runner/pkg/ssh/sshtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ptr[T any](in T) *T {
+	return &in
+}
+
+// testCommand runs script as its steps.
+type testCommand struct {
+	script string
+	config *runner.Config
+}
+
+func (c *testCommand) Check() error {
+	if c.script == "" {
+		return errors.New("script cannot be empty")
+	}
+	return nil
+}
+
+func (c *testCommand) Env() *runner.EnvBuilder {
+	return runner.NewEnvBuilder()
+}
+
+func (c *testCommand) AddToPayload(p *runner.Payload) error {
+	p.AddString(runner.ScriptNameSteps, c.script)
+	return nil
+}
+
+func (c *testCommand) Config() *runner.Config {
+	return c.config
+}
+
+func TestRunOnClientChecks(t *testing.T) {
+	server := sshtest.NewServer(t)
+	sshtest.StubSudo(t)
+	client := server.Dial(t)
+
+	err := RunOnClient(context.Background(), client, RunnerArgs{}, &testCommand{})
+	assert.EqualError(t, err, "failed to check component config: script cannot be empty")
+
+	require.NoError(t, RunOnClient(context.Background(), client, RunnerArgs{}, &testCommand{script: "true"}))
+}
+
+// unreachableConnection returns a connection to a port nothing listens
+// on, and its address.
+func unreachableConnection(t *testing.T) (ssh.Connection, string) {
+	t.Helper()
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	// Nothing listens on the port once the listener's closed.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().(*net.TCPAddr)
+	require.NoError(t, l.Close())
+
+	con := ssh.Connection{}
+	con.Host = ptr("127.0.0.1")
+	con.Port = ptr(float64(addr.Port))
+	con.User = ptr("test")
+	con.DialErrorLimit = ptr(1)
+	con.PerDialTimeout = ptr(5)
+
+	return con, addr.String()
+}
+
+func TestRunnerHelperRedactsDialError(t *testing.T) {
+	con, secret := unreachableConnection(t)
+	ctx := WithSecretValues(context.Background(), secret)
+
+	events := filepath.Join(t.TempDir(), "events.jsonl")
+
+	err := RunnerHelper(ctx, RunnerArgs{Connection: con}, &testCommand{script: "true", config: &runner.Config{EventSink: &events}})
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), secret)
+
+	data, err := os.ReadFile(events)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"type":"dial.finish"`)
+	assert.NotContains(t, string(data), secret)
+}
+
+func TestRunnerHelperLogsDialError(t *testing.T) {
+	con, _ := unreachableConnection(t)
+
+	dir := t.TempDir()
+
+	err := RunnerHelper(context.Background(), RunnerArgs{Connection: con, Operation: "create"}, &testCommand{script: "true", config: &runner.Config{LogDir: &dir}})
+	require.Error(t, err)
+
+	logs, err := filepath.Glob(filepath.Join(dir, "run-*.log"))
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+
+	data, err := os.ReadFile(logs[0])
+	require.NoError(t, err)
+
+	log := string(data)
+	assert.Contains(t, log, "# host: 127.0.0.1\n# operation: create\n")
+	assert.Regexp(t, `\n +[0-9.]+ dial start\n +[0-9.]+ dial failed: .+\n`, log)
+	assert.Contains(t, log, "# exit code: -1\n# error: failed to dial SSH connection")
+}
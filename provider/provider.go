@@ -15,7 +15,10 @@
 package provider
 
 import (
+	"context"
+
 	"github.com/abklabs/pulumi-runner/pkg/runner"
+	"github.com/abklabs/pulumi-runner/pkg/utils"
 
 	p "github.com/pulumi/pulumi-go-provider"
 	"github.com/pulumi/pulumi-go-provider/infer"
@@ -33,7 +36,7 @@ const Name string = "runner"
 func Provider() p.Provider {
 	// We tell the provider what resources it needs to support.
 	// In this case, a single custom resource.
-	return infer.Provider(infer.Options{
+	return withRunContext(infer.Provider(infer.Options{
 		Metadata: schema.Metadata{
 			DisplayName: "runner",
 			Description: "An alternative way to run scripts locally and remotely for pulumi",
@@ -64,13 +67,57 @@ func Provider() p.Provider {
 		},
 		Resources: []infer.InferredResource{
 			infer.Resource[runner.SSHDeployer](),
+			infer.Resource[runner.RemoteFile](),
+			infer.Resource[runner.RemoteDirectory](),
+			infer.Resource[runner.AptPackages](),
+			infer.Resource[runner.AptRepository](),
 		},
 		Functions: []infer.InferredFunction{
 			infer.Function[runner.LocalFile](),
 			infer.Function[runner.StringFile](),
+			infer.Function[runner.ReadRemoteFile](),
+			infer.Function[runner.Probe](),
 		},
 		ModuleMap: map[tokens.ModuleName]tokens.ModuleName{
 			"core": "runner",
 		},
-	})
+	}))
+}
+
+// withRunContext passes the URN and secret inputs of the resource being
+// operated on to the resources and functions, which infer doesn't, for
+// their run logs and to redact the secrets from what they report.
+func withRunContext(prov p.Provider) p.Provider {
+	create, read, update, del, invoke := prov.Create, prov.Read, prov.Update, prov.Delete, prov.Invoke
+
+	prov.Create = func(ctx context.Context, req p.CreateRequest) (p.CreateResponse, error) {
+		ctx = utils.WithSecrets(utils.WithURN(ctx, string(req.Urn)), req.Properties)
+		resp, err := create(ctx, req)
+		return resp, utils.RedactorFrom(ctx).RedactError(err)
+	}
+
+	prov.Read = func(ctx context.Context, req p.ReadRequest) (p.ReadResponse, error) {
+		ctx = utils.WithSecrets(utils.WithURN(ctx, string(req.Urn)), req.Properties, req.Inputs)
+		resp, err := read(ctx, req)
+		return resp, utils.RedactorFrom(ctx).RedactError(err)
+	}
+
+	prov.Update = func(ctx context.Context, req p.UpdateRequest) (p.UpdateResponse, error) {
+		ctx = utils.WithSecrets(utils.WithURN(ctx, string(req.Urn)), req.Olds, req.News)
+		resp, err := update(ctx, req)
+		return resp, utils.RedactorFrom(ctx).RedactError(err)
+	}
+
+	prov.Delete = func(ctx context.Context, req p.DeleteRequest) error {
+		ctx = utils.WithSecrets(utils.WithURN(ctx, string(req.Urn)), req.Properties)
+		return utils.RedactorFrom(ctx).RedactError(del(ctx, req))
+	}
+
+	prov.Invoke = func(ctx context.Context, req p.InvokeRequest) (p.InvokeResponse, error) {
+		ctx = utils.WithSecrets(ctx, req.Args)
+		resp, err := invoke(ctx, req)
+		return resp, utils.RedactorFrom(ctx).RedactError(err)
+	}
+
+	return prov
 }
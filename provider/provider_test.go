@@ -0,0 +1,41 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	p "github.com/pulumi/pulumi-go-provider"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/stretchr/testify/assert"
+)
+
+func secretProps() resource.PropertyMap {
+	return resource.PropertyMap{
+		"connection": resource.NewObjectProperty(resource.PropertyMap{
+			"password": resource.MakeSecret(resource.NewStringProperty("p4ssw0rd!")),
+		}),
+	}
+}
+
+func TestWithRunContextRead(t *testing.T) {
+	prov := withRunContext(p.Provider{
+		Read: func(ctx context.Context, req p.ReadRequest) (p.ReadResponse, error) {
+			return p.ReadResponse{}, fmt.Errorf("failed to log in with p4ssw0rd!")
+		},
+	})
+
+	_, err := prov.Read(context.Background(), p.ReadRequest{Urn: "urn:pulumi:dev::proj::runner:index:RemoteFile::motd", Properties: secretProps()})
+	assert.EqualError(t, err, "failed to log in with [secret]")
+}
+
+func TestWithRunContextInvoke(t *testing.T) {
+	prov := withRunContext(p.Provider{
+		Invoke: func(ctx context.Context, req p.InvokeRequest) (p.InvokeResponse, error) {
+			return p.InvokeResponse{}, fmt.Errorf("failed to log in with p4ssw0rd!")
+		},
+	})
+
+	_, err := prov.Invoke(context.Background(), p.InvokeRequest{Token: "runner:index:readRemoteFile", Args: secretProps()})
+	assert.EqualError(t, err, "failed to log in with [secret]")
+}